@@ -0,0 +1,250 @@
+// Command apigen generates the typed API client in internal/client from the
+// embedded OpenAPI document. It is run by go generate in that package.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+	"websocket-chat/internal/openapi"
+)
+
+const schemaPrefix = "#/components/schemas/"
+
+var initialisms = map[string]string{"id": "ID", "url": "URL", "jwks": "JWKS", "api": "API", "oidc": "OIDC"}
+
+func main() {
+	out := flag.String("o", "api_gen.go", "output file")
+	pkg := flag.String("pkg", "client", "package name")
+	flag.Parse()
+
+	doc, err := openapi.Parse()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	g := &generator{doc: doc}
+	g.types()
+	g.operations()
+	body := g.buf.String()
+
+	var file bytes.Buffer
+	fmt.Fprintf(&file, "// Code generated by apigen from internal/openapi/openapi.json. DO NOT EDIT.\n\npackage %s\n\nimport (\n\"context\"\n", *pkg)
+	for _, imp := range []string{"net/url", "time"} {
+		if strings.Contains(body, path.Base(imp)+".") {
+			fmt.Fprintf(&file, "%q\n", imp)
+		}
+	}
+	file.WriteString(")\n\n" + body)
+
+	src, err := format.Source(file.Bytes())
+	if err != nil {
+		log.Fatalf("formatting generated code: %v\n%s", err, file.Bytes())
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type generator struct {
+	doc *openapi.Document
+	buf bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) types() {
+	for _, name := range sortedKeys(g.doc.Components.Schemas) {
+		schema := g.doc.Components.Schemas[name]
+		if schema.Description != "" {
+			g.printf("// %s: %s\n", name, schema.Description)
+		}
+		g.printf("type %s struct {\n", name)
+		for _, prop := range sortedKeys(schema.Properties) {
+			field := schema.Properties[prop]
+			tag := prop
+			if !slices.Contains(schema.Required, prop) {
+				tag += ",omitempty"
+			}
+			typ := goType(field)
+			if field.Nullable {
+				typ = "*" + typ
+			}
+			if len(field.Enum) > 0 {
+				g.printf("// One of %s.\n", strings.Join(field.Enum, ", "))
+			}
+			g.printf("%s %s `json:%q`\n", goName(prop), typ, tag)
+		}
+		g.printf("}\n\n")
+	}
+}
+
+func (g *generator) operations() {
+	for _, route := range sortedKeys(g.doc.Paths) {
+		ops := g.doc.Paths[route].Operations()
+		for _, method := range sortedKeys(ops) {
+			g.operation(method, route, ops[method])
+		}
+	}
+}
+
+// operation writes a client method. Deprecated operations and those
+// without a 2xx response, such as redirects and the WebSocket upgrade, are
+// skipped.
+func (g *generator) operation(method, route string, op *openapi.Operation) {
+	result, ok := successSchema(op)
+	if !ok || op.Deprecated {
+		return
+	}
+
+	name := goName(op.OperationID)
+	params := []string{"ctx context.Context"}
+	pathExpr := fmt.Sprintf("%q", route)
+	var query []string
+	for _, p := range op.Parameters {
+		p = g.doc.Parameter(p)
+		arg := lowerFirst(goName(p.Name))
+		params = append(params, arg+" string")
+		switch p.In {
+		case "path":
+			pathExpr = strings.Replace(pathExpr, "{"+p.Name+"}", `" + url.PathEscape(`+arg+`) + "`, 1)
+		case "query":
+			query = append(query, fmt.Sprintf("%q: {%s}", p.Name, arg))
+		}
+	}
+	pathExpr = strings.TrimSuffix(strings.TrimPrefix(pathExpr, `"" + `), ` + ""`)
+
+	body := "nil"
+	if op.RequestBody != nil {
+		if schema := op.RequestBody.Content["application/json"].Schema; schema != nil {
+			params = append(params, "body "+goType(schema))
+			body = "body"
+		}
+	}
+
+	queryExpr := "nil"
+	if len(query) > 0 {
+		queryExpr = "url.Values{" + strings.Join(query, ", ") + "}"
+	}
+
+	g.printf("// %s calls %s %s. %s.\n", name, method, route, op.Summary)
+	if result == nil {
+		g.printf("func (c *Client) %s(%s) error {\n", name, strings.Join(params, ", "))
+		g.printf("return c.do(ctx, %q, %s, %s, %s, nil)\n}\n\n", method, pathExpr, queryExpr, body)
+		return
+	}
+
+	typ := goType(result)
+	ret, deref := typ, "out"
+	if result.Ref != "" {
+		ret, deref = "*"+typ, "&out"
+	}
+	g.printf("func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(params, ", "), ret)
+	g.printf("var out %s\n", typ)
+	g.printf("if err := c.do(ctx, %q, %s, %s, %s, &out); err != nil {\nvar zero %s\nreturn zero, err\n}\n", method, pathExpr, queryExpr, body, ret)
+	g.printf("return %s, nil\n}\n\n", deref)
+}
+
+// successSchema returns the JSON schema of the lowest 2xx response, or nil
+// when it has no JSON body. ok is false without a 2xx response.
+func successSchema(op *openapi.Operation) (schema *openapi.Schema, ok bool) {
+	for _, code := range sortedKeys(op.Responses) {
+		if strings.HasPrefix(code, "2") {
+			return op.Responses[code].Content["application/json"].Schema, true
+		}
+	}
+	return nil, false
+}
+
+func goType(s *openapi.Schema) string {
+	if name, ok := strings.CutPrefix(s.Ref, schemaPrefix); ok {
+		return name
+	}
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			return "time.Time"
+		}
+		return "string"
+	case "integer":
+		return "int"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]" + goType(s.Items)
+	case "object":
+		if s.AdditionalProperties != nil {
+			return "map[string]" + goType(s.AdditionalProperties)
+		}
+		return "map[string]interface{}"
+	}
+	return "interface{}"
+}
+
+// goName turns a camelCase identifier into an exported Go name, keeping
+// initialisms upper case: roomID and roomId both become RoomID.
+func goName(s string) string {
+	var words []string
+	runes := []rune(s)
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		if i == len(runes) || boundary(runes, i) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+
+	var b strings.Builder
+	for _, word := range words {
+		if upper, ok := initialisms[strings.ToLower(word)]; ok {
+			b.WriteString(upper)
+			continue
+		}
+		r := []rune(word)
+		b.WriteRune(unicode.ToUpper(r[0]))
+		b.WriteString(string(r[1:]))
+	}
+	return b.String()
+}
+
+func boundary(r []rune, i int) bool {
+	if !unicode.IsUpper(r[i]) {
+		return false
+	}
+	if !unicode.IsUpper(r[i-1]) {
+		return true
+	}
+	// The last capital of a run starts a new word: JWKSet -> JWK, Set.
+	return i+1 < len(r) && unicode.IsLower(r[i+1])
+}
+
+func lowerFirst(s string) string {
+	for _, initialism := range initialisms {
+		if strings.HasPrefix(s, initialism) {
+			return strings.ToLower(initialism) + s[len(initialism):]
+		}
+	}
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+	"websocket-chat/internal/utils"
+)
+
+const usage = `usage: keys <command> [flags]
+
+commands:
+  generate  create a new key set file with one active key
+  rotate    add a new active key, keeping the previous one valid for -overlap
+  list      print the keys in a key set file`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	file := fs.String("file", "keys.json", "key set file")
+	alg := fs.String("alg", utils.AlgEdDSA, "signing algorithm: HS256, RS256 or EdDSA")
+	overlap := fs.Duration("overlap", 360*time.Hour, "how long the previous key stays valid, at least the token lifetime")
+	force := fs.Bool("force", false, "overwrite an existing key set file")
+	fs.Parse(os.Args[2:])
+
+	var err error
+	switch os.Args[1] {
+	case "generate":
+		err = generate(*file, *alg, *force)
+	case "rotate":
+		err = rotate(*file, *alg, *overlap)
+	case "list":
+		err = list(*file)
+	default:
+		log.Fatal(usage)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func generate(file, alg string, force bool) error {
+	if _, err := os.Stat(file); err == nil && !force {
+		return fmt.Errorf("%s already exists, use rotate or -force", file)
+	}
+	ks, err := utils.NewKeySet(alg)
+	if err != nil {
+		return err
+	}
+	if err := ks.Save(file); err != nil {
+		return err
+	}
+	fmt.Printf("generated %s key %s in %s\n", alg, ks.ActiveKeyID, file)
+	return nil
+}
+
+func rotate(file, alg string, overlap time.Duration) error {
+	ks, err := utils.LoadKeySet(file)
+	if err != nil {
+		return err
+	}
+	key, err := ks.Rotate(alg, overlap)
+	if err != nil {
+		return err
+	}
+	if err := ks.Save(file); err != nil {
+		return err
+	}
+	fmt.Printf("rotated to %s key %s; send SIGHUP to running servers to reload\n", alg, key.KeyID)
+	return nil
+}
+
+func list(file string) error {
+	ks, err := utils.LoadKeySet(file)
+	if err != nil {
+		return err
+	}
+	for _, key := range ks.Keys {
+		status := "verify-only"
+		if key.KeyID == ks.ActiveKeyID {
+			status = "active"
+		}
+		retire := "-"
+		if key.RetireAt != nil {
+			retire = key.RetireAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%s\t%s\t%s\tcreated %s\tretires %s\n", key.KeyID, key.Algorithm, status, key.CreatedAt.Format(time.RFC3339), retire)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// Command roombench measures how long loading a room takes as the room
+// grows. For each size it seeds a room with that many participants, each
+// with an option, a vote and a few available dates, and times the room
+// state and dates queries with and without the service cache.
+//
+// It is an optional companion to the store benchmarks in internal/store,
+// reporting percentiles rather than averages. It only writes to a local
+// SQLite file that is new or empty, so it can never migrate or fill a real
+// database:
+//
+//	go run ./cmd/roombench -db /tmp/roombench.db -sizes 10,100,1000
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"websocket-chat/internal/models"
+	"websocket-chat/internal/service"
+	"websocket-chat/internal/store/storetest"
+)
+
+func main() {
+	log.SetFlags(0)
+	path := flag.String("db", "", "new or empty local SQLite file to seed")
+	sizes := flag.String("sizes", "10,100,1000", "comma-separated participant counts")
+	iterations := flag.Int("n", 20, "timed calls per measurement")
+	keep := flag.Bool("keep", false, "keep the file and its seeded rooms")
+	flag.Parse()
+
+	if *path == "" {
+		log.Fatal("roombench: -db is required")
+	}
+	if err := checkTarget(*path); err != nil {
+		log.Fatal(err)
+	}
+	if *iterations <= 0 {
+		log.Fatal("roombench: -n must be positive")
+	}
+	counts, err := parseSizes(*sizes)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	sqlStore, err := storetest.Open(ctx, *path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer sqlStore.DB.Close()
+	if !*keep {
+		defer os.Remove(*path)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "participants\toperation\tmin\tp50\tp95\tmax\t")
+	for _, count := range counts {
+		room, userIDs, err := storetest.SeedRoom(ctx, sqlStore, count, time.Now().UTC())
+		if err != nil {
+			log.Fatal(err)
+		}
+		actor := service.Actor{UserID: userIDs[0], RoomID: room.RoomID}
+
+		svc := service.New(sqlStore, nopNotifier{})
+		svc.SetCacheTTL(time.Hour)
+		measurements := []struct {
+			name string
+			call func() error
+		}{
+			{"GetFullRoomState", func() error { _, err := sqlStore.GetFullRoomState(ctx, room.RoomID); return err }},
+			{"GetDatesByRoomID", func() error { _, err := sqlStore.GetDatesByRoomID(ctx, room.RoomID); return err }},
+			{"Rooms.State cached", func() error { _, err := svc.Rooms.State(ctx, actor, room.RoomID); return err }},
+			{"Availability.Dates cached", func() error { _, err := svc.Availability.Dates(ctx, actor, room.RoomID); return err }},
+		}
+		for _, m := range measurements {
+			timings, err := measure(*iterations, m.call)
+			if err != nil {
+				log.Fatalf("%s with %d participants: %v", m.name, count, err)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t\n", count, m.name,
+				timings[0], percentile(timings, 0.5), percentile(timings, 0.95), timings[len(timings)-1])
+		}
+		w.Flush()
+	}
+}
+
+// checkTarget refuses anything but a local file that does not exist yet or
+// is empty, so a database URL or an existing database is never written to.
+func checkTarget(path string) error {
+	if strings.Contains(path, "://") || strings.HasPrefix(path, "file:") {
+		return fmt.Errorf("roombench: -db must be a local file path, got %q", path)
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("roombench: %w", err)
+	}
+	if !info.Mode().IsRegular() || info.Size() > 0 {
+		return fmt.Errorf("roombench: %s is not empty; pass a new file", path)
+	}
+	return nil
+}
+
+func parseSizes(s string) ([]int, error) {
+	var counts []int
+	for _, field := range strings.Split(s, ",") {
+		count, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("roombench: invalid size %q", field)
+		}
+		counts = append(counts, count)
+	}
+	return counts, nil
+}
+
+// measure calls fn n times and returns the durations, shortest first.
+func measure(n int, fn func() error) ([]time.Duration, error) {
+	timings := make([]time.Duration, 0, n)
+	for range n {
+		start := time.Now()
+		if err := fn(); err != nil {
+			return nil, err
+		}
+		timings = append(timings, time.Since(start).Round(time.Microsecond))
+	}
+	slices.Sort(timings)
+	return timings, nil
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	return sorted[int(p*float64(len(sorted)-1))]
+}
+
+// nopNotifier discards events; nothing is connected to the seeded rooms.
+type nopNotifier struct{}
+
+func (nopNotifier) Publish(context.Context, string, interface{})                           {}
+func (nopNotifier) RequestJoin(context.Context, string, models.User)                       {}
+func (nopNotifier) AvailabilityChanged(context.Context, string, models.AvailabilityChange) {}
+func (nopNotifier) Admit(string, string, bool)                                             {}
+func (nopNotifier) CloseSession(string)                                                    {}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"websocket-chat/internal/client"
+	"websocket-chat/internal/config"
+	"websocket-chat/internal/handlers"
+	"websocket-chat/internal/ratelimit"
+	"websocket-chat/internal/service"
+	"websocket-chat/internal/store/storetest"
+	"websocket-chat/internal/utils"
+	"websocket-chat/internal/websocket"
+)
+
+// newTestAPI serves the router on a SQLite file and returns a client for it.
+func newTestAPI(t *testing.T) *client.Client {
+	t.Helper()
+	cfg := config.Default()
+	if err := utils.ConfigureJWT(cfg.JWT); err != nil {
+		t.Fatal(err)
+	}
+	handlers.Configure(cfg)
+
+	sqlStore := storetest.New(t)
+	hub := websocket.NewHub()
+	svc := service.New(sqlStore, hub)
+	hub.SetServices(svc)
+	go hub.Run()
+	t.Cleanup(func() { hub.Shutdown(context.Background()) })
+
+	srv := httptest.NewServer(newRouter(server{
+		cfg:      cfg,
+		store:    sqlStore,
+		services: svc,
+		hub:      hub,
+		limiter:  ratelimit.NewMemoryLimiter(),
+	}))
+	t.Cleanup(srv.Close)
+	return client.New(srv.URL)
+}
+
+// TestAPIClient walks a room through the v1 routes with the generated
+// client, so the client, the OpenAPI document and the handlers agree on
+// paths, bodies and errors.
+func TestAPIClient(t *testing.T) {
+	ctx := context.Background()
+	api := newTestAPI(t)
+
+	room, err := api.CreateRoom(ctx, client.CreateRoomRequest{RoomName: "Planning"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := api.JoinRoom(ctx, room.ID, client.CreateUserWithOptionRequest{DisplayName: "Ana", OptionContent: "Friday"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatalf("join tokens = %+v, want access and refresh tokens", tokens)
+	}
+	api.Token = tokens.AccessToken
+
+	options, err := api.ListOptions(ctx, room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options) != 1 {
+		t.Fatalf("options = %+v, want the one added on joining", options)
+	}
+	if err := api.CastVote(ctx, room.ID, client.VoteRequest{OptionID: options[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := api.UpdateParticipant(ctx, room.ID, client.CreateUserWithOptionRequest{DisplayName: "Ana B."}); err != nil {
+		t.Fatal(err)
+	}
+	change, err := api.SetAvailability(ctx, room.ID, client.CreateAvailabilityRequest{Dates: []string{"2026-11-06"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(change.Added) != 1 || change.Added[0] != "2026-11-06" || len(change.Removed) != 0 {
+		t.Errorf("availability change = %+v, want 2026-11-06 added", change)
+	}
+
+	state, err := api.GetRoomState(ctx, room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.RoomName != "Planning" || len(state.Users) != 1 || state.Users[0].Name != "Ana B." || len(state.Votes) != 1 {
+		t.Errorf("room state = %+v, want Ana B. and her vote in Planning", state)
+	}
+
+	other, err := api.CreateRoom(ctx, client.CreateRoomRequest{RoomName: "Elsewhere"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = api.GetRoomState(ctx, other.ID)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != "forbidden" {
+		t.Errorf("state of another room: error = %v, want code forbidden", err)
+	}
+}
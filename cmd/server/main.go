@@ -1,59 +1,193 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/config"
 	"websocket-chat/internal/handlers"
+	"websocket-chat/internal/logging"
+	"websocket-chat/internal/mailer"
 	"websocket-chat/internal/middleware"
+	"websocket-chat/internal/openapi"
+	"websocket-chat/internal/ratelimit"
+	"websocket-chat/internal/service"
+	"websocket-chat/internal/sso"
+	"websocket-chat/internal/tracing"
 	"websocket-chat/internal/utils"
+	"websocket-chat/internal/validate"
 	"websocket-chat/internal/websocket"
+	"websocket-chat/internal/writebehind"
 
-	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	_ "github.com/tursodatabase/libsql-client-go/libsql"
 )
 
+// apiV1Since is when /api/v1 replaced the unversioned routes, sent in
+// their Deprecation header.
+var apiV1Since = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
 func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+
+	logger, err := logging.New(cfg.Log)
+	if err != nil {
+		fatal("Invalid logging configuration", err)
+	}
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("Tracing initialization failed", err)
+	}
+
+	if err := utils.ConfigureJWT(cfg.JWT); err != nil {
+		fatal("Failed to load signing keys", err)
+	}
+	handlers.Configure(cfg)
+	validate.Configure(cfg.Input)
 
-	sqlStore, err := utils.InitialiseDb()
+	sqlStore, err := utils.InitialiseDb(cfg.Database)
 	if err != nil {
-		log.Fatalf("Database initialization failed: %v", err)
+		fatal("Database initialization failed", err)
 	}
 	defer sqlStore.DB.Close()
 
-	hub := websocket.NewHub(sqlStore)
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		fatal("Mailer initialization failed", err)
+	}
+
+	limiter, err := ratelimit.New(cfg.RateLimit, sqlStore)
+	if err != nil {
+		fatal("Rate limiter initialization failed", err)
+	}
+
+	hub := websocket.NewHub()
+	hub.SetRateLimiter(limiter, cfg.RateLimit)
+	svc := service.New(sqlStore, hub)
+	svc.SetCacheTTL(cfg.Rooms.StateCacheTTL)
+	hub.SetServices(svc)
 	go hub.Run()
 
-	router := mux.NewRouter()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	router.HandleFunc("/userOption", handlers.CreateUserWithOption(hub, sqlStore)).Methods("POST")
-	router.HandleFunc("/rooms", handlers.CreateRoom(sqlStore)).Methods("POST")
-	router.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		handlers.ServeWS(hub, w, r)
+	var votes *writebehind.Buffer
+	if cfg.Rooms.WriteBehind {
+		votes, err = writebehind.Open(cfg.Rooms.WALDir, sqlStore, cfg.Rooms.FlushInterval, cfg.Rooms.FlushBatch)
+		if err != nil {
+			fatal("Write-behind vote log initialization failed", err)
+		}
+		slog.Info("Write-behind voting enabled", "dir", cfg.Rooms.WALDir, "recovered", votes.Len())
+		svc.SetVoteBuffer(votes)
+		go votes.Run(ctx)
+	}
+
+	revokedSince := syncRevocations(ctx, hub, sqlStore, time.Now().Add(-cfg.JWT.TokenTTL))
+	go watchRevocations(ctx, hub, sqlStore, revokedSince)
+
+	var provider *sso.Provider
+	if cfg.OIDC.Enabled() {
+		provider, err = sso.New(ctx, cfg.OIDC)
+		if err != nil {
+			fatal("OIDC initialization failed", err)
+		}
+	}
+
+	router := newRouter(server{
+		cfg:      cfg,
+		store:    sqlStore,
+		services: svc,
+		hub:      hub,
+		limiter:  limiter,
+		mail:     mail,
+		oidc:     provider,
 	})
 
-	protected := router.PathPrefix("/").Subrouter()
-	protected.Use(middleware.JWTAuthMiddleware)
-	protected.HandleFunc("/userOption", handlers.UpdateUserWithOption(hub, sqlStore)).Methods("PUT")
-	protected.HandleFunc("/userAvailability", handlers.CreateAvailability(sqlStore)).Methods("POST")
-	protected.HandleFunc("/roomState", handlers.GetRoomState(sqlStore)).Methods("GET")
-	protected.HandleFunc("/dates", handlers.GetDates(sqlStore)).Methods("GET")
+	var metricsSrv *http.Server
+	if cfg.Metrics.Enabled && cfg.Metrics.Addr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", promhttp.Handler())
+		metricsSrv = &http.Server{Addr: cfg.Metrics.Addr, Handler: metricsMux}
+		go func() {
+			slog.Info("Metrics server started", "addr", cfg.Metrics.Addr)
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal("Metrics server failed", err)
+			}
+		}()
+	}
 
-	corsRouter := enableCORS(router)
+	if err := openapi.CheckRoutes(router, "/debug", "/metrics"); err != nil {
+		fatal("Routes do not match the OpenAPI document", err)
+	}
+	if err := openapi.CheckEnum("ErrorResponse", "code", apierr.Codes()); err != nil {
+		fatal("Error codes do not match the OpenAPI document", err)
+	}
 
-	log.Println("Server started on :8080")
-	http.ListenAndServe(":8080", corsRouter)
-}
+	handler := middleware.RequestID(middleware.CORS(cfg.CORS)(router))
 
-func enableCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	srv := &http.Server{
+		Addr:     cfg.HTTP.Addr,
+		Handler:  handler,
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	}
 
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
+	go func() {
+		slog.Info("Server started", "addr", cfg.HTTP.Addr, "env", cfg.Env)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Server failed", err)
 		}
-		next.ServeHTTP(w, r)
-	})
+	}()
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := utils.ReloadKeys(); err != nil {
+				slog.Error("Failed to reload signing keys", "err", err)
+				continue
+			}
+			slog.Info("Reloaded signing keys")
+		}
+	}()
+
+	<-ctx.Done()
+	slog.Info("Shutting down server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("HTTP server shutdown failed", "err", err)
+	}
+	if metricsSrv != nil {
+		metricsSrv.Shutdown(shutdownCtx)
+	}
+	if err := hub.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Hub shutdown failed", "err", err)
+	}
+	if votes != nil {
+		if err := votes.Close(shutdownCtx); err != nil {
+			slog.Error("Failed to store queued votes; they stay in the write-behind log", "pending", votes.Len(), "err", err)
+		}
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("Failed to flush traces", "err", err)
+	}
+	slog.Info("Server stopped")
+}
+
+func fatal(message string, err error) {
+	slog.Error(message, "err", err)
+	os.Exit(1)
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"websocket-chat/internal/store"
+	"websocket-chat/internal/utils"
+	"websocket-chat/internal/websocket"
+)
+
+const revocationPollInterval = 30 * time.Second
+
+// watchRevocations keeps the in-memory revocation list in step with the
+// Sessions table so logouts on other instances take effect here too.
+func watchRevocations(ctx context.Context, hub *websocket.Hub, sqlStore *store.SQLStore, since time.Time) {
+	ticker := time.NewTicker(revocationPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			since = syncRevocations(ctx, hub, sqlStore, since)
+		}
+	}
+}
+
+func syncRevocations(ctx context.Context, hub *websocket.Hub, sqlStore *store.SQLStore, since time.Time) time.Time {
+	sessions, err := sqlStore.GetSessionsRevokedSince(ctx, since)
+	if err != nil {
+		slog.Error("Failed to load revoked sessions", "err", err)
+		return since
+	}
+
+	for _, session := range sessions {
+		if !utils.Revoked.Contains(session.SessionID) {
+			utils.Revoked.Add(session.SessionID, *session.RevokedAt)
+			hub.CloseSession(session.SessionID)
+		}
+		if session.RevokedAt.After(since) {
+			since = *session.RevokedAt
+		}
+	}
+	return since
+}
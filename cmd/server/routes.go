@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/config"
+	"websocket-chat/internal/handlers"
+	"websocket-chat/internal/mailer"
+	"websocket-chat/internal/middleware"
+	"websocket-chat/internal/openapi"
+	"websocket-chat/internal/ratelimit"
+	"websocket-chat/internal/service"
+	"websocket-chat/internal/sso"
+	"websocket-chat/internal/store"
+	"websocket-chat/internal/websocket"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// server is what the router's handlers are built from. oidc is nil when
+// OIDC login is disabled.
+type server struct {
+	cfg      *config.Config
+	store    *store.SQLStore
+	services *service.Services
+	hub      *websocket.Hub
+	limiter  ratelimit.Limiter
+	mail     mailer.Mailer
+	oidc     *sso.Provider
+}
+
+// newRouter builds the router for every route the configuration enables.
+func newRouter(s server) *mux.Router {
+	rl := s.cfg.RateLimit
+	clientIP := middleware.ClientIP(rl.ClientIPHeader, rl.TrustedProxies)
+	createRoomLimit := middleware.RateLimit(s.limiter, "create-room", rl.CreateRoom, clientIP)
+	joinIPLimit := middleware.RateLimit(s.limiter, "join-ip", rl.JoinPerIP, clientIP)
+	joinRoomLimit := middleware.RateLimit(s.limiter, "join-room", rl.JoinPerRoom, middleware.RoomKey)
+	authLimit := middleware.RateLimit(s.limiter, "auth", rl.Auth, clientIP)
+	wsConnectLimit := middleware.RateLimit(s.limiter, "ws-connect", rl.WSConnect, clientIP)
+	apiLimit := middleware.RateLimit(s.limiter, "api", rl.API, middleware.UserKey)
+
+	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierr.Respond(w, r, apierr.NotFound, "Not found")
+	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierr.Respond(w, r, apierr.MethodNotAllowed, "Method not allowed")
+	})
+	router.Use(middleware.Tracing, middleware.Metrics)
+
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.Handle("/rooms", createRoomLimit(handlers.CreateRoom(s.services.Rooms))).Methods("POST")
+	api.Handle("/rooms/{roomID}/users", joinIPLimit(joinRoomLimit(handlers.JoinRoom(s.services.Rooms, s.store)))).Methods("POST")
+	api.Handle("/auth/refresh", authLimit(handlers.RefreshToken(s.store))).Methods("POST")
+	api.Handle("/accounts", authLimit(handlers.Register(s.store))).Methods("POST")
+	api.Handle("/accounts/login", authLimit(handlers.Login(s.store))).Methods("POST")
+	api.Handle("/accounts/magic-link", authLimit(handlers.RequestMagicLink(s.store, s.mail))).Methods("POST")
+	api.Handle("/accounts/magic-link/verify", authLimit(handlers.VerifyMagicLink(s.store))).Methods("POST")
+
+	apiAccount := api.PathPrefix("/me").Subrouter()
+	apiAccount.Use(middleware.JWTAuthMiddleware, middleware.RequireAccount, apiLimit)
+	apiAccount.HandleFunc("/rooms", handlers.GetMyRooms(s.store)).Methods("GET")
+	apiAccount.HandleFunc("/rooms/claim", handlers.ClaimRoomIdentity(s.store)).Methods("POST")
+	apiAccount.HandleFunc("/rooms/{roomID}/token", handlers.CreateRoomToken(s.store)).Methods("POST")
+
+	apiProtected := api.NewRoute().Subrouter()
+	apiProtected.Use(middleware.JWTAuthMiddleware, apiLimit)
+	apiProtected.HandleFunc("/auth/logout", handlers.Logout(s.hub, s.store)).Methods("POST")
+	apiProtected.HandleFunc("/rooms/{roomID}", handlers.GetRoomState(s.services.Rooms)).Methods("GET")
+	apiProtected.HandleFunc("/rooms/{roomID}", handlers.DeleteRoom(s.services.Rooms)).Methods("DELETE")
+	apiProtected.HandleFunc("/rooms/{roomID}/users", handlers.ListUsers(s.services.Rooms)).Methods("GET")
+	apiProtected.HandleFunc("/rooms/{roomID}/users/me", handlers.UpdateParticipant(s.services.Rooms)).Methods("PUT")
+	apiProtected.HandleFunc("/rooms/{roomID}/users/me", handlers.LeaveRoom(s.services.Rooms)).Methods("DELETE")
+	apiProtected.HandleFunc("/rooms/{roomID}/options", handlers.ListOptions(s.services.Voting)).Methods("GET")
+	apiProtected.HandleFunc("/rooms/{roomID}/options", handlers.AddOption(s.services.Voting)).Methods("POST")
+	apiProtected.HandleFunc("/rooms/{roomID}/options/{optionID}", handlers.GetOption(s.services.Voting)).Methods("GET")
+	apiProtected.HandleFunc("/rooms/{roomID}/options/{optionID}", handlers.EditOption(s.services.Voting)).Methods("PUT")
+	apiProtected.HandleFunc("/rooms/{roomID}/options/{optionID}", handlers.DeleteOption(s.services.Voting)).Methods("DELETE")
+	apiProtected.HandleFunc("/rooms/{roomID}/votes", handlers.ListVotes(s.services.Voting)).Methods("GET")
+	apiProtected.HandleFunc("/rooms/{roomID}/votes/me", handlers.CastVote(s.services.Voting)).Methods("PUT")
+	apiProtected.HandleFunc("/rooms/{roomID}/votes/me", handlers.RetractVote(s.services.Voting)).Methods("DELETE")
+	apiProtected.HandleFunc("/rooms/{roomID}/votes/{voteID}", handlers.GetVote(s.services.Voting)).Methods("GET")
+	apiProtected.HandleFunc("/rooms/{roomID}/reveal", handlers.RevealVotes(s.services.Voting)).Methods("POST")
+	apiProtected.HandleFunc("/rooms/{roomID}/availability", handlers.GetDates(s.services.Availability)).Methods("GET")
+	apiProtected.HandleFunc("/rooms/{roomID}/availability", handlers.ReplaceAvailability(s.services.Availability)).Methods("PUT")
+	apiProtected.HandleFunc("/rooms/{roomID}/policy", handlers.GetRoomPolicy(s.services.Rooms)).Methods("GET")
+	apiProtected.HandleFunc("/rooms/{roomID}/policy", handlers.UpdateRoomPolicy(s.services.Rooms)).Methods("PUT")
+	apiProtected.HandleFunc("/rooms/{roomID}/invites", handlers.CreateRoomInvite(s.services.Rooms)).Methods("POST")
+	apiProtected.HandleFunc("/rooms/{roomID}/join-requests", handlers.GetJoinRequests(s.services.Rooms)).Methods("GET")
+	apiProtected.HandleFunc("/rooms/{roomID}/join-requests/{userID}/approve", handlers.DecideJoinRequest(s.services.Rooms, true)).Methods("POST")
+	apiProtected.HandleFunc("/rooms/{roomID}/join-requests/{userID}/deny", handlers.DecideJoinRequest(s.services.Rooms, false)).Methods("POST")
+
+	router.HandleFunc("/.well-known/jwks.json", handlers.GetJWKS()).Methods("GET")
+	router.HandleFunc("/healthz", handlers.Healthz()).Methods("GET")
+	router.HandleFunc("/readyz", handlers.Readyz(s.hub, s.store)).Methods("GET")
+	router.HandleFunc("/openapi.json", openapi.Handler()).Methods("GET")
+	router.Handle("/ws", wsConnectLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeWS(s.hub, s.services.Rooms, w, r)
+	})))
+
+	if s.oidc != nil {
+		router.Handle("/auth/oidc/login", authLimit(handlers.OIDCLogin(s.oidc))).Methods("GET")
+		router.Handle("/auth/oidc/callback", authLimit(handlers.OIDCCallback(s.oidc, s.store))).Methods("GET")
+	}
+
+	if s.cfg.Debug.Token != "" {
+		debug := router.PathPrefix("/debug").Subrouter()
+		debug.Use(middleware.RequireDebugToken(s.cfg.Debug.Token))
+		debug.HandleFunc("/rooms", handlers.DebugRooms(s.hub)).Methods("GET")
+		if s.cfg.Debug.Pprof {
+			debug.HandleFunc("/pprof/cmdline", pprof.Cmdline)
+			debug.HandleFunc("/pprof/profile", pprof.Profile)
+			debug.HandleFunc("/pprof/symbol", pprof.Symbol)
+			debug.HandleFunc("/pprof/trace", pprof.Trace)
+			debug.PathPrefix("/pprof/").HandlerFunc(pprof.Index)
+		}
+	}
+
+	// The routes from before /api/v1 stay for the existing frontend. They
+	// take the room ID from the body or query and announce their successor.
+	if s.cfg.HTTP.LegacyRoutes {
+		deprecated := func(successor string, h http.Handler) http.Handler {
+			return middleware.Deprecated(successor, apiV1Since, s.cfg.HTTP.LegacySunset)(h)
+		}
+		router.Handle("/userOption", deprecated("/api/v1/rooms/{roomID}/users", joinIPLimit(joinRoomLimit(handlers.CreateUserWithOption(s.services.Rooms, s.store))))).Methods("POST")
+		router.Handle("/rooms", deprecated("/api/v1/rooms", createRoomLimit(handlers.CreateRoom(s.services.Rooms)))).Methods("POST")
+		router.Handle("/auth/refresh", deprecated("/api/v1/auth/refresh", authLimit(handlers.RefreshToken(s.store)))).Methods("POST")
+		router.Handle("/accounts", deprecated("/api/v1/accounts", authLimit(handlers.Register(s.store)))).Methods("POST")
+		router.Handle("/accounts/login", deprecated("/api/v1/accounts/login", authLimit(handlers.Login(s.store)))).Methods("POST")
+		router.Handle("/accounts/magic-link", deprecated("/api/v1/accounts/magic-link", authLimit(handlers.RequestMagicLink(s.store, s.mail)))).Methods("POST")
+		router.Handle("/accounts/magic-link/verify", deprecated("/api/v1/accounts/magic-link/verify", authLimit(handlers.VerifyMagicLink(s.store)))).Methods("POST")
+
+		account := router.PathPrefix("/me").Subrouter()
+		account.Use(middleware.JWTAuthMiddleware, middleware.RequireAccount, apiLimit)
+		account.Handle("/rooms", deprecated("/api/v1/me/rooms", handlers.GetMyRooms(s.store))).Methods("GET")
+		account.Handle("/rooms/claim", deprecated("/api/v1/me/rooms/claim", handlers.ClaimRoomIdentity(s.store))).Methods("POST")
+		account.Handle("/rooms/{roomID}/token", deprecated("/api/v1/me/rooms/{roomID}/token", handlers.CreateRoomToken(s.store))).Methods("POST")
+
+		protected := router.PathPrefix("/").Subrouter()
+		protected.Use(middleware.JWTAuthMiddleware, apiLimit)
+		protected.Handle("/auth/logout", deprecated("/api/v1/auth/logout", handlers.Logout(s.hub, s.store))).Methods("POST")
+		protected.Handle("/userOption", deprecated("/api/v1/rooms/{roomID}/users/me", handlers.UpdateUserWithOption(s.services.Rooms))).Methods("PUT")
+		protected.Handle("/userAvailability", deprecated("/api/v1/rooms/{roomID}/availability", handlers.CreateAvailability(s.services.Availability))).Methods("POST")
+		protected.Handle("/roomState", deprecated("/api/v1/rooms/{roomID}", handlers.GetRoomState(s.services.Rooms))).Methods("GET")
+		protected.Handle("/dates", deprecated("/api/v1/rooms/{roomID}/availability", handlers.GetDates(s.services.Availability))).Methods("GET")
+		protected.Handle("/roomPolicy", deprecated("/api/v1/rooms/{roomID}/policy", handlers.GetRoomPolicy(s.services.Rooms))).Methods("GET")
+		protected.Handle("/roomPolicy", deprecated("/api/v1/rooms/{roomID}/policy", handlers.UpdateRoomPolicy(s.services.Rooms))).Methods("PUT")
+		protected.Handle("/roomInvites", deprecated("/api/v1/rooms/{roomID}/invites", handlers.CreateRoomInvite(s.services.Rooms))).Methods("POST")
+		protected.Handle("/joinRequests", deprecated("/api/v1/rooms/{roomID}/join-requests", handlers.GetJoinRequests(s.services.Rooms))).Methods("GET")
+	}
+
+	if s.cfg.Metrics.Enabled && s.cfg.Metrics.Addr == "" {
+		router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	}
+	return router
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"websocket-chat/internal/config"
+	"websocket-chat/internal/openapi"
+	"websocket-chat/internal/ratelimit"
+	"websocket-chat/internal/service"
+	"websocket-chat/internal/sso"
+	"websocket-chat/internal/store"
+	"websocket-chat/internal/websocket"
+)
+
+// TestRoutesMatchOpenAPI builds the router for each optional set of routes
+// and checks the OpenAPI document describes exactly what it serves.
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(cfg *config.Config, s *server)
+	}{
+		{"defaults", func(*config.Config, *server) {}},
+		{"without legacy routes", func(cfg *config.Config, _ *server) {
+			cfg.HTTP.LegacyRoutes = false
+		}},
+		{"with OIDC", func(_ *config.Config, s *server) {
+			s.oidc = &sso.Provider{}
+		}},
+		{"with debug and metrics on the main listener", func(cfg *config.Config, _ *server) {
+			cfg.Debug.Token = "token"
+			cfg.Debug.Pprof = true
+			cfg.Metrics.Addr = ""
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			sqlStore := store.NewSQLStore(nil)
+			hub := websocket.NewHub()
+			s := server{
+				cfg:      cfg,
+				store:    sqlStore,
+				services: service.New(sqlStore, hub),
+				hub:      hub,
+				limiter:  ratelimit.NewMemoryLimiter(),
+			}
+			tt.configure(cfg, &s)
+
+			if err := openapi.CheckRoutes(newRouter(s), "/debug", "/metrics"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+// Command wsprotocol writes the AsyncAPI document describing the WebSocket
+// protocol, derived from the message types in internal/websocket. It is run
+// by go generate in that package.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	ws "websocket-chat/internal/websocket"
+)
+
+func main() {
+	out := flag.String("o", "asyncapi.json", "output file, or - for stdout")
+	flag.Parse()
+
+	doc, err := json.MarshalIndent(ws.Protocol(), "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	doc = append(doc, '\n')
+
+	if *out == "-" {
+		os.Stdout.Write(doc)
+		return
+	}
+	if err := os.WriteFile(*out, doc, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,193 @@
+// Package apierr defines the errors the API reports to clients: a stable,
+// machine-readable code and a message safe to show. HTTP handlers write them
+// as a JSON envelope and the WebSocket protocol sends the same code and
+// message in its error frames.
+package apierr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"websocket-chat/internal/authz"
+	"websocket-chat/internal/logging"
+	"websocket-chat/internal/store"
+	"websocket-chat/internal/utils"
+)
+
+type Code string
+
+const (
+	InvalidBody         Code = "invalid_body"
+	ValidationFailed    Code = "validation_failed"
+	Unauthorized        Code = "unauthorized"
+	Forbidden           Code = "forbidden"
+	PendingApproval     Code = "pending_approval"
+	NotFound            Code = "not_found"
+	MethodNotAllowed    Code = "method_not_allowed"
+	RoomNotFound        Code = "room_not_found"
+	UserNotFound        Code = "user_not_found"
+	OptionNotFound      Code = "option_not_found"
+	JoinRequestNotFound Code = "join_request_not_found"
+	Conflict            Code = "conflict"
+	RoomFull            Code = "room_full"
+	RateLimited         Code = "rate_limited"
+	Internal            Code = "internal"
+	Unavailable         Code = "unavailable"
+
+	// WebSocket protocol errors.
+	InvalidMessage     Code = "invalid_message"
+	UnknownType        Code = "unknown_type"
+	UnsupportedVersion Code = "unsupported_version"
+)
+
+var statuses = map[Code]int{
+	InvalidBody:         http.StatusBadRequest,
+	ValidationFailed:    http.StatusBadRequest,
+	Unauthorized:        http.StatusUnauthorized,
+	Forbidden:           http.StatusForbidden,
+	PendingApproval:     http.StatusForbidden,
+	NotFound:            http.StatusNotFound,
+	MethodNotAllowed:    http.StatusMethodNotAllowed,
+	RoomNotFound:        http.StatusNotFound,
+	UserNotFound:        http.StatusNotFound,
+	OptionNotFound:      http.StatusNotFound,
+	JoinRequestNotFound: http.StatusNotFound,
+	Conflict:            http.StatusConflict,
+	RoomFull:            http.StatusConflict,
+	RateLimited:         http.StatusTooManyRequests,
+	Internal:            http.StatusInternalServerError,
+	Unavailable:         http.StatusServiceUnavailable,
+	InvalidMessage:      http.StatusBadRequest,
+	UnknownType:         http.StatusBadRequest,
+	UnsupportedVersion:  http.StatusBadRequest,
+}
+
+// Codes lists every code, for documents that enumerate them.
+func Codes() []string {
+	return []string{
+		string(InvalidBody), string(ValidationFailed), string(Unauthorized), string(Forbidden),
+		string(PendingApproval), string(NotFound), string(MethodNotAllowed),
+		string(RoomNotFound), string(UserNotFound), string(OptionNotFound),
+		string(JoinRequestNotFound), string(Conflict), string(RoomFull), string(RateLimited),
+		string(Internal), string(Unavailable), string(InvalidMessage), string(UnknownType),
+		string(UnsupportedVersion),
+	}
+}
+
+// sentinels maps errors from the lower layers onto the codes clients see.
+var sentinels = []struct {
+	err     error
+	code    Code
+	message string
+}{
+	{store.ErrRoomNotFound, RoomNotFound, "Room not found"},
+	{store.ErrUserNotFound, UserNotFound, "User not found"},
+	{store.ErrOptionNotFound, OptionNotFound, "Option not found"},
+	{store.ErrJoinRequestNotFound, JoinRequestNotFound, "Join request not found"},
+	{store.ErrVoteNotFound, NotFound, "Vote not found"},
+	{store.ErrSessionNotFound, NotFound, "Session not found"},
+	{store.ErrAccountNotFound, NotFound, "Account not found"},
+	{store.ErrMagicLinkNotFound, NotFound, "Magic link not found"},
+	{store.ErrIdentityNotFound, NotFound, "Identity not found"},
+	{store.ErrRoomFull, RoomFull, "Room is full"},
+	{authz.ErrForbidden, Forbidden, authz.ErrForbidden.Error()},
+	{authz.ErrPendingApproval, PendingApproval, authz.ErrPendingApproval.Error()},
+	{utils.ErrSessionRevoked, Unauthorized, "Session revoked"},
+}
+
+// Error is both the error value handlers return and the JSON body they
+// write. The cause is logged but never sent.
+type Error struct {
+	Code      Code         `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+
+	cause error
+}
+
+// FieldError describes one invalid field. Field is the JSON name, with an
+// index for array elements: dates[2].
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func Errorf(code Code, format string, args ...interface{}) *Error {
+	return New(code, fmt.Sprintf(format, args...))
+}
+
+// Invalid reports invalid fields as validation_failed. A single problem
+// becomes the message; several are summarised and listed in Details.
+func Invalid(details ...FieldError) *Error {
+	message := "Request has invalid fields"
+	if len(details) == 1 {
+		message = details[0].Field + " " + details[0].Message
+	}
+	return &Error{Code: ValidationFailed, Message: message, Details: details}
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+func (e *Error) Status() int {
+	if status, ok := statuses[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Wrap classifies err: an *Error is returned as is, a known sentinel such
+// as store.ErrRoomNotFound becomes its code, and anything else becomes an
+// internal error reported with message.
+func Wrap(err error, message string) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	for _, s := range sentinels {
+		if errors.Is(err, s.err) {
+			return &Error{Code: s.code, Message: s.message, cause: err}
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &Error{Code: Unavailable, Message: message, cause: err}
+	}
+	return &Error{Code: Internal, Message: message, cause: err}
+}
+
+// Write answers with err's JSON envelope, logging server-side failures with
+// their cause. The request ID is taken from the response header set by the
+// request ID middleware.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	e := *Wrap(err, "Internal error")
+	status := e.Status()
+	if status >= http.StatusInternalServerError {
+		logging.FromContext(r.Context()).Error(e.Message, "code", e.Code, "err", e.cause)
+	}
+	e.RequestID = w.Header().Get("X-Request-ID")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
+
+// Respond writes a new error with the given code and message.
+func Respond(w http.ResponseWriter, r *http.Request, code Code, message string) {
+	Write(w, r, New(code, message))
+}
@@ -0,0 +1,17 @@
+package authz
+
+import "errors"
+
+var (
+	ErrForbidden       = errors.New("access to this room is forbidden")
+	ErrPendingApproval = errors.New("waiting for the host to approve your join request")
+)
+
+// AuthorizeRoom is the single place that decides whether a caller whose
+// identity is bound to memberRoomID may operate on roomID.
+func AuthorizeRoom(memberRoomID, roomID string) error {
+	if memberRoomID == "" || memberRoomID != roomID {
+		return ErrForbidden
+	}
+	return nil
+}
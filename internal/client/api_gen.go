@@ -0,0 +1,500 @@
+// Code generated by apigen from internal/openapi/openapi.json. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+type AccountCredentialsRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type AccountRoom struct {
+	DisplayName string `json:"displayName"`
+	RoomID      string `json:"roomId"`
+	RoomName    string `json:"roomName"`
+	UserID      string `json:"userId"`
+}
+
+// AvailabilityChange: Dates a replacement added to and removed from a participant's availability
+type AvailabilityChange struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	UserID  string   `json:"userID"`
+}
+
+type ClaimRoomRequest struct {
+	Token string `json:"token"`
+}
+
+type CreateAvailabilityRequest struct {
+	Dates  []string `json:"dates"`
+	RoomID string   `json:"roomID,omitempty"`
+}
+
+type CreateRoomInviteRequest struct {
+	ExpiresIn int    `json:"expiresIn,omitempty"`
+	RoomID    string `json:"roomID,omitempty"`
+}
+
+// CreateRoomRequest: Names, display names and options are NFC-normalised, stripped of control characters and, by default, HTML tags, and have whitespace collapsed before their configured length limits are checked.
+type CreateRoomRequest struct {
+	RoomName string `json:"roomName"`
+}
+
+type CreateUserWithOptionRequest struct {
+	DisplayName   string `json:"displayName"`
+	InviteToken   string `json:"inviteToken,omitempty"`
+	OptionContent string `json:"optionContent,omitempty"`
+	Passcode      string `json:"passcode,omitempty"`
+	RoomID        string `json:"roomID,omitempty"`
+}
+
+type DateWithUsers struct {
+	Date  string `json:"date"`
+	Users []User `json:"users"`
+}
+
+// ErrorResponse: Every error response, and the code and message of WebSocket error frames
+type ErrorResponse struct {
+	// One of invalid_body, validation_failed, unauthorized, forbidden, pending_approval, not_found, method_not_allowed, room_not_found, user_not_found, option_not_found, join_request_not_found, conflict, room_full, rate_limited, internal, unavailable, invalid_message, unknown_type, unsupported_version.
+	Code      string       `json:"code"`
+	Details   []FieldError `json:"details,omitempty"`
+	Message   string       `json:"message"`
+	RequestID string       `json:"requestId,omitempty"`
+}
+
+// FieldError: One invalid field of a validation_failed or invalid_message error
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+type InviteResponse struct {
+	ExpiresAt time.Time `json:"expiresAt"`
+	Token     string    `json:"token"`
+	URL       string    `json:"url"`
+}
+
+type JoinRequest struct {
+	DisplayName string `json:"displayName"`
+	RoomID      string `json:"roomId"`
+	// One of pending, approved, denied.
+	Status string `json:"status"`
+	UserID string `json:"userId"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+type Option struct {
+	Content string `json:"content"`
+	ID      string `json:"id"`
+	RoomID  string `json:"roomId"`
+	UserID  string `json:"userId"`
+}
+
+type OptionRequest struct {
+	Content string `json:"content"`
+}
+
+type ReadinessResponse struct {
+	Checks map[string]string `json:"checks"`
+	// One of ok, unavailable.
+	Status string `json:"status"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+type Room struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type RoomDates struct {
+	Dates  []DateWithUsers `json:"dates"`
+	RoomID string          `json:"roomId"`
+}
+
+type RoomPolicy struct {
+	HasPasscode     bool   `json:"hasPasscode"`
+	HostUserID      string `json:"hostUserId"`
+	InviteOnly      bool   `json:"inviteOnly"`
+	MaxParticipants int    `json:"maxParticipants"`
+	RequireApproval bool   `json:"requireApproval"`
+	RoomID          string `json:"roomId"`
+}
+
+type RoomState struct {
+	Options     []Option `json:"options"`
+	RevealVotes bool     `json:"revealVotes"`
+	RoomName    string   `json:"roomName"`
+	Users       []User   `json:"users"`
+	Votes       []Vote   `json:"votes"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	ExpiresIn    int    `json:"expiresIn"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// UpdateRoomPolicyRequest: Only the fields present are changed. An empty passcode removes it.
+type UpdateRoomPolicyRequest struct {
+	InviteOnly      *bool   `json:"inviteOnly,omitempty"`
+	MaxParticipants *int    `json:"maxParticipants,omitempty"`
+	Passcode        *string `json:"passcode,omitempty"`
+	RequireApproval *bool   `json:"requireApproval,omitempty"`
+	RoomID          string  `json:"roomID,omitempty"`
+}
+
+type User struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	RoomID string `json:"roomId"`
+}
+
+type VerifyMagicLinkRequest struct {
+	Token string `json:"token"`
+}
+
+type Vote struct {
+	ID       string `json:"id"`
+	OptionID string `json:"optionId"`
+	UserID   string `json:"userId"`
+}
+
+type VoteRequest struct {
+	OptionID string `json:"optionID"`
+}
+
+// GetJWKS calls GET /.well-known/jwks.json. Public keys for verifying access tokens.
+func (c *Client) GetJWKS(ctx context.Context) (map[string]interface{}, error) {
+	var out map[string]interface{}
+	if err := c.do(ctx, "GET", "/.well-known/jwks.json", nil, nil, &out); err != nil {
+		var zero map[string]interface{}
+		return zero, err
+	}
+	return out, nil
+}
+
+// Register calls POST /api/v1/accounts. Create an account.
+func (c *Client) Register(ctx context.Context, body AccountCredentialsRequest) (*TokenResponse, error) {
+	var out TokenResponse
+	if err := c.do(ctx, "POST", "/api/v1/accounts", nil, body, &out); err != nil {
+		var zero *TokenResponse
+		return zero, err
+	}
+	return &out, nil
+}
+
+// Login calls POST /api/v1/accounts/login. Log in with email and password.
+func (c *Client) Login(ctx context.Context, body AccountCredentialsRequest) (*TokenResponse, error) {
+	var out TokenResponse
+	if err := c.do(ctx, "POST", "/api/v1/accounts/login", nil, body, &out); err != nil {
+		var zero *TokenResponse
+		return zero, err
+	}
+	return &out, nil
+}
+
+// RequestMagicLink calls POST /api/v1/accounts/magic-link. Email a one-time login link.
+func (c *Client) RequestMagicLink(ctx context.Context, body MagicLinkRequest) error {
+	return c.do(ctx, "POST", "/api/v1/accounts/magic-link", nil, body, nil)
+}
+
+// VerifyMagicLink calls POST /api/v1/accounts/magic-link/verify. Log in with a magic link token.
+func (c *Client) VerifyMagicLink(ctx context.Context, body VerifyMagicLinkRequest) (*TokenResponse, error) {
+	var out TokenResponse
+	if err := c.do(ctx, "POST", "/api/v1/accounts/magic-link/verify", nil, body, &out); err != nil {
+		var zero *TokenResponse
+		return zero, err
+	}
+	return &out, nil
+}
+
+// Logout calls POST /api/v1/auth/logout. Revoke the caller's session.
+func (c *Client) Logout(ctx context.Context) error {
+	return c.do(ctx, "POST", "/api/v1/auth/logout", nil, nil, nil)
+}
+
+// RefreshToken calls POST /api/v1/auth/refresh. Exchange a refresh token for new tokens.
+func (c *Client) RefreshToken(ctx context.Context, body RefreshTokenRequest) (*TokenResponse, error) {
+	var out TokenResponse
+	if err := c.do(ctx, "POST", "/api/v1/auth/refresh", nil, body, &out); err != nil {
+		var zero *TokenResponse
+		return zero, err
+	}
+	return &out, nil
+}
+
+// GetMyRooms calls GET /api/v1/me/rooms. Rooms the account has joined.
+func (c *Client) GetMyRooms(ctx context.Context) ([]AccountRoom, error) {
+	var out []AccountRoom
+	if err := c.do(ctx, "GET", "/api/v1/me/rooms", nil, nil, &out); err != nil {
+		var zero []AccountRoom
+		return zero, err
+	}
+	return out, nil
+}
+
+// ClaimRoomIdentity calls POST /api/v1/me/rooms/claim. Attach an anonymous room identity to the account.
+func (c *Client) ClaimRoomIdentity(ctx context.Context, body ClaimRoomRequest) error {
+	return c.do(ctx, "POST", "/api/v1/me/rooms/claim", nil, body, nil)
+}
+
+// CreateRoomToken calls POST /api/v1/me/rooms/{roomID}/token. Issue a room token for the account's identity in a room.
+func (c *Client) CreateRoomToken(ctx context.Context, roomID string) (*TokenResponse, error) {
+	var out TokenResponse
+	if err := c.do(ctx, "POST", "/api/v1/me/rooms/"+url.PathEscape(roomID)+"/token", nil, nil, &out); err != nil {
+		var zero *TokenResponse
+		return zero, err
+	}
+	return &out, nil
+}
+
+// CreateRoom calls POST /api/v1/rooms. Create a room.
+func (c *Client) CreateRoom(ctx context.Context, body CreateRoomRequest) (*Room, error) {
+	var out Room
+	if err := c.do(ctx, "POST", "/api/v1/rooms", nil, body, &out); err != nil {
+		var zero *Room
+		return zero, err
+	}
+	return &out, nil
+}
+
+// DeleteRoom calls DELETE /api/v1/rooms/{roomID}. Delete the room and disconnect everyone in it (host only).
+func (c *Client) DeleteRoom(ctx context.Context, roomID string) error {
+	return c.do(ctx, "DELETE", "/api/v1/rooms/"+url.PathEscape(roomID), nil, nil, nil)
+}
+
+// GetRoomState calls GET /api/v1/rooms/{roomID}. Participants, options and votes in a room.
+func (c *Client) GetRoomState(ctx context.Context, roomID string) (*RoomState, error) {
+	var out RoomState
+	if err := c.do(ctx, "GET", "/api/v1/rooms/"+url.PathEscape(roomID), nil, nil, &out); err != nil {
+		var zero *RoomState
+		return zero, err
+	}
+	return &out, nil
+}
+
+// GetDates calls GET /api/v1/rooms/{roomID}/availability. Dates in a room and who is available on each.
+func (c *Client) GetDates(ctx context.Context, roomID string) (*RoomDates, error) {
+	var out RoomDates
+	if err := c.do(ctx, "GET", "/api/v1/rooms/"+url.PathEscape(roomID)+"/availability", nil, nil, &out); err != nil {
+		var zero *RoomDates
+		return zero, err
+	}
+	return &out, nil
+}
+
+// SetAvailability calls PUT /api/v1/rooms/{roomID}/availability. Replace the caller's available dates.
+func (c *Client) SetAvailability(ctx context.Context, roomID string, body CreateAvailabilityRequest) (*AvailabilityChange, error) {
+	var out AvailabilityChange
+	if err := c.do(ctx, "PUT", "/api/v1/rooms/"+url.PathEscape(roomID)+"/availability", nil, body, &out); err != nil {
+		var zero *AvailabilityChange
+		return zero, err
+	}
+	return &out, nil
+}
+
+// CreateRoomInvite calls POST /api/v1/rooms/{roomID}/invites. Create an expiring invite link (host only).
+func (c *Client) CreateRoomInvite(ctx context.Context, roomID string, body CreateRoomInviteRequest) (*InviteResponse, error) {
+	var out InviteResponse
+	if err := c.do(ctx, "POST", "/api/v1/rooms/"+url.PathEscape(roomID)+"/invites", nil, body, &out); err != nil {
+		var zero *InviteResponse
+		return zero, err
+	}
+	return &out, nil
+}
+
+// GetJoinRequests calls GET /api/v1/rooms/{roomID}/join-requests. Participants waiting for approval (host only).
+func (c *Client) GetJoinRequests(ctx context.Context, roomID string) ([]JoinRequest, error) {
+	var out []JoinRequest
+	if err := c.do(ctx, "GET", "/api/v1/rooms/"+url.PathEscape(roomID)+"/join-requests", nil, nil, &out); err != nil {
+		var zero []JoinRequest
+		return zero, err
+	}
+	return out, nil
+}
+
+// ApproveJoinRequest calls POST /api/v1/rooms/{roomID}/join-requests/{userID}/approve. Let a user waiting in the lobby into the room (host only).
+func (c *Client) ApproveJoinRequest(ctx context.Context, roomID string, userID string) error {
+	return c.do(ctx, "POST", "/api/v1/rooms/"+url.PathEscape(roomID)+"/join-requests/"+url.PathEscape(userID)+"/approve", nil, nil, nil)
+}
+
+// DenyJoinRequest calls POST /api/v1/rooms/{roomID}/join-requests/{userID}/deny. Refuse a user waiting in the lobby (host only).
+func (c *Client) DenyJoinRequest(ctx context.Context, roomID string, userID string) error {
+	return c.do(ctx, "POST", "/api/v1/rooms/"+url.PathEscape(roomID)+"/join-requests/"+url.PathEscape(userID)+"/deny", nil, nil, nil)
+}
+
+// ListOptions calls GET /api/v1/rooms/{roomID}/options. Options in a room.
+func (c *Client) ListOptions(ctx context.Context, roomID string) ([]Option, error) {
+	var out []Option
+	if err := c.do(ctx, "GET", "/api/v1/rooms/"+url.PathEscape(roomID)+"/options", nil, nil, &out); err != nil {
+		var zero []Option
+		return zero, err
+	}
+	return out, nil
+}
+
+// AddOption calls POST /api/v1/rooms/{roomID}/options. Set the caller's option, replacing any they added before.
+func (c *Client) AddOption(ctx context.Context, roomID string, body OptionRequest) (*Option, error) {
+	var out Option
+	if err := c.do(ctx, "POST", "/api/v1/rooms/"+url.PathEscape(roomID)+"/options", nil, body, &out); err != nil {
+		var zero *Option
+		return zero, err
+	}
+	return &out, nil
+}
+
+// DeleteOption calls DELETE /api/v1/rooms/{roomID}/options/{optionID}. Delete an option and its votes (its author or the host).
+func (c *Client) DeleteOption(ctx context.Context, roomID string, optionID string) error {
+	return c.do(ctx, "DELETE", "/api/v1/rooms/"+url.PathEscape(roomID)+"/options/"+url.PathEscape(optionID), nil, nil, nil)
+}
+
+// GetOption calls GET /api/v1/rooms/{roomID}/options/{optionID}. An option in the room.
+func (c *Client) GetOption(ctx context.Context, roomID string, optionID string) (*Option, error) {
+	var out Option
+	if err := c.do(ctx, "GET", "/api/v1/rooms/"+url.PathEscape(roomID)+"/options/"+url.PathEscape(optionID), nil, nil, &out); err != nil {
+		var zero *Option
+		return zero, err
+	}
+	return &out, nil
+}
+
+// EditOption calls PUT /api/v1/rooms/{roomID}/options/{optionID}. Change an option's text (its author or the host).
+func (c *Client) EditOption(ctx context.Context, roomID string, optionID string, body OptionRequest) (*Option, error) {
+	var out Option
+	if err := c.do(ctx, "PUT", "/api/v1/rooms/"+url.PathEscape(roomID)+"/options/"+url.PathEscape(optionID), nil, body, &out); err != nil {
+		var zero *Option
+		return zero, err
+	}
+	return &out, nil
+}
+
+// GetRoomPolicy calls GET /api/v1/rooms/{roomID}/policy. Join rules of a room.
+func (c *Client) GetRoomPolicy(ctx context.Context, roomID string) (*RoomPolicy, error) {
+	var out RoomPolicy
+	if err := c.do(ctx, "GET", "/api/v1/rooms/"+url.PathEscape(roomID)+"/policy", nil, nil, &out); err != nil {
+		var zero *RoomPolicy
+		return zero, err
+	}
+	return &out, nil
+}
+
+// UpdateRoomPolicy calls PUT /api/v1/rooms/{roomID}/policy. Change the join rules of a room (host only).
+func (c *Client) UpdateRoomPolicy(ctx context.Context, roomID string, body UpdateRoomPolicyRequest) (*RoomPolicy, error) {
+	var out RoomPolicy
+	if err := c.do(ctx, "PUT", "/api/v1/rooms/"+url.PathEscape(roomID)+"/policy", nil, body, &out); err != nil {
+		var zero *RoomPolicy
+		return zero, err
+	}
+	return &out, nil
+}
+
+// RevealVotes calls POST /api/v1/rooms/{roomID}/reveal. Broadcast the room state with votes revealed.
+func (c *Client) RevealVotes(ctx context.Context, roomID string) error {
+	return c.do(ctx, "POST", "/api/v1/rooms/"+url.PathEscape(roomID)+"/reveal", nil, nil, nil)
+}
+
+// ListUsers calls GET /api/v1/rooms/{roomID}/users. Participants in a room.
+func (c *Client) ListUsers(ctx context.Context, roomID string) ([]User, error) {
+	var out []User
+	if err := c.do(ctx, "GET", "/api/v1/rooms/"+url.PathEscape(roomID)+"/users", nil, nil, &out); err != nil {
+		var zero []User
+		return zero, err
+	}
+	return out, nil
+}
+
+// JoinRoom calls POST /api/v1/rooms/{roomID}/users. Join a room, optionally adding an option.
+func (c *Client) JoinRoom(ctx context.Context, roomID string, body CreateUserWithOptionRequest) (*TokenResponse, error) {
+	var out TokenResponse
+	if err := c.do(ctx, "POST", "/api/v1/rooms/"+url.PathEscape(roomID)+"/users", nil, body, &out); err != nil {
+		var zero *TokenResponse
+		return zero, err
+	}
+	return &out, nil
+}
+
+// LeaveRoom calls DELETE /api/v1/rooms/{roomID}/users/me. Leave the room, removing the caller's option, votes and availability and ending their sessions.
+func (c *Client) LeaveRoom(ctx context.Context, roomID string) error {
+	return c.do(ctx, "DELETE", "/api/v1/rooms/"+url.PathEscape(roomID)+"/users/me", nil, nil, nil)
+}
+
+// UpdateParticipant calls PUT /api/v1/rooms/{roomID}/users/me. Change the caller's display name and option.
+func (c *Client) UpdateParticipant(ctx context.Context, roomID string, body CreateUserWithOptionRequest) error {
+	return c.do(ctx, "PUT", "/api/v1/rooms/"+url.PathEscape(roomID)+"/users/me", nil, body, nil)
+}
+
+// ListVotes calls GET /api/v1/rooms/{roomID}/votes. Votes in a room.
+func (c *Client) ListVotes(ctx context.Context, roomID string) ([]Vote, error) {
+	var out []Vote
+	if err := c.do(ctx, "GET", "/api/v1/rooms/"+url.PathEscape(roomID)+"/votes", nil, nil, &out); err != nil {
+		var zero []Vote
+		return zero, err
+	}
+	return out, nil
+}
+
+// RetractVote calls DELETE /api/v1/rooms/{roomID}/votes/me. Withdraw the caller's vote.
+func (c *Client) RetractVote(ctx context.Context, roomID string) error {
+	return c.do(ctx, "DELETE", "/api/v1/rooms/"+url.PathEscape(roomID)+"/votes/me", nil, nil, nil)
+}
+
+// CastVote calls PUT /api/v1/rooms/{roomID}/votes/me. Vote for an option, moving the caller's vote if they had one.
+func (c *Client) CastVote(ctx context.Context, roomID string, body VoteRequest) error {
+	return c.do(ctx, "PUT", "/api/v1/rooms/"+url.PathEscape(roomID)+"/votes/me", nil, body, nil)
+}
+
+// GetVote calls GET /api/v1/rooms/{roomID}/votes/{voteID}. A vote in the room.
+func (c *Client) GetVote(ctx context.Context, roomID string, voteID string) (*Vote, error) {
+	var out Vote
+	if err := c.do(ctx, "GET", "/api/v1/rooms/"+url.PathEscape(roomID)+"/votes/"+url.PathEscape(voteID), nil, nil, &out); err != nil {
+		var zero *Vote
+		return zero, err
+	}
+	return &out, nil
+}
+
+// Healthz calls GET /healthz. Liveness probe.
+func (c *Client) Healthz(ctx context.Context) (*HealthResponse, error) {
+	var out HealthResponse
+	if err := c.do(ctx, "GET", "/healthz", nil, nil, &out); err != nil {
+		var zero *HealthResponse
+		return zero, err
+	}
+	return &out, nil
+}
+
+// GetOpenAPI calls GET /openapi.json. This document.
+func (c *Client) GetOpenAPI(ctx context.Context) (map[string]interface{}, error) {
+	var out map[string]interface{}
+	if err := c.do(ctx, "GET", "/openapi.json", nil, nil, &out); err != nil {
+		var zero map[string]interface{}
+		return zero, err
+	}
+	return out, nil
+}
+
+// Readyz calls GET /readyz. Readiness probe.
+func (c *Client) Readyz(ctx context.Context) (*ReadinessResponse, error) {
+	var out ReadinessResponse
+	if err := c.do(ctx, "GET", "/readyz", nil, nil, &out); err != nil {
+		var zero *ReadinessResponse
+		return zero, err
+	}
+	return &out, nil
+}
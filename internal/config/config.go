@@ -0,0 +1,873 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+
+	minSecretLength = 32
+)
+
+// Secrets that have shipped in source and must never be used in production.
+var insecureSecrets = []string{"", "randomtest", "secret", "changeme"}
+
+type Config struct {
+	Env       string
+	HTTP      HTTPConfig
+	Log       LogConfig
+	JWT       JWTConfig
+	Database  DatabaseConfig
+	CORS      CORSConfig
+	WebSocket WebSocketConfig
+	Accounts  AccountsConfig
+	Rooms     RoomsConfig
+	Mail      MailConfig
+	OIDC      OIDCConfig
+	RateLimit RateLimitConfig
+	Metrics   MetricsConfig
+	Tracing   TracingConfig
+	Debug     DebugConfig
+	Input     InputConfig
+}
+
+type HTTPConfig struct {
+	Addr            string
+	ShutdownTimeout time.Duration
+	// LegacyRoutes keeps serving the pre-/api/v1 paths, marked deprecated.
+	// LegacySunset, when set, is announced in their Sunset header.
+	LegacyRoutes bool
+	LegacySunset time.Time
+}
+
+type LogConfig struct {
+	Level  string
+	Format string
+}
+
+type JWTConfig struct {
+	Secret          string
+	KeysFile        string
+	Issuer          string
+	TokenTTL        time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+type DatabaseConfig struct {
+	URL             string
+	AuthToken       string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// QueryTimeout bounds each store method; QueryTimeouts overrides it
+	// per method name, e.g. "GetFullRoomState". Zero means no limit.
+	QueryTimeout  time.Duration
+	QueryTimeouts map[string]time.Duration
+}
+
+type WebSocketConfig struct {
+	AllowQueryToken bool
+	// AllowCookieToken accepts the access_token cookie on the handshake,
+	// but only from origins listed explicitly in CORS.AllowedOrigins; a
+	// "*" entry never lets another site use the cookie.
+	AllowCookieToken bool
+	AuthTimeout      time.Duration
+}
+
+type AccountsConfig struct {
+	MagicLinkURL string
+	MagicLinkTTL time.Duration
+}
+
+type RoomsConfig struct {
+	InviteURL    string
+	InviteTTL    time.Duration
+	MaxInviteTTL time.Duration
+	// StateCacheTTL is how long an instance may serve a room's state and
+	// dates from memory. Writes through the instance refresh it at once;
+	// writes through other instances are seen within this long. Zero
+	// disables the cache.
+	StateCacheTTL time.Duration
+	// WriteBehind answers votes from the cached room state and stores them
+	// in batches every FlushInterval, or sooner once FlushBatch are queued.
+	// Queued votes are logged to WALDir first so a crash loses none. Other
+	// instances see them only once stored, so it suits a single instance
+	// or rooms pinned to one.
+	WriteBehind   bool
+	WALDir        string
+	FlushInterval time.Duration
+	FlushBatch    int
+}
+
+type MailConfig struct {
+	Driver       string
+	From         string
+	Dir          string
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+}
+
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	PostLoginURL string
+}
+
+func (o OIDCConfig) Enabled() bool {
+	return o.IssuerURL != ""
+}
+
+// Rate is a token bucket quota: Count requests per Per, with bursts of up
+// to Count. A zero Count means unlimited.
+type Rate struct {
+	Count int
+	Per   time.Duration
+}
+
+// ParseRate parses quotas written as "count/duration", e.g. "30/1m".
+func ParseRate(v string) (Rate, error) {
+	count, per, ok := strings.Cut(strings.TrimSpace(v), "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("rate %q must look like 30/1m", v)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return Rate{}, fmt.Errorf("rate %q has an invalid count", v)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("rate %q has an invalid period", v)
+	}
+	return Rate{Count: n, Per: d}, nil
+}
+
+func (r Rate) Unlimited() bool {
+	return r.Count == 0
+}
+
+func (r Rate) String() string {
+	return fmt.Sprintf("%d/%s", r.Count, r.Per)
+}
+
+type RateLimitConfig struct {
+	Enabled bool
+	// Store is "memory" for a per-instance limiter or "sql" to share
+	// buckets between instances through the database.
+	Store string
+	// ClientIPHeader names a header set by a trusted proxy, such as
+	// X-Forwarded-For. Empty uses the connection's remote address.
+	ClientIPHeader string
+	// TrustedProxies counts the proxies in front of the server that append
+	// to ClientIPHeader. The client IP is the address the outermost of them
+	// appended, this many entries from the right; entries further left
+	// come from the client and are ignored.
+	TrustedProxies int
+
+	CreateRoom  Rate
+	JoinPerIP   Rate
+	JoinPerRoom Rate
+	Auth        Rate
+	API         Rate
+	WSConnect   Rate
+	// WSMessages limits inbound WebSocket messages per user and type; the
+	// "*" entry applies to types without their own quota.
+	WSMessages map[string]Rate
+	WSRoom     Rate
+}
+
+type MetricsConfig struct {
+	Enabled bool
+	// Addr is the listener for /metrics. Labels include room IDs, which
+	// grant access to rooms, so keep it off the public network. Empty
+	// serves /metrics on the main listener.
+	Addr string
+}
+
+type TracingConfig struct {
+	// Exporter is "none", "stdout" or "otlp".
+	Exporter string
+	// OTLPEndpoint overrides the OTLP/HTTP collector URL; empty falls back
+	// to the standard OTEL_EXPORTER_OTLP_* variables.
+	OTLPEndpoint string
+	SampleRatio  float64
+	ServiceName  string
+}
+
+type DebugConfig struct {
+	// Token guards /debug/rooms and pprof; empty disables both.
+	Token string
+	Pprof bool
+}
+
+// InputConfig bounds and cleans user-supplied text. Lengths count
+// characters after normalisation.
+type InputConfig struct {
+	MaxRoomName    int
+	MaxDisplayName int
+	MaxOption      int
+	MaxDates       int
+	// StripHTML removes tags from names and options for frontends that
+	// render them as HTML.
+	StripHTML bool
+	// Profanity is "off", "mask" to replace ProfanityWords with asterisks
+	// or "reject" to refuse input containing them.
+	Profanity      string
+	ProfanityWords []string
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+}
+
+func Default() *Config {
+	return &Config{
+		Env: EnvDevelopment,
+		HTTP: HTTPConfig{
+			Addr:            ":8080",
+			ShutdownTimeout: 15 * time.Second,
+			LegacyRoutes:    true,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		JWT: JWTConfig{
+			Secret:          "randomtest",
+			Issuer:          "WhenRU3",
+			TokenTTL:        15 * time.Minute,
+			RefreshTokenTTL: 360 * time.Hour,
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: time.Hour,
+			QueryTimeout:    5 * time.Second,
+			QueryTimeouts: map[string]time.Duration{
+				"TakeRateLimitToken": time.Second,
+			},
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"POST", "GET", "OPTIONS", "PUT", "DELETE"},
+			AllowedHeaders: []string{"Content-Type", "Authorization", "X-Request-ID"},
+		},
+		WebSocket: WebSocketConfig{
+			AllowQueryToken:  true,
+			AllowCookieToken: true,
+			AuthTimeout:      5 * time.Second,
+		},
+		Accounts: AccountsConfig{
+			MagicLinkURL: "http://localhost:3000/login/magic",
+			MagicLinkTTL: 15 * time.Minute,
+		},
+		Rooms: RoomsConfig{
+			InviteURL:     "http://localhost:3000/join",
+			InviteTTL:     7 * 24 * time.Hour,
+			MaxInviteTTL:  30 * 24 * time.Hour,
+			StateCacheTTL: 5 * time.Second,
+			WALDir:        "data/wal",
+			FlushInterval: time.Second,
+			FlushBatch:    500,
+		},
+		OIDC: OIDCConfig{
+			Scopes:       []string{"openid", "profile", "email"},
+			PostLoginURL: "http://localhost:3000/login/oidc",
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:        true,
+			Store:          "memory",
+			TrustedProxies: 1,
+			CreateRoom:     Rate{Count: 10, Per: time.Minute},
+			JoinPerIP:      Rate{Count: 20, Per: time.Minute},
+			JoinPerRoom:    Rate{Count: 60, Per: time.Minute},
+			Auth:           Rate{Count: 10, Per: time.Minute},
+			API:            Rate{Count: 120, Per: time.Minute},
+			WSConnect:      Rate{Count: 30, Per: time.Minute},
+			WSMessages: map[string]Rate{
+				"*":            {Count: 60, Per: time.Minute},
+				"add_option":   {Count: 10, Per: time.Minute},
+				"vote":         {Count: 30, Per: time.Minute},
+				"revealVotes":  {Count: 10, Per: time.Minute},
+				"approve_join": {Count: 60, Per: time.Minute},
+				"deny_join":    {Count: 60, Per: time.Minute},
+			},
+			WSRoom: Rate{Count: 600, Per: time.Minute},
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+			Addr:    "127.0.0.1:9091",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			SampleRatio: 1,
+			ServiceName: "whenru3",
+		},
+		Input: InputConfig{
+			MaxRoomName:    100,
+			MaxDisplayName: 50,
+			MaxOption:      200,
+			MaxDates:       366,
+			StripHTML:      true,
+			Profanity:      "off",
+		},
+		Mail: MailConfig{
+			Driver:   "file",
+			From:     "WhenRU3 <no-reply@localhost>",
+			Dir:      "mail",
+			SMTPAddr: "localhost:1025",
+		},
+	}
+}
+
+// Load builds the configuration from defaults, an optional JSON file, the
+// environment (including a .env file) and finally command-line flags, each
+// layer overriding the one before it.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a JSON config file")
+	flagValues := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flagValues[s.name] = fs.String(s.name, "", s.usage+" (env "+s.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load .env file: %w", err)
+	}
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(cfg, v); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", s.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		v, ok := flagValues[f.Name]
+		if !ok || flagErr != nil {
+			return
+		}
+		if err := settingByName(f.Name).set(cfg, *v); err != nil {
+			flagErr = fmt.Errorf("invalid -%s: %w", f.Name, err)
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	for key, raw := range values {
+		s := settingByName(key)
+		if s == nil {
+			return fmt.Errorf("unknown config key %q in %s", key, path)
+		}
+		var v string
+		switch value := raw.(type) {
+		case string:
+			v = value
+		case []interface{}:
+			parts := make([]string, len(value))
+			for i, p := range value {
+				parts[i] = fmt.Sprint(p)
+			}
+			v = strings.Join(parts, ",")
+		default:
+			v = fmt.Sprint(value)
+		}
+		if err := s.set(c, v); err != nil {
+			return fmt.Errorf("invalid %q in %s: %w", key, path, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Env != EnvDevelopment && c.Env != EnvProduction {
+		errs = append(errs, fmt.Errorf("env must be %q or %q, got %q", EnvDevelopment, EnvProduction, c.Env))
+	}
+	if c.HTTP.Addr == "" {
+		errs = append(errs, errors.New("http address is required"))
+	}
+	if c.HTTP.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown timeout must be positive"))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("log level must be debug, info, warn or error, got %q", c.Log.Level))
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("log format must be \"text\" or \"json\", got %q", c.Log.Format))
+	}
+	if c.JWT.TokenTTL <= 0 {
+		errs = append(errs, errors.New("token TTL must be positive"))
+	}
+	if c.JWT.RefreshTokenTTL < c.JWT.TokenTTL {
+		errs = append(errs, errors.New("refresh token TTL cannot be shorter than the access token TTL"))
+	}
+	if c.Database.URL == "" {
+		errs = append(errs, errors.New("database URL is required"))
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 {
+		errs = append(errs, errors.New("database pool sizes cannot be negative"))
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		errs = append(errs, errors.New("database max idle connections cannot exceed max open connections"))
+	}
+	if c.Database.QueryTimeout < 0 {
+		errs = append(errs, errors.New("database query timeout cannot be negative"))
+	}
+	for method, timeout := range c.Database.QueryTimeouts {
+		if timeout < 0 {
+			errs = append(errs, fmt.Errorf("database query timeout for %s cannot be negative", method))
+		}
+	}
+	if c.IsProduction() && c.WebSocket.AllowCookieToken && slices.Contains(c.CORS.AllowedOrigins, "*") {
+		errs = append(errs, errors.New("WebSocket cookie auth in production requires explicit CORS allowed origins, not \"*\""))
+	}
+	if c.WebSocket.AuthTimeout <= 0 {
+		errs = append(errs, errors.New("websocket auth timeout must be positive"))
+	}
+	if c.Accounts.MagicLinkTTL <= 0 {
+		errs = append(errs, errors.New("magic link TTL must be positive"))
+	}
+	if c.Rooms.InviteTTL <= 0 || c.Rooms.InviteTTL > c.Rooms.MaxInviteTTL {
+		errs = append(errs, errors.New("room invite TTL must be positive and no longer than the maximum invite TTL"))
+	}
+	if c.Rooms.StateCacheTTL < 0 {
+		errs = append(errs, errors.New("room state cache TTL cannot be negative"))
+	}
+	if c.Rooms.WriteBehind {
+		if c.Rooms.StateCacheTTL == 0 {
+			errs = append(errs, errors.New("write-behind voting requires the room state cache"))
+		}
+		if c.Rooms.WALDir == "" {
+			errs = append(errs, errors.New("write-behind voting requires a write-ahead log directory"))
+		}
+		if c.Rooms.FlushInterval <= 0 || c.Rooms.FlushBatch <= 0 {
+			errs = append(errs, errors.New("write-behind flush interval and batch size must be positive"))
+		}
+	}
+	if c.Mail.Driver != "file" && c.Mail.Driver != "smtp" {
+		errs = append(errs, fmt.Errorf("mail driver must be \"file\" or \"smtp\", got %q", c.Mail.Driver))
+	}
+	if c.RateLimit.Store != "memory" && c.RateLimit.Store != "sql" {
+		errs = append(errs, fmt.Errorf("rate limit store must be \"memory\" or \"sql\", got %q", c.RateLimit.Store))
+	}
+	if c.RateLimit.ClientIPHeader != "" && c.RateLimit.TrustedProxies < 1 {
+		errs = append(errs, errors.New("rate limit trusted proxies must be at least 1 when a client IP header is set"))
+	}
+	if c.Tracing.Exporter != "none" && c.Tracing.Exporter != "stdout" && c.Tracing.Exporter != "otlp" {
+		errs = append(errs, fmt.Errorf("trace exporter must be \"none\", \"stdout\" or \"otlp\", got %q", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("trace sample ratio must be between 0 and 1"))
+	}
+	if c.Input.MaxRoomName <= 0 || c.Input.MaxDisplayName <= 0 || c.Input.MaxOption <= 0 || c.Input.MaxDates <= 0 {
+		errs = append(errs, errors.New("input length limits must be positive"))
+	}
+	if c.Input.Profanity != "off" && c.Input.Profanity != "mask" && c.Input.Profanity != "reject" {
+		errs = append(errs, fmt.Errorf("profanity filter must be \"off\", \"mask\" or \"reject\", got %q", c.Input.Profanity))
+	}
+	if c.Input.Profanity != "off" && len(c.Input.ProfanityWords) == 0 {
+		errs = append(errs, errors.New("profanity filter requires a word list"))
+	}
+	if c.Debug.Pprof && c.Debug.Token == "" {
+		errs = append(errs, errors.New("pprof requires a debug token"))
+	}
+	if c.IsProduction() && c.Debug.Token != "" && len(c.Debug.Token) < minSecretLength {
+		errs = append(errs, fmt.Errorf("debug token must be at least %d characters in production", minSecretLength))
+	}
+	if c.OIDC.Enabled() && (c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "" || c.OIDC.PostLoginURL == "") {
+		errs = append(errs, errors.New("OIDC requires a client ID, redirect URL and post-login URL"))
+	}
+	if c.IsProduction() && c.JWT.KeysFile == "" && c.JWT.insecure() {
+		errs = append(errs, fmt.Errorf("refusing to start in production with an insecure JWT secret (need at least %d characters)", minSecretLength))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Config) IsProduction() bool {
+	return c.Env == EnvProduction
+}
+
+func (j JWTConfig) insecure() bool {
+	return len(j.Secret) < minSecretLength || slices.Contains(insecureSecrets, j.Secret)
+}
+
+// ListsOrigin reports whether origin is named in the allowed origins. Unlike
+// AllowsOrigin, the "*" wildcard and a missing Origin do not count.
+func (c CORSConfig) ListsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if allowed != "*" && strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsOrigin reports whether a browser request from origin may access the
+// API. Requests without an Origin header are not cross-origin and always pass.
+func (c CORSConfig) AllowsOrigin(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+type setting struct {
+	name  string
+	env   string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{"env", "APP_ENV", "deployment environment: development or production", func(c *Config, v string) error {
+		c.Env = strings.ToLower(strings.TrimSpace(v))
+		return nil
+	}},
+	{"http-addr", "HTTP_ADDR", "address the HTTP server listens on", func(c *Config, v string) error {
+		c.HTTP.Addr = v
+		return nil
+	}},
+	{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "time allowed for graceful shutdown", durationSetter(func(c *Config) *time.Duration { return &c.HTTP.ShutdownTimeout })},
+	{"http-legacy-routes", "HTTP_LEGACY_ROUTES", "serve the deprecated routes outside /api/v1", boolSetter(func(c *Config) *bool { return &c.HTTP.LegacyRoutes })},
+	{"http-legacy-sunset", "HTTP_LEGACY_SUNSET", "date the deprecated routes will be removed, e.g. 2027-01-31", func(c *Config, v string) error {
+		if v == "" {
+			c.HTTP.LegacySunset = time.Time{}
+			return nil
+		}
+		t, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			return fmt.Errorf("%q is not a YYYY-MM-DD date", v)
+		}
+		c.HTTP.LegacySunset = t
+		return nil
+	}},
+	{"log-level", "LOG_LEVEL", "minimum log level: debug, info, warn or error", func(c *Config, v string) error {
+		c.Log.Level = v
+		return nil
+	}},
+	{"log-format", "LOG_FORMAT", "log output format: text or json", func(c *Config, v string) error {
+		c.Log.Format = v
+		return nil
+	}},
+	{"jwt-secret", "JWT_SECRET", "HMAC secret used to sign tokens", func(c *Config, v string) error {
+		c.JWT.Secret = v
+		return nil
+	}},
+	{"jwt-keys-file", "JWT_KEYS_FILE", "JSON key set used to sign and verify tokens instead of the secret", func(c *Config, v string) error {
+		c.JWT.KeysFile = v
+		return nil
+	}},
+	{"jwt-issuer", "JWT_ISSUER", "issuer claim for tokens", func(c *Config, v string) error {
+		c.JWT.Issuer = v
+		return nil
+	}},
+	{"token-ttl", "JWT_TOKEN_TTL", "lifetime of access tokens", durationSetter(func(c *Config) *time.Duration { return &c.JWT.TokenTTL })},
+	{"refresh-token-ttl", "JWT_REFRESH_TOKEN_TTL", "lifetime of refresh tokens", durationSetter(func(c *Config) *time.Duration { return &c.JWT.RefreshTokenTTL })},
+	{"db-url", "TURSO_DATABASE_URL", "database URL", func(c *Config, v string) error {
+		c.Database.URL = v
+		return nil
+	}},
+	{"db-auth-token", "TURSO_AUTH_TOKEN", "database auth token", func(c *Config, v string) error {
+		c.Database.AuthToken = v
+		return nil
+	}},
+	{"db-max-open-conns", "DB_MAX_OPEN_CONNS", "maximum open database connections", intSetter(func(c *Config) *int { return &c.Database.MaxOpenConns })},
+	{"db-max-idle-conns", "DB_MAX_IDLE_CONNS", "maximum idle database connections", intSetter(func(c *Config) *int { return &c.Database.MaxIdleConns })},
+	{"db-conn-max-lifetime", "DB_CONN_MAX_LIFETIME", "maximum lifetime of a database connection", durationSetter(func(c *Config) *time.Duration { return &c.Database.ConnMaxLifetime })},
+	{"db-query-timeout", "DB_QUERY_TIMEOUT", "default time limit for each store call; 0 disables it", durationSetter(func(c *Config) *time.Duration { return &c.Database.QueryTimeout })},
+	{"db-query-timeouts", "DB_QUERY_TIMEOUTS", "per-method store time limits, e.g. GetFullRoomState=10s,TakeRateLimitToken=1s", func(c *Config, v string) error {
+		timeouts := make(map[string]time.Duration)
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			method, value, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("%q must look like Method=5s", item)
+			}
+			timeout, err := time.ParseDuration(strings.TrimSpace(value))
+			if err != nil {
+				return err
+			}
+			timeouts[strings.TrimSpace(method)] = timeout
+		}
+		c.Database.QueryTimeouts = timeouts
+		return nil
+	}},
+	{"cors-allowed-origins", "CORS_ALLOWED_ORIGINS", "comma-separated list of allowed origins", listSetter(func(c *Config) *[]string { return &c.CORS.AllowedOrigins })},
+	{"cors-allowed-methods", "CORS_ALLOWED_METHODS", "comma-separated list of allowed methods", listSetter(func(c *Config) *[]string { return &c.CORS.AllowedMethods })},
+	{"cors-allowed-headers", "CORS_ALLOWED_HEADERS", "comma-separated list of allowed headers", listSetter(func(c *Config) *[]string { return &c.CORS.AllowedHeaders })},
+	{"ws-allow-query-token", "WS_ALLOW_QUERY_TOKEN", "deprecated: accept WebSocket tokens in the ?token= query parameter", boolSetter(func(c *Config) *bool { return &c.WebSocket.AllowQueryToken })},
+	{"ws-allow-cookie-token", "WS_ALLOW_COOKIE_TOKEN", "accept the access_token cookie on WebSocket handshakes from explicitly allowed origins", boolSetter(func(c *Config) *bool { return &c.WebSocket.AllowCookieToken })},
+	{"magic-link-url", "MAGIC_LINK_URL", "frontend URL that magic link tokens are appended to", func(c *Config, v string) error {
+		c.Accounts.MagicLinkURL = v
+		return nil
+	}},
+	{"magic-link-ttl", "MAGIC_LINK_TTL", "lifetime of magic login links", durationSetter(func(c *Config) *time.Duration { return &c.Accounts.MagicLinkTTL })},
+	{"room-invite-url", "ROOM_INVITE_URL", "frontend URL that room invite tokens are appended to", func(c *Config, v string) error {
+		c.Rooms.InviteURL = v
+		return nil
+	}},
+	{"room-invite-ttl", "ROOM_INVITE_TTL", "default lifetime of room invite links", durationSetter(func(c *Config) *time.Duration { return &c.Rooms.InviteTTL })},
+	{"room-max-invite-ttl", "ROOM_MAX_INVITE_TTL", "longest lifetime a host may request for an invite link", durationSetter(func(c *Config) *time.Duration { return &c.Rooms.MaxInviteTTL })},
+	{"room-state-cache-ttl", "ROOM_STATE_CACHE_TTL", "how long room state may be served from memory, 0 to disable", durationSetter(func(c *Config) *time.Duration { return &c.Rooms.StateCacheTTL })},
+	{"room-write-behind", "ROOM_WRITE_BEHIND", "apply votes in memory and store them in batches (single instance or sticky rooms only)", boolSetter(func(c *Config) *bool { return &c.Rooms.WriteBehind })},
+	{"room-wal-dir", "ROOM_WAL_DIR", "directory for the write-behind vote log", func(c *Config, v string) error {
+		c.Rooms.WALDir = v
+		return nil
+	}},
+	{"room-flush-interval", "ROOM_FLUSH_INTERVAL", "how often queued votes are stored", durationSetter(func(c *Config) *time.Duration { return &c.Rooms.FlushInterval })},
+	{"room-flush-batch", "ROOM_FLUSH_BATCH", "queued votes that trigger an early store", intSetter(func(c *Config) *int { return &c.Rooms.FlushBatch })},
+	{"mail-driver", "MAIL_DRIVER", "how mail is delivered: file or smtp", func(c *Config, v string) error {
+		c.Mail.Driver = v
+		return nil
+	}},
+	{"mail-from", "MAIL_FROM", "sender address for outgoing mail", func(c *Config, v string) error {
+		c.Mail.From = v
+		return nil
+	}},
+	{"mail-dir", "MAIL_DIR", "directory the file mail driver writes to", func(c *Config, v string) error {
+		c.Mail.Dir = v
+		return nil
+	}},
+	{"smtp-addr", "SMTP_ADDR", "SMTP relay host:port", func(c *Config, v string) error {
+		c.Mail.SMTPAddr = v
+		return nil
+	}},
+	{"smtp-username", "SMTP_USERNAME", "SMTP username", func(c *Config, v string) error {
+		c.Mail.SMTPUsername = v
+		return nil
+	}},
+	{"smtp-password", "SMTP_PASSWORD", "SMTP password", func(c *Config, v string) error {
+		c.Mail.SMTPPassword = v
+		return nil
+	}},
+	{"oidc-issuer-url", "OIDC_ISSUER_URL", "OpenID Connect issuer; empty disables OIDC login", func(c *Config, v string) error {
+		c.OIDC.IssuerURL = v
+		return nil
+	}},
+	{"oidc-client-id", "OIDC_CLIENT_ID", "OpenID Connect client ID", func(c *Config, v string) error {
+		c.OIDC.ClientID = v
+		return nil
+	}},
+	{"oidc-client-secret", "OIDC_CLIENT_SECRET", "OpenID Connect client secret", func(c *Config, v string) error {
+		c.OIDC.ClientSecret = v
+		return nil
+	}},
+	{"oidc-redirect-url", "OIDC_REDIRECT_URL", "this server's /auth/oidc/callback URL as registered with the IdP", func(c *Config, v string) error {
+		c.OIDC.RedirectURL = v
+		return nil
+	}},
+	{"oidc-scopes", "OIDC_SCOPES", "comma-separated scopes to request", listSetter(func(c *Config) *[]string { return &c.OIDC.Scopes })},
+	{"oidc-post-login-url", "OIDC_POST_LOGIN_URL", "frontend URL that receives tokens after OIDC login", func(c *Config, v string) error {
+		c.OIDC.PostLoginURL = v
+		return nil
+	}},
+	{"rate-limit-enabled", "RATE_LIMIT_ENABLED", "throttle public routes and WebSocket messages", boolSetter(func(c *Config) *bool { return &c.RateLimit.Enabled })},
+	{"rate-limit-store", "RATE_LIMIT_STORE", "where rate limit buckets live: memory or sql (shared between instances)", func(c *Config, v string) error {
+		c.RateLimit.Store = v
+		return nil
+	}},
+	{"rate-limit-client-ip-header", "RATE_LIMIT_CLIENT_IP_HEADER", "header a trusted proxy puts the client IP in, e.g. X-Forwarded-For", func(c *Config, v string) error {
+		c.RateLimit.ClientIPHeader = v
+		return nil
+	}},
+	{"rate-limit-trusted-proxies", "RATE_LIMIT_TRUSTED_PROXIES", "proxies in front of the server that append to the client IP header", intSetter(func(c *Config) *int { return &c.RateLimit.TrustedProxies })},
+	{"rate-limit-create-room", "RATE_LIMIT_CREATE_ROOM", "room creations per IP, e.g. 10/1m", rateSetter(func(c *Config) *Rate { return &c.RateLimit.CreateRoom })},
+	{"rate-limit-join-ip", "RATE_LIMIT_JOIN_IP", "room joins per IP", rateSetter(func(c *Config) *Rate { return &c.RateLimit.JoinPerIP })},
+	{"rate-limit-join-room", "RATE_LIMIT_JOIN_ROOM", "joins per room", rateSetter(func(c *Config) *Rate { return &c.RateLimit.JoinPerRoom })},
+	{"rate-limit-auth", "RATE_LIMIT_AUTH", "login, refresh and magic link requests per IP", rateSetter(func(c *Config) *Rate { return &c.RateLimit.Auth })},
+	{"rate-limit-api", "RATE_LIMIT_API", "authenticated API requests per user", rateSetter(func(c *Config) *Rate { return &c.RateLimit.API })},
+	{"rate-limit-ws-connect", "RATE_LIMIT_WS_CONNECT", "WebSocket connection attempts per IP", rateSetter(func(c *Config) *Rate { return &c.RateLimit.WSConnect })},
+	{"rate-limit-ws-messages", "RATE_LIMIT_WS_MESSAGES", "WebSocket messages per user by type, e.g. vote=30/1m,*=60/1m", func(c *Config, v string) error {
+		limits := make(map[string]Rate)
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			msgType, quota, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("%q must look like type=30/1m", item)
+			}
+			rate, err := ParseRate(quota)
+			if err != nil {
+				return err
+			}
+			limits[strings.TrimSpace(msgType)] = rate
+		}
+		c.RateLimit.WSMessages = limits
+		return nil
+	}},
+	{"rate-limit-ws-room", "RATE_LIMIT_WS_ROOM", "WebSocket messages per room from all users", rateSetter(func(c *Config) *Rate { return &c.RateLimit.WSRoom })},
+	{"metrics-enabled", "METRICS_ENABLED", "expose Prometheus metrics", boolSetter(func(c *Config) *bool { return &c.Metrics.Enabled })},
+	{"metrics-addr", "METRICS_ADDR", "listen address for /metrics; empty serves it on the main listener", func(c *Config, v string) error {
+		c.Metrics.Addr = v
+		return nil
+	}},
+	{"tracing-exporter", "TRACING_EXPORTER", "trace exporter: none, stdout or otlp", func(c *Config, v string) error {
+		c.Tracing.Exporter = v
+		return nil
+	}},
+	{"tracing-otlp-endpoint", "TRACING_OTLP_ENDPOINT", "OTLP/HTTP collector URL, e.g. http://localhost:4318", func(c *Config, v string) error {
+		c.Tracing.OTLPEndpoint = v
+		return nil
+	}},
+	{"tracing-service-name", "TRACING_SERVICE_NAME", "service.name reported on spans", func(c *Config, v string) error {
+		c.Tracing.ServiceName = v
+		return nil
+	}},
+	{"tracing-sample-ratio", "TRACING_SAMPLE_RATIO", "fraction of new traces to sample, 0 to 1", floatSetter(func(c *Config) *float64 { return &c.Tracing.SampleRatio })},
+	{"debug-token", "DEBUG_TOKEN", "bearer token for /debug endpoints; empty disables them", func(c *Config, v string) error {
+		c.Debug.Token = v
+		return nil
+	}},
+	{"debug-pprof", "DEBUG_PPROF", "serve pprof under /debug/pprof (requires a debug token)", boolSetter(func(c *Config) *bool { return &c.Debug.Pprof })},
+	{"ws-auth-timeout", "WS_AUTH_TIMEOUT", "how long a WebSocket may take to send its auth frame", durationSetter(func(c *Config) *time.Duration { return &c.WebSocket.AuthTimeout })},
+	{"input-max-room-name", "INPUT_MAX_ROOM_NAME", "maximum room name length in characters", intSetter(func(c *Config) *int { return &c.Input.MaxRoomName })},
+	{"input-max-display-name", "INPUT_MAX_DISPLAY_NAME", "maximum display name length in characters", intSetter(func(c *Config) *int { return &c.Input.MaxDisplayName })},
+	{"input-max-option", "INPUT_MAX_OPTION", "maximum option length in characters", intSetter(func(c *Config) *int { return &c.Input.MaxOption })},
+	{"input-max-dates", "INPUT_MAX_DATES", "maximum dates in one availability update", intSetter(func(c *Config) *int { return &c.Input.MaxDates })},
+	{"input-strip-html", "INPUT_STRIP_HTML", "remove HTML tags from names and options", boolSetter(func(c *Config) *bool { return &c.Input.StripHTML })},
+	{"input-profanity", "INPUT_PROFANITY", "profanity filter: off, mask or reject", func(c *Config, v string) error {
+		c.Input.Profanity = v
+		return nil
+	}},
+	{"input-profanity-words", "INPUT_PROFANITY_WORDS", "comma-separated words the profanity filter matches", listSetter(func(c *Config) *[]string { return &c.Input.ProfanityWords })},
+}
+
+func settingByName(name string) *setting {
+	for i := range settings {
+		if settings[i].name == name {
+			return &settings[i]
+		}
+	}
+	return nil
+}
+
+func durationSetter(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			return err
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func intSetter(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func floatSetter(field func(*Config) *float64) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = f
+		return nil
+	}
+}
+
+func boolSetter(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func rateSetter(field func(*Config) *Rate) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		rate, err := ParseRate(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = rate
+		return nil
+	}
+}
+
+func listSetter(field func(*Config) *[]string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		var list []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/authz"
+	"websocket-chat/internal/logging"
+	"websocket-chat/internal/mailer"
+	"websocket-chat/internal/middleware"
+	"websocket-chat/internal/store"
+	"websocket-chat/internal/utils"
+	"websocket-chat/internal/validate"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	magicLinkURL = "http://localhost:3000/login/magic"
+	magicLinkTTL = 15 * time.Minute
+)
+
+func normaliseEmail(email string) (string, bool) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", false
+	}
+	return email, true
+}
+
+func writeTokens(w http.ResponseWriter, tokens *TokenResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func Register(sqlStore *store.SQLStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req AccountCredentialsRequest
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			apierr.Respond(w, r, apierr.InvalidBody, "Invalid request body")
+			return
+		}
+
+		email, ok := normaliseEmail(req.Email)
+		if !ok {
+			apierr.Respond(w, r, apierr.ValidationFailed, "A valid email is required")
+			return
+		}
+		var v validate.Checker
+		v.Secret("password", req.Password, utils.MinPasswordLength)
+		if err := v.Err(); err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+
+		if _, err := sqlStore.GetAccountByEmail(r.Context(), email); err == nil {
+			apierr.Respond(w, r, apierr.Conflict, "An account with this email already exists")
+			return
+		}
+
+		hash, err := utils.HashPassword(req.Password)
+		if err != nil {
+			serverError(w, r, "Failed to create account", err)
+			return
+		}
+
+		account, err := sqlStore.CreateAccount(r.Context(), email, hash)
+		if err != nil {
+			serverError(w, r, "Failed to create account", err)
+			return
+		}
+
+		tokens, err := startAccountSession(r.Context(), w, sqlStore, account.AccountID)
+		if err != nil {
+			serverError(w, r, "Failed to generate token", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		writeTokens(w, tokens)
+	}
+}
+
+func Login(sqlStore *store.SQLStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req AccountCredentialsRequest
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			apierr.Respond(w, r, apierr.InvalidBody, "Invalid request body")
+			return
+		}
+
+		email, _ := normaliseEmail(req.Email)
+		account, err := sqlStore.GetAccountByEmail(r.Context(), email)
+		hash := ""
+		if err == nil {
+			hash = account.PasswordHash
+		}
+		if !utils.CheckPassword(hash, req.Password) {
+			apierr.Respond(w, r, apierr.Unauthorized, "Invalid email or password")
+			return
+		}
+
+		tokens, err := startAccountSession(r.Context(), w, sqlStore, account.AccountID)
+		if err != nil {
+			serverError(w, r, "Failed to generate token", err)
+			return
+		}
+		writeTokens(w, tokens)
+	}
+}
+
+// RequestMagicLink always answers 202 so it cannot be used to discover which
+// emails have accounts.
+func RequestMagicLink(sqlStore *store.SQLStore, m mailer.Mailer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req MagicLinkRequest
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			apierr.Respond(w, r, apierr.InvalidBody, "Invalid request body")
+			return
+		}
+
+		email, ok := normaliseEmail(req.Email)
+		if !ok {
+			apierr.Respond(w, r, apierr.ValidationFailed, "A valid email is required")
+			return
+		}
+
+		token, hash, err := utils.GenerateOpaqueToken()
+		if err != nil {
+			serverError(w, r, "Failed to create magic link", err)
+			return
+		}
+
+		if err := sqlStore.CreateMagicLink(r.Context(), hash, email, time.Now().Add(magicLinkTTL)); err != nil {
+			serverError(w, r, "Failed to create magic link", err)
+			return
+		}
+
+		link := magicLinkURL + "?token=" + url.QueryEscape(token)
+		err = m.Send(r.Context(), mailer.Message{
+			To:      email,
+			Subject: "Your sign-in link",
+			Body:    fmt.Sprintf("Use this link to sign in. It expires in %s and can be used once.\n\n%s\n", magicLinkTTL, link),
+		})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to send magic link", "err", err)
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// VerifyMagicLink exchanges a magic link token for an account session,
+// creating the account on first use.
+func VerifyMagicLink(sqlStore *store.SQLStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req VerifyMagicLinkRequest
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Token == "" {
+			apierr.Respond(w, r, apierr.InvalidBody, "Invalid request body")
+			return
+		}
+
+		email, err := sqlStore.ConsumeMagicLink(r.Context(), utils.HashOpaqueToken(req.Token))
+		if err != nil {
+			apierr.Respond(w, r, apierr.Unauthorized, "Invalid or expired link")
+			return
+		}
+
+		account, err := sqlStore.GetAccountByEmail(r.Context(), email)
+		if err != nil {
+			account, err = sqlStore.CreateAccount(r.Context(), email, "")
+			if err != nil {
+				serverError(w, r, "Failed to create account", err)
+				return
+			}
+		}
+
+		tokens, err := startAccountSession(r.Context(), w, sqlStore, account.AccountID)
+		if err != nil {
+			serverError(w, r, "Failed to generate token", err)
+			return
+		}
+		writeTokens(w, tokens)
+	}
+}
+
+func GetMyRooms(sqlStore *store.SQLStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		accountID := middleware.AccountIDFromContext(r.Context())
+
+		rooms, err := sqlStore.GetAccountRooms(r.Context(), accountID)
+		if err != nil {
+			serverError(w, r, "Failed to get rooms", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rooms)
+	}
+}
+
+// ClaimRoomIdentity attaches an anonymous room identity, proven by its room
+// access token, to the caller's account.
+func ClaimRoomIdentity(sqlStore *store.SQLStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ClaimRoomRequest
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Token == "" {
+			apierr.Respond(w, r, apierr.ValidationFailed, "token is required")
+			return
+		}
+
+		accountID := middleware.AccountIDFromContext(r.Context())
+
+		claims, err := utils.ParseJWT(req.Token)
+		if err != nil || claims.UserID == "" {
+			apierr.Respond(w, r, apierr.Unauthorized, "Invalid room token")
+			return
+		}
+
+		owner, err := sqlStore.GetAccountIDForUser(r.Context(), claims.UserID)
+		if err != nil {
+			serverError(w, r, "Failed to claim room", err)
+			return
+		}
+		if owner == accountID {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if owner != "" {
+			apierr.Respond(w, r, apierr.Conflict, "This identity belongs to another account")
+			return
+		}
+
+		if _, err := sqlStore.GetAccountUserInRoom(r.Context(), accountID, claims.RoomID); err == nil {
+			apierr.Respond(w, r, apierr.Conflict, "Your account already has an identity in this room")
+			return
+		}
+
+		if err := sqlStore.LinkUserToAccount(r.Context(), accountID, claims.UserID, claims.RoomID); err != nil {
+			serverError(w, r, "Failed to claim room", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// CreateRoomToken issues a room token for the account's identity in a room,
+// so an account can re-enter its rooms from any device.
+func CreateRoomToken(sqlStore *store.SQLStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		accountID := middleware.AccountIDFromContext(r.Context())
+		roomID := mux.Vars(r)["roomID"]
+
+		user, err := sqlStore.GetAccountUserInRoom(r.Context(), accountID, roomID)
+		if err != nil {
+			apierr.Write(w, r, authz.ErrForbidden)
+			return
+		}
+
+		tokens, err := createSession(r.Context(), w, sqlStore, user.UserID, user.RoomID, accountID)
+		if err != nil {
+			serverError(w, r, "Failed to generate token", err)
+			return
+		}
+		writeTokens(w, tokens)
+	}
+}
+
+// accountFromRequest returns the account ID of an optional account token.
+func accountFromRequest(r *http.Request) string {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return ""
+	}
+	claims, err := utils.ParseJWT(strings.TrimPrefix(authHeader, "Bearer "))
+	if err != nil {
+		return ""
+	}
+	return claims.AccountID
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+// The handlers in this file perform the same room actions as the WebSocket
+// messages, through the same services, for clients that do not hold a
+// connection open.
+
+func AddOption(voting *service.VotingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req OptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierr.Respond(w, r, apierr.InvalidBody, "Invalid request body")
+			return
+		}
+		option, err := voting.AddOption(r.Context(), actor(r), mux.Vars(r)["roomID"], req.Content)
+		if err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, option)
+	}
+}
+
+func GetOption(voting *service.VotingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		option, err := voting.GetOption(r.Context(), actor(r), mux.Vars(r)["roomID"], mux.Vars(r)["optionID"])
+		if err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, option)
+	}
+}
+
+func EditOption(voting *service.VotingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req OptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierr.Respond(w, r, apierr.InvalidBody, "Invalid request body")
+			return
+		}
+		option, err := voting.EditOption(r.Context(), actor(r), mux.Vars(r)["roomID"], mux.Vars(r)["optionID"], req.Content)
+		if err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, option)
+	}
+}
+
+func DeleteOption(voting *service.VotingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := voting.DeleteOption(r.Context(), actor(r), mux.Vars(r)["roomID"], mux.Vars(r)["optionID"]); err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func CastVote(voting *service.VotingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req VoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierr.Respond(w, r, apierr.InvalidBody, "Invalid request body")
+			return
+		}
+		if err := voting.Vote(r.Context(), actor(r), mux.Vars(r)["roomID"], req.OptionID); err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func RetractVote(voting *service.VotingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := voting.RetractVote(r.Context(), actor(r), mux.Vars(r)["roomID"]); err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func GetVote(voting *service.VotingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vote, err := voting.GetVote(r.Context(), actor(r), mux.Vars(r)["roomID"], mux.Vars(r)["voteID"])
+		if err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, vote)
+	}
+}
+
+func RevealVotes(voting *service.VotingService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := voting.Reveal(r.Context(), actor(r), mux.Vars(r)["roomID"]); err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DecideJoinRequest approves or denies the {userID} join request.
+func DecideJoinRequest(rooms *service.RoomService, approved bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := rooms.DecideJoin(r.Context(), actor(r), mux.Vars(r)["roomID"], mux.Vars(r)["userID"], approved); err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func LeaveRoom(rooms *service.RoomService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := rooms.Leave(r.Context(), actor(r), mux.Vars(r)["roomID"]); err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+		setRefreshCookie(w, "", time.Unix(0, 0))
+		setAccessCookie(w, "", time.Unix(0, 0))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func DeleteRoom(rooms *service.RoomService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := rooms.Delete(r.Context(), actor(r), mux.Vars(r)["roomID"]); err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+		setRefreshCookie(w, "", time.Unix(0, 0))
+		setAccessCookie(w, "", time.Unix(0, 0))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
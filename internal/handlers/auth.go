@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/middleware"
+	"websocket-chat/internal/models"
+	"websocket-chat/internal/store"
+	"websocket-chat/internal/utils"
+	ws "websocket-chat/internal/websocket"
+)
+
+const refreshCookieName = "refresh_token"
+
+// refreshCookiePaths scope the refresh cookie to both refresh routes. The
+// cookie is always set on every path at once, so rotating it through one
+// route never leaves a stale token behind for the other.
+var refreshCookiePaths = []string{"/api/v1/auth", "/auth"}
+
+func startAccountSession(ctx context.Context, w http.ResponseWriter, sqlStore *store.SQLStore, accountID string) (*TokenResponse, error) {
+	return createSession(ctx, w, sqlStore, "", "", accountID)
+}
+
+// createSession records a new server-side session and returns a short-lived
+// access token for it. The refresh token is also set as an HttpOnly cookie.
+func createSession(ctx context.Context, w http.ResponseWriter, sqlStore *store.SQLStore, userID, roomID, accountID string) (*TokenResponse, error) {
+	refreshToken, refreshHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := sqlStore.CreateSession(ctx, userID, roomID, accountID, refreshHash, time.Now().Add(utils.RefreshTokenTTL()))
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := sessionAccessToken(ctx, sqlStore, session)
+	if err != nil {
+		return nil, err
+	}
+
+	setRefreshCookie(w, refreshToken, session.ExpiresAt)
+	setAccessCookie(w, accessToken, time.Now().Add(utils.TokenTTL()))
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.TokenTTL().Seconds()),
+	}, nil
+}
+
+func sessionAccessToken(ctx context.Context, sqlStore *store.SQLStore, session *models.Session) (string, error) {
+	if session.RoomID == "" {
+		return utils.GenerateAccountJWT(session.AccountID, session.SessionID)
+	}
+
+	status, err := sqlStore.GetJoinStatus(ctx, session.UserID)
+	if err != nil {
+		return "", err
+	}
+	if status != models.JoinApproved {
+		return utils.GeneratePendingJWT(session.UserID, session.RoomID, session.SessionID)
+	}
+	return utils.GenerateJWT(session.UserID, session.RoomID, session.SessionID)
+}
+
+func setRefreshCookie(w http.ResponseWriter, value string, expires time.Time) {
+	for _, path := range refreshCookiePaths {
+		setTokenCookie(w, refreshCookieName, path, value, expires)
+	}
+}
+
+// setAccessCookie lets browsers authenticate the WebSocket handshake without
+// putting the token in the URL.
+func setAccessCookie(w http.ResponseWriter, value string, expires time.Time) {
+	setTokenCookie(w, accessCookieName, "/ws", value, expires)
+}
+
+func setTokenCookie(w http.ResponseWriter, name, path, value string, expires time.Time) {
+	sameSite := http.SameSiteLaxMode
+	if secureCookies {
+		sameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   secureCookies,
+		SameSite: sameSite,
+	})
+}
+
+func RefreshToken(sqlStore *store.SQLStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req RefreshTokenRequest
+		if cookie, err := r.Cookie(refreshCookieName); err == nil {
+			req.RefreshToken = cookie.Value
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				apierr.Respond(w, r, apierr.InvalidBody, "Invalid request body")
+				return
+			}
+		}
+
+		if req.RefreshToken == "" {
+			apierr.Respond(w, r, apierr.ValidationFailed, "refreshToken is required")
+			return
+		}
+
+		oldHash := utils.HashOpaqueToken(req.RefreshToken)
+		session, err := sqlStore.GetSessionByRefreshTokenHash(r.Context(), oldHash)
+		if err != nil || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+			apierr.Respond(w, r, apierr.Unauthorized, "Invalid refresh token")
+			return
+		}
+
+		refreshToken, refreshHash, err := utils.GenerateOpaqueToken()
+		if err != nil {
+			serverError(w, r, "Failed to generate token", err)
+			return
+		}
+
+		expiresAt := time.Now().Add(utils.RefreshTokenTTL())
+		err = sqlStore.RotateRefreshToken(r.Context(), session.SessionID, oldHash, refreshHash, expiresAt)
+		if err != nil {
+			apierr.Respond(w, r, apierr.Unauthorized, "Invalid refresh token")
+			return
+		}
+
+		accessToken, err := sessionAccessToken(r.Context(), sqlStore, session)
+		if err != nil {
+			serverError(w, r, "Failed to generate token", err)
+			return
+		}
+
+		setRefreshCookie(w, refreshToken, expiresAt)
+		setAccessCookie(w, accessToken, time.Now().Add(utils.TokenTTL()))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TokenResponse{
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+			ExpiresIn:    int(utils.TokenTTL().Seconds()),
+		})
+	}
+}
+
+func Logout(hub *ws.Hub, sqlStore *store.SQLStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := middleware.SessionIDFromContext(r.Context())
+
+		err := sqlStore.RevokeSession(r.Context(), sessionID)
+		if err != nil {
+			serverError(w, r, "Failed to revoke session", err)
+			return
+		}
+
+		utils.Revoked.Add(sessionID, time.Now())
+		hub.CloseSession(sessionID)
+
+		setRefreshCookie(w, "", time.Unix(0, 0))
+		setAccessCookie(w, "", time.Unix(0, 0))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"net/http"
+	"websocket-chat/internal/apierr"
+)
+
+// serverError answers with the error err maps to, such as room_not_found
+// for store.ErrRoomNotFound. Anything else is logged and reported as an
+// internal error with message, so store and driver details never reach
+// clients.
+func serverError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	apierr.Write(w, r, apierr.Wrap(err, message))
+}
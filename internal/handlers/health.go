@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/logging"
+	"websocket-chat/internal/store"
+	ws "websocket-chat/internal/websocket"
+)
+
+const readinessTimeout = 2 * time.Second
+
+type ReadinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Healthz reports that the process is up and serving requests.
+func Healthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	}
+}
+
+// Readyz reports whether the instance can take traffic: the database
+// answers and the hub loop is running. It fails once shutdown begins so
+// load balancers stop routing here first.
+func Readyz(hub *ws.Hub, sqlStore *store.SQLStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		resp := ReadinessResponse{Status: "ok", Checks: map[string]string{"database": "ok", "hub": "ok"}}
+		status := http.StatusOK
+		if err := sqlStore.Ping(ctx); err != nil {
+			logging.FromContext(ctx).Warn("Readiness check failed", "check", "database", "err", err)
+			resp.Checks["database"] = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+		if _, err := hub.Stats(ctx); err != nil {
+			logging.FromContext(ctx).Warn("Readiness check failed", "check", "hub", "err", err)
+			resp.Checks["hub"] = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+		if status != http.StatusOK {
+			resp.Status = "unavailable"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// DebugRooms lists the rooms with live connections and their send queues.
+func DebugRooms(hub *ws.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		stats, err := hub.Stats(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error("Failed to inspect hub", "err", err)
+			apierr.Respond(w, r, apierr.Unavailable, "Hub unavailable")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
+	}
+}
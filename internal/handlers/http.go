@@ -1,208 +1,238 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/middleware"
+	"websocket-chat/internal/models"
+	"websocket-chat/internal/service"
 	"websocket-chat/internal/store"
-	"websocket-chat/internal/utils"
-	ws "websocket-chat/internal/websocket"
+
+	"github.com/gorilla/mux"
 )
 
-func CreateRoom(sqlStore *store.SQLStore) http.HandlerFunc {
+// roomIDParam returns the {roomID} path variable of /api/v1 routes, or
+// fallback, the query or body field the legacy routes carry it in.
+func roomIDParam(r *http.Request, fallback string) string {
+	if roomID, ok := mux.Vars(r)["roomID"]; ok {
+		return roomID
+	}
+	return fallback
+}
+
+// actor returns the authenticated caller. The services decide what they
+// may do.
+func actor(r *http.Request) service.Actor {
+	return service.Actor{
+		UserID:  middleware.UserIDFromContext(r.Context()),
+		RoomID:  middleware.RoomIDFromContext(r.Context()),
+		Pending: middleware.PendingFromContext(r.Context()),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func CreateRoom(rooms *service.RoomService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req CreateRoomRequest
 
 		err := json.NewDecoder(r.Body).Decode(&req)
 		if err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierr.Respond(w, r, apierr.InvalidBody, "Invalid request body")
 			return
 		}
 
-		if req.RoomName == "" {
-			http.Error(w, "roomName is required", http.StatusBadRequest)
-			return
-		}
-
-		room, err := sqlStore.CreateRoom(req.RoomName)
+		room, err := rooms.Create(r.Context(), req.RoomName)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierr.Write(w, r, err)
 			return
 		}
 		json.NewEncoder(w).Encode(room)
 	}
 }
 
-func CreateUser(sqlStore *store.SQLStore) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		var req CreateUserRequest
-
-		err := json.NewDecoder(r.Body).Decode(&req)
-		if err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
-
-		if req.RoomID == "" || req.DisplayName == "" {
-			http.Error(w, "roomID and displayName are required", http.StatusBadRequest)
-			return
-		}
-
-		user, err := sqlStore.CreateUser(req.RoomID, req.DisplayName)
-		if err != nil {
-			http.Error(w, "Failed to create user", http.StatusInternalServerError)
-			return
-		}
+// JoinRoom adds a participant and answers with their session's tokens,
+// with 202 Accepted when they wait for the host's approval.
+func JoinRoom(rooms *service.RoomService, sqlStore *store.SQLStore) http.HandlerFunc {
+	return joinRoom(rooms, sqlStore, func(w http.ResponseWriter, status int, tokens *TokenResponse) {
+		writeJSON(w, status, tokens)
+	})
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(user)
-	}
+// CreateUserWithOption is the deprecated join, answering with the bare
+// access token the original frontend expects.
+func CreateUserWithOption(rooms *service.RoomService, sqlStore *store.SQLStore) http.HandlerFunc {
+	return joinRoom(rooms, sqlStore, func(w http.ResponseWriter, status int, tokens *TokenResponse) {
+		writeJSON(w, status, tokens.AccessToken)
+	})
 }
 
-func CreateUserWithOption(hub *ws.Hub, sqlStore *store.SQLStore) http.HandlerFunc {
+func joinRoom(rooms *service.RoomService, sqlStore *store.SQLStore, respond func(w http.ResponseWriter, status int, tokens *TokenResponse)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req CreateUserWithOptionRequest
 
 		err := json.NewDecoder(r.Body).Decode(&req)
 		if err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierr.Respond(w, r, apierr.InvalidBody, "Invalid request body")
 			return
 		}
 
-		if req.RoomID == "" || req.DisplayName == "" {
-			http.Error(w, "roomID and displayName are required", http.StatusBadRequest)
-			return
-		}
-
-		user, err := sqlStore.CreateUser(req.RoomID, req.DisplayName)
+		accountID := accountFromRequest(r)
+		user, pending, err := rooms.Join(r.Context(), service.JoinParams{
+			RoomID:        roomIDParam(r, req.RoomID),
+			DisplayName:   req.DisplayName,
+			OptionContent: req.OptionContent,
+			Passcode:      req.Passcode,
+			InviteToken:   req.InviteToken,
+			AccountID:     accountID,
+		})
 		if err != nil {
-			http.Error(w, "Failed to create user", http.StatusInternalServerError)
+			apierr.Write(w, r, err)
 			return
 		}
 
-		if len(req.OptionContent) > 0 {
-			_, err = sqlStore.CreateOption(req.RoomID, user.UserID, req.OptionContent)
-			if err != nil {
-				http.Error(w, "Failed to create option", http.StatusInternalServerError)
-				return
-			}
-		}
-
-		token, err := utils.GenerateJWT(user.UserID, user.RoomID)
+		tokens, err := createSession(r.Context(), w, sqlStore, user.UserID, user.RoomID, accountID)
 		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			serverError(w, r, "Failed to generate token", err)
 			return
 		}
 
-		room, _ := sqlStore.GetFullRoomState(req.RoomID)
-		hub.Broadcast <- ws.BroadcastMessage{
-			RoomID:  req.RoomID,
-			Message: room,
+		status := http.StatusOK
+		if pending {
+			status = http.StatusAccepted
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(token)
+		respond(w, status, tokens)
 	}
 }
 
-func UpdateUserWithOption(hub *ws.Hub, sqlStore *store.SQLStore) http.HandlerFunc {
+// UpdateParticipant changes the caller's display name and option and
+// answers 204 No Content.
+func UpdateParticipant(rooms *service.RoomService) http.HandlerFunc {
+	return updateParticipant(rooms, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// UpdateUserWithOption is the deprecated participant update, answering
+// with the plain text the original frontend expects.
+func UpdateUserWithOption(rooms *service.RoomService) http.HandlerFunc {
+	return updateParticipant(rooms, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("User and option updated successfully"))
+	})
+}
+
+func updateParticipant(rooms *service.RoomService, respond func(w http.ResponseWriter)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req CreateUserWithOptionRequest
 
 		err := json.NewDecoder(r.Body).Decode(&req)
 		if err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierr.Respond(w, r, apierr.InvalidBody, "Invalid request body")
 			return
 		}
 
-		userID := r.Context().Value("userID").(string)
-
-		if req.RoomID == "" || req.DisplayName == "" {
-			http.Error(w, "roomID and displayName are required", http.StatusBadRequest)
-			return
-		}
-
-		err = sqlStore.ChangeUserName(userID, req.RoomID, req.DisplayName)
+		err = rooms.UpdateParticipant(r.Context(), actor(r), roomIDParam(r, req.RoomID), req.DisplayName, req.OptionContent)
 		if err != nil {
-			http.Error(w, "Failed to update user", http.StatusInternalServerError)
+			apierr.Write(w, r, err)
 			return
 		}
 
-		if len(req.OptionContent) > 0 {
-			err = sqlStore.ChangeOption(userID, req.RoomID, req.OptionContent)
-			if err != nil {
-				http.Error(w, "Failed to update option", http.StatusInternalServerError)
-				return
-			}
-		}
+		respond(w)
+	}
+}
 
-		room, _ := sqlStore.GetFullRoomState(req.RoomID)
-		hub.Broadcast <- ws.BroadcastMessage{
-			RoomID:  req.RoomID,
-			Message: room,
-		}
+// ReplaceAvailability replaces the caller's available dates and answers
+// with the dates added and removed.
+func ReplaceAvailability(availability *service.AvailabilityService) http.HandlerFunc {
+	return replaceAvailability(availability, func(w http.ResponseWriter, change *models.AvailabilityChange) {
+		writeJSON(w, http.StatusOK, change)
+	})
+}
 
+// CreateAvailability is the deprecated availability update, answering with
+// the plain text the original frontend expects.
+func CreateAvailability(availability *service.AvailabilityService) http.HandlerFunc {
+	return replaceAvailability(availability, func(w http.ResponseWriter, _ *models.AvailabilityChange) {
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("User and option updated successfully"))
-	}
+		w.Write([]byte("Availability created successfully"))
+	})
 }
 
-func CreateAvailability(sqlStore *store.SQLStore) http.HandlerFunc {
+func replaceAvailability(availability *service.AvailabilityService, respond func(w http.ResponseWriter, change *models.AvailabilityChange)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req CreateAvailabilityRequest
 
 		err := json.NewDecoder(r.Body).Decode(&req)
 		if err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			apierr.Respond(w, r, apierr.InvalidBody, "Invalid request body")
 			return
 		}
 
-		userID := r.Context().Value("userID").(string)
-
-		if req.RoomID == "" || userID == "" || req.Dates == nil {
-			http.Error(w, "roomID and userID and dates are required", http.StatusBadRequest)
+		change, err := availability.Replace(r.Context(), actor(r), roomIDParam(r, req.RoomID), req.Dates)
+		if err != nil {
+			apierr.Write(w, r, err)
 			return
 		}
+		respond(w, change)
+	}
+}
 
-		err = sqlStore.DeleteUserDates(req.RoomID, userID)
-
+func GetRoomState(rooms *service.RoomService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID := roomIDParam(r, r.URL.Query().Get("roomID"))
+		room, err := rooms.State(r.Context(), actor(r), roomID)
 		if err != nil {
-			http.Error(w, "Error deleting user dates", http.StatusInternalServerError)
+			apierr.Write(w, r, err)
 			return
 		}
-
-		for _, date := range req.Dates {
-			_, err := sqlStore.CreateDate(req.RoomID, userID, date)
-			if err != nil {
-				http.Error(w, "Failed to create user", http.StatusInternalServerError)
-				return
-			}
-		}
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Availability created successfully"))
+		json.NewEncoder(w).Encode(room)
 	}
 }
 
-func GetRoomState(sqlStore *store.SQLStore) http.HandlerFunc {
+func GetDates(availability *service.AvailabilityService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		roomID := r.URL.Query().Get("roomID")
-		room, err := sqlStore.GetFullRoomState(roomID)
+		roomID := roomIDParam(r, r.URL.Query().Get("roomID"))
+		results, err := availability.Dates(r.Context(), actor(r), roomID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierr.Write(w, r, err)
 			return
 		}
-		json.NewEncoder(w).Encode(room)
+		json.NewEncoder(w).Encode(results)
 	}
 }
 
-func GetDates(sqlStore *store.SQLStore) http.HandlerFunc {
+func ListUsers(rooms *service.RoomService) http.HandlerFunc {
+	return listRoom(rooms.Users)
+}
+
+func ListOptions(voting *service.VotingService) http.HandlerFunc {
+	return listRoom(voting.Options)
+}
+
+func ListVotes(voting *service.VotingService) http.HandlerFunc {
+	return listRoom(voting.Votes)
+}
+
+// listRoom serves one collection of the route's room, as an empty array
+// rather than null when there is nothing in it.
+func listRoom[T any](list func(context.Context, service.Actor, string) ([]T, error)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		roomID := r.URL.Query().Get("roomID")
-		results, err := sqlStore.GetDatesByRoomID(roomID)
+		items, err := list(r.Context(), actor(r), roomIDParam(r, ""))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			apierr.Write(w, r, err)
 			return
 		}
-		json.NewEncoder(w).Encode(results)
+		if items == nil {
+			items = []T{}
+		}
+		writeJSON(w, http.StatusOK, items)
 	}
 }
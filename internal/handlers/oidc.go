@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"websocket-chat/internal/logging"
+	"websocket-chat/internal/sso"
+	"websocket-chat/internal/store"
+	"websocket-chat/internal/utils"
+	"websocket-chat/internal/validate"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	oidcStateCookie   = "oidc_state"
+	oidcStateAudience = "oidc-state"
+	oidcStateTTL      = 10 * time.Minute
+)
+
+var oidcPostLoginURL = "http://localhost:3000/login/oidc"
+
+// oidcState travels in a signed cookie between the login redirect and the
+// callback so any instance can complete the flow.
+type oidcState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	RoomID   string `json:"roomId,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// OIDCLogin redirects to the identity provider. An optional roomID query
+// parameter joins that room as the signed-in user once login completes.
+func OIDCLogin(provider *sso.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state, _, err := utils.GenerateOpaqueToken()
+		if err != nil {
+			serverError(w, r, "Failed to start login", err)
+			return
+		}
+		nonce, _, err := utils.GenerateOpaqueToken()
+		if err != nil {
+			serverError(w, r, "Failed to start login", err)
+			return
+		}
+		verifier := sso.GenerateVerifier()
+
+		expires := time.Now().Add(oidcStateTTL)
+		cookie, err := utils.SignToken(&oidcState{
+			State:    state,
+			Nonce:    nonce,
+			Verifier: verifier,
+			RoomID:   r.URL.Query().Get("roomID"),
+			RegisteredClaims: jwt.RegisteredClaims{
+				Audience:  jwt.ClaimStrings{oidcStateAudience},
+				ExpiresAt: jwt.NewNumericDate(expires),
+			},
+		})
+		if err != nil {
+			serverError(w, r, "Failed to start login", err)
+			return
+		}
+
+		// Lax, not None: the cookie must survive the top-level redirect back
+		// from the identity provider but is never needed cross-site otherwise.
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    cookie,
+			Path:     "/auth/oidc",
+			Expires:  expires,
+			HttpOnly: true,
+			Secure:   secureCookies,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, provider.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+	}
+}
+
+// OIDCCallback completes the login and hands the app's own tokens to the
+// frontend in the URL fragment, which browsers never send to servers.
+func OIDCCallback(provider *sso.Provider, sqlStore *store.SQLStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(oidcStateCookie)
+		http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc", MaxAge: -1})
+		if err != nil {
+			oidcRedirect(w, r, url.Values{"error": {"missing_state"}})
+			return
+		}
+
+		var st oidcState
+		if err := utils.ParseToken(cookie.Value, &st); err != nil || !st.VerifyAudience(oidcStateAudience, true) {
+			oidcRedirect(w, r, url.Values{"error": {"invalid_state"}})
+			return
+		}
+
+		query := r.URL.Query()
+		if query.Get("state") != st.State {
+			oidcRedirect(w, r, url.Values{"error": {"invalid_state"}})
+			return
+		}
+		if idpErr := query.Get("error"); idpErr != "" {
+			oidcRedirect(w, r, url.Values{"error": {idpErr}})
+			return
+		}
+
+		identity, err := provider.Exchange(r.Context(), query.Get("code"), st.Verifier, st.Nonce)
+		if err != nil {
+			logging.FromContext(r.Context()).Warn("OIDC exchange failed", "err", err)
+			oidcRedirect(w, r, url.Values{"error": {"login_failed"}})
+			return
+		}
+
+		accountID, err := resolveOIDCAccount(r.Context(), sqlStore, identity)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("OIDC account mapping failed", "err", err)
+			oidcRedirect(w, r, url.Values{"error": {"server_error"}})
+			return
+		}
+
+		userID, roomID := "", ""
+		if st.RoomID != "" {
+			if _, err := sqlStore.GetRoomByID(r.Context(), st.RoomID); err != nil {
+				oidcRedirect(w, r, url.Values{"error": {"room_not_found"}})
+				return
+			}
+			user, err := sqlStore.GetAccountUserInRoom(r.Context(), accountID, st.RoomID)
+			if err != nil {
+				user, err = sqlStore.CreateUser(r.Context(), st.RoomID, oidcDisplayName(identity))
+				if err == nil {
+					err = sqlStore.LinkUserToAccount(r.Context(), accountID, user.UserID, user.RoomID)
+				}
+				if err != nil {
+					logging.FromContext(r.Context()).Error("OIDC room join failed", "room_id", st.RoomID, "err", err)
+					oidcRedirect(w, r, url.Values{"error": {"server_error"}})
+					return
+				}
+			}
+			userID, roomID = user.UserID, user.RoomID
+		}
+
+		tokens, err := createSession(r.Context(), w, sqlStore, userID, roomID, accountID)
+		if err != nil {
+			oidcRedirect(w, r, url.Values{"error": {"server_error"}})
+			return
+		}
+
+		oidcRedirect(w, r, url.Values{
+			"accessToken":  {tokens.AccessToken},
+			"refreshToken": {tokens.RefreshToken},
+			"expiresIn":    {strconv.Itoa(tokens.ExpiresIn)},
+			"roomID":       {roomID},
+		})
+	}
+}
+
+func oidcRedirect(w http.ResponseWriter, r *http.Request, fragment url.Values) {
+	http.Redirect(w, r, oidcPostLoginURL+"#"+fragment.Encode(), http.StatusFound)
+}
+
+// resolveOIDCAccount maps an IdP subject to an account. New subjects are
+// attached to the account with the same verified email, or a new account.
+func resolveOIDCAccount(ctx context.Context, sqlStore *store.SQLStore, identity *sso.Identity) (string, error) {
+	if accountID, err := sqlStore.GetAccountIDByIdentity(ctx, identity.Issuer, identity.Subject); err == nil {
+		return accountID, nil
+	}
+
+	email, ok := normaliseEmail(identity.Email)
+	if ok && identity.EmailVerified {
+		if account, err := sqlStore.GetAccountByEmail(ctx, email); err == nil {
+			return account.AccountID, sqlStore.LinkIdentity(ctx, identity.Issuer, identity.Subject, account.AccountID)
+		}
+	} else {
+		// Accounts are keyed by email; without a verified one, use an address
+		// that cannot collide with a real mailbox.
+		host := identity.Issuer
+		if u, err := url.Parse(identity.Issuer); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		email = identity.Subject + "@oidc." + host
+	}
+
+	account, err := sqlStore.CreateAccount(ctx, email, "")
+	if err != nil {
+		return "", err
+	}
+	return account.AccountID, sqlStore.LinkIdentity(ctx, identity.Issuer, identity.Subject, account.AccountID)
+}
+
+// oidcDisplayName picks the first of the provider's name and the email's
+// local part that passes display name validation.
+func oidcDisplayName(identity *sso.Identity) string {
+	local, _, _ := strings.Cut(identity.Email, "@")
+	for _, candidate := range []string{identity.Name, local} {
+		var v validate.Checker
+		if name := v.DisplayName("displayName", candidate); v.Err() == nil {
+			return name
+		}
+	}
+	return "Guest"
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/service"
+)
+
+var (
+	inviteURL    = "http://localhost:3000/join"
+	inviteTTL    = 7 * 24 * time.Hour
+	maxInviteTTL = 30 * 24 * time.Hour
+)
+
+func GetRoomPolicy(rooms *service.RoomService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID := roomIDParam(r, r.URL.Query().Get("roomID"))
+		policy, err := rooms.Policy(r.Context(), actor(r), roomID)
+		if err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, policy)
+	}
+}
+
+func UpdateRoomPolicy(rooms *service.RoomService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req UpdateRoomPolicyRequest
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			apierr.Respond(w, r, apierr.InvalidBody, "Invalid request body")
+			return
+		}
+		req.RoomID = roomIDParam(r, req.RoomID)
+
+		policy, err := rooms.UpdatePolicy(r.Context(), actor(r), req.RoomID, service.PolicyUpdate{
+			Passcode:        req.Passcode,
+			MaxParticipants: req.MaxParticipants,
+			InviteOnly:      req.InviteOnly,
+			RequireApproval: req.RequireApproval,
+		})
+		if err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, policy)
+	}
+}
+
+func CreateRoomInvite(rooms *service.RoomService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateRoomInviteRequest
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			apierr.Respond(w, r, apierr.InvalidBody, "Invalid request body")
+			return
+		}
+		req.RoomID = roomIDParam(r, req.RoomID)
+
+		ttl := inviteTTL
+		if req.ExpiresIn != 0 {
+			ttl = time.Duration(req.ExpiresIn) * time.Second
+		}
+		if ttl <= 0 || ttl > maxInviteTTL {
+			apierr.Respond(w, r, apierr.ValidationFailed, "expiresIn is out of range")
+			return
+		}
+
+		expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second)
+		token, err := rooms.Invite(r.Context(), actor(r), req.RoomID, expiresAt)
+		if err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+
+		params := url.Values{"roomID": {req.RoomID}, "invite": {token}}
+		writeJSON(w, http.StatusCreated, InviteResponse{
+			Token:     token,
+			URL:       inviteURL + "?" + params.Encode(),
+			ExpiresAt: expiresAt,
+		})
+	}
+}
+
+func GetJoinRequests(rooms *service.RoomService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID := roomIDParam(r, r.URL.Query().Get("roomID"))
+		requests, err := rooms.JoinRequests(r.Context(), actor(r), roomID)
+		if err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, requests)
+	}
+}
@@ -1,15 +1,14 @@
 package handlers
 
-// http requests
-type CreateUserRequest struct {
-	RoomID      string `json:"roomID"`
-	DisplayName string `json:"displayName"`
-}
+import "time"
 
+// http requests
 type CreateUserWithOptionRequest struct {
 	RoomID        string `json:"roomID"`
 	DisplayName   string `json:"displayName"`
 	OptionContent string `json:"optionContent"`
+	Passcode      string `json:"passcode,omitempty"`
+	InviteToken   string `json:"inviteToken,omitempty"`
 }
 
 type CreateRoomRequest struct {
@@ -20,3 +19,60 @@ type CreateAvailabilityRequest struct {
 	RoomID string   `json:"roomID"`
 	Dates  []string `json:"dates"`
 }
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type AccountCredentialsRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+type VerifyMagicLinkRequest struct {
+	Token string `json:"token"`
+}
+
+type ClaimRoomRequest struct {
+	Token string `json:"token"`
+}
+
+// UpdateRoomPolicyRequest changes only the fields that are present. An
+// empty passcode removes it.
+type UpdateRoomPolicyRequest struct {
+	RoomID          string  `json:"roomID"`
+	Passcode        *string `json:"passcode"`
+	MaxParticipants *int    `json:"maxParticipants"`
+	InviteOnly      *bool   `json:"inviteOnly"`
+	RequireApproval *bool   `json:"requireApproval"`
+}
+
+type CreateRoomInviteRequest struct {
+	RoomID    string `json:"roomID"`
+	ExpiresIn int    `json:"expiresIn"`
+}
+
+type OptionRequest struct {
+	Content string `json:"content"`
+}
+
+type VoteRequest struct {
+	OptionID string `json:"optionID"`
+}
+
+// http responses
+type TokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+type InviteResponse struct {
+	Token     string    `json:"token"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
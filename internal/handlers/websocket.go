@@ -1,68 +1,199 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/config"
+	"websocket-chat/internal/logging"
+	"websocket-chat/internal/models"
+	"websocket-chat/internal/service"
 	"websocket-chat/internal/utils"
 	ws "websocket-chat/internal/websocket"
 
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/gorilla/websocket"
 )
 
+const (
+	authSubprotocol  = "access_token"
+	accessCookieName = "access_token"
+)
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
 }
 
-func ServeWS(hub *ws.Hub, w http.ResponseWriter, r *http.Request) {
+var (
+	secureCookies   bool
+	allowQueryToken = true
+	// cookieOrigin reports whether a handshake from origin may authenticate
+	// with the access cookie. Browsers attach the cookie to cross-site
+	// handshakes too and always send Origin, so only origins named in the
+	// configuration may; clients that send no Origin are not browsers.
+	cookieOrigin = func(origin string) bool { return false }
+	authTimeout  = 5 * time.Second
+)
+
+func Configure(cfg *config.Config) {
+	upgrader.CheckOrigin = func(r *http.Request) bool {
+		return cfg.CORS.AllowsOrigin(r.Header.Get("Origin"))
+	}
+	secureCookies = cfg.IsProduction()
+	allowQueryToken = cfg.WebSocket.AllowQueryToken
+	cookieOrigin = func(origin string) bool {
+		return cfg.WebSocket.AllowCookieToken && (origin == "" || cfg.CORS.ListsOrigin(origin))
+	}
+	authTimeout = cfg.WebSocket.AuthTimeout
+	magicLinkURL = cfg.Accounts.MagicLinkURL
+	magicLinkTTL = cfg.Accounts.MagicLinkTTL
+	oidcPostLoginURL = cfg.OIDC.PostLoginURL
+	inviteURL = cfg.Rooms.InviteURL
+	inviteTTL = cfg.Rooms.InviteTTL
+	maxInviteTTL = cfg.Rooms.MaxInviteTTL
+}
+
+// closeCode maps an error's HTTP status onto the 4000-4999 application
+// range so clients authenticating in-band see the same status they would
+// over HTTP.
+func closeCode(err *apierr.Error) int {
+	return 4000 + err.Status()
+}
+
+type connection struct {
+	claims  *utils.Claims
+	room    *models.Room
+	user    *models.User
+	pending bool
+}
+
+// ServeWS accepts the access token from the Sec-WebSocket-Protocol header
+// ("access_token, <jwt>"), the access_token cookie, or, when neither is
+// present, an {"type":"auth","token":"..."} first frame sent after the upgrade.
+func ServeWS(hub *ws.Hub, rooms *service.RoomService, w http.ResponseWriter, r *http.Request) {
 	roomID := r.URL.Query().Get("roomID")
-	tokenString := r.URL.Query().Get("token")
+	tokenString, responseHeader := handshakeToken(r)
 
-	if tokenString == "" {
-		http.Error(w, "Authorization token required", http.StatusUnauthorized)
+	if tokenString == "" && r.URL.Query().Has("token") {
+		apierr.Respond(w, r, apierr.Unauthorized, "Query string tokens are disabled")
 		return
 	}
 
-	claims := &utils.Claims{}
+	if tokenString == "" {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return utils.JwtKey, nil
-	})
+		tokenString, err = readAuthFrame(conn)
+		if err != nil {
+			closeConnection(r.Context(), conn, apierr.New(apierr.Unauthorized, "Authorization token required"))
+			return
+		}
 
-	if err != nil || !token.Valid {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		c, err := authenticateConnection(r.Context(), rooms, roomID, tokenString)
+		if err != nil {
+			closeConnection(r.Context(), conn, err)
+			return
+		}
+		if err := conn.WriteJSON(ws.AuthenticatedMessage{Type: "authenticated", Protocol: ws.ProtocolVersion}); err != nil {
+			conn.Close()
+			return
+		}
+		serveClient(r.Context(), hub, conn, c)
 		return
 	}
 
-	userID := claims.UserID
-
-	room, err := hub.SqlStore.GetRoomByID(roomID)
+	c, err := authenticateConnection(r.Context(), rooms, roomID, tokenString)
 	if err != nil {
-		http.Error(w, "Room not found", http.StatusNotFound)
+		apierr.Write(w, r, err)
 		return
 	}
 
-	user, err := hub.SqlStore.GetUserByID(userID)
+	conn, err := upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
+	serveClient(r.Context(), hub, conn, c)
+}
+
+func handshakeToken(r *http.Request) (string, http.Header) {
+	if protocols := websocket.Subprotocols(r); len(protocols) == 2 && protocols[0] == authSubprotocol {
+		return protocols[1], http.Header{"Sec-Websocket-Protocol": {authSubprotocol}}
+	}
+
+	if cookie, err := r.Cookie(accessCookieName); err == nil && cookie.Value != "" && cookieOrigin(r.Header.Get("Origin")) {
+		return cookie.Value, nil
+	}
+
+	if token := r.URL.Query().Get("token"); token != "" && allowQueryToken {
+		logging.FromContext(r.Context()).Warn("Deprecated: WebSocket token passed in query string", "remote_addr", r.RemoteAddr)
+		return token, http.Header{"Deprecation": {"true"}}
+	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	return "", nil
+}
+
+func readAuthFrame(conn *websocket.Conn) (string, error) {
+	conn.SetReadDeadline(time.Now().Add(authTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	_, data, err := conn.ReadMessage()
 	if err != nil {
-		http.Error(w, "Failed to upgrade to WebSocket", http.StatusInternalServerError)
-		return
+		return "", err
+	}
+
+	if err := ws.ValidateMessage("auth", data); err != nil {
+		return "", fmt.Errorf("expected auth message: %w", err)
+	}
+	var msg ws.AuthMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return "", err
+	}
+	return msg.Token, nil
+}
+
+func authenticateConnection(ctx context.Context, rooms *service.RoomService, roomID, tokenString string) (*connection, error) {
+	claims, err := utils.ParseJWT(tokenString)
+	if err != nil {
+		return nil, apierr.New(apierr.Unauthorized, "Invalid token")
 	}
 
-	client := &ws.Client{
-		Conn:   conn,
-		Send:   make(chan interface{}),
-		RoomID: room.RoomID,
-		User:   user,
+	room, user, pending, err := rooms.Connect(ctx, service.Actor{UserID: claims.UserID, RoomID: claims.RoomID}, roomID)
+	if err != nil {
+		return nil, err
+	}
+	return &connection{claims: claims, room: room, user: user, pending: pending}, nil
+}
+
+func closeConnection(ctx context.Context, conn *websocket.Conn, err error) {
+	e := apierr.Wrap(err, "Internal error")
+	if e.Status() >= http.StatusInternalServerError {
+		logging.FromContext(ctx).Error(e.Message, "code", e.Code, "err", err)
+	}
+	msg := websocket.FormatCloseMessage(closeCode(e), e.Message)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	conn.Close()
+}
+
+func serveClient(ctx context.Context, hub *ws.Hub, conn *websocket.Conn, c *connection) {
+	if c.pending {
+		if err := conn.WriteJSON(ws.JoinStatusMessage{Type: "join_pending"}); err != nil {
+			conn.Close()
+			return
+		}
+	}
+
+	client := ws.NewClient(ctx, conn, c.room.RoomID, c.claims.SessionID, c.user, c.pending)
+	if err := hub.RegisterClient(client); err != nil {
+		conn.Close()
+		return
 	}
-	hub.RegisterClient(client)
 
-	go client.WritePump()
+	go client.WritePump(hub)
 	go client.ReadPump(hub)
 }
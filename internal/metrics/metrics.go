@@ -0,0 +1,81 @@
+// Package metrics defines the Prometheus collectors exported on /metrics.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "whenru3"
+
+var (
+	WSConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ws_connections",
+		Help:      "Open WebSocket connections per room.",
+	}, []string{"room"})
+
+	WSMessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ws_messages_received_total",
+		Help:      "Inbound WebSocket messages by type.",
+	}, []string{"type"})
+
+	WSMessagesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ws_messages_sent_total",
+		Help:      "Outbound WebSocket messages by type.",
+	}, []string{"type"})
+
+	WSDroppedClients = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ws_dropped_clients_total",
+		Help:      "Clients disconnected by the hub because their send buffer was full.",
+	})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	StoreQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "store_query_duration_seconds",
+		Help:      "SQLStore method latency.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method"})
+
+	StoreErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "store_errors_total",
+		Help:      "SQLStore method calls that returned an error.",
+	}, []string{"method"})
+
+	WriteBehindPending = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "write_behind_pending_votes",
+		Help:      "Vote changes applied in memory and waiting to be stored.",
+	})
+
+	WriteBehindFlushErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "write_behind_flush_errors_total",
+		Help:      "Write-behind flushes that failed and will be retried.",
+	})
+)
+
+func ObserveHTTP(route, method string, status int, elapsed time.Duration) {
+	HTTPRequestDuration.WithLabelValues(route, method, strconv.Itoa(status)).Observe(elapsed.Seconds())
+}
+
+func ObserveStore(method string, elapsed time.Duration, err error) {
+	StoreQueryDuration.WithLabelValues(method).Observe(elapsed.Seconds())
+	if err != nil {
+		StoreErrors.WithLabelValues(method).Inc()
+	}
+}
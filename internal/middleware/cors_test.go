@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"websocket-chat/internal/config"
+)
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name        string
+		allowed     []string
+		origin      string
+		wantOrigin  string
+		credentials bool
+	}{
+		{
+			name:        "listed origin",
+			allowed:     []string{"https://app.example.com"},
+			origin:      "https://app.example.com",
+			wantOrigin:  "https://app.example.com",
+			credentials: true,
+		},
+		{
+			name:    "unlisted origin",
+			allowed: []string{"https://app.example.com"},
+			origin:  "https://evil.example",
+		},
+		{
+			name:       "wildcard",
+			allowed:    []string{"*"},
+			origin:     "https://evil.example",
+			wantOrigin: "*",
+		},
+		{
+			name:        "listed origin next to a wildcard",
+			allowed:     []string{"*", "https://app.example.com"},
+			origin:      "https://app.example.com",
+			wantOrigin:  "https://app.example.com",
+			credentials: true,
+		},
+		{
+			name:    "same origin",
+			allowed: []string{"https://app.example.com"},
+		},
+	}
+	for _, tt := range tests {
+		for _, method := range []string{http.MethodOptions, http.MethodPost} {
+			t.Run(tt.name+"/"+method, func(t *testing.T) {
+				handler := CORS(config.CORSConfig{AllowedOrigins: tt.allowed})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusNoContent)
+				}))
+				r := httptest.NewRequest(method, "/api/v1/auth/refresh", nil)
+				if tt.origin != "" {
+					r.Header.Set("Origin", tt.origin)
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+
+				if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+					t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+				}
+				if got := w.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.credentials {
+					t.Errorf("credentials allowed = %v, want %v", got, tt.credentials)
+				}
+			})
+		}
+	}
+}
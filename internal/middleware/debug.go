@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"websocket-chat/internal/apierr"
+)
+
+// RequireDebugToken only lets through requests bearing the operator's debug
+// token. Debug endpoints expose room IDs, which grant access to rooms, so
+// they are not open to room members.
+func RequireDebugToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				apierr.Respond(w, r, apierr.NotFound, "Not found")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Deprecated marks a legacy route's responses with a Deprecation header
+// (RFC 9745) dated since, a Link to its successor and, when sunset is set,
+// the Sunset header (RFC 8594). A {roomID} in the successor is filled from
+// the route or the roomID query parameter; when it cannot be, as for routes
+// that take it in the body, only the link to the API document is sent.
+func Deprecated(successor string, since, sunset time.Time) func(http.Handler) http.Handler {
+	deprecation := fmt.Sprintf("@%d", since.Unix())
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", deprecation)
+			if !sunset.IsZero() {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			w.Header().Add("Link", `</openapi.json>; rel="deprecation"`)
+			if link, ok := successorLink(successor, r); ok {
+				w.Header().Add("Link", "<"+link+`>; rel="successor-version"`)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func successorLink(successor string, r *http.Request) (string, bool) {
+	if !strings.Contains(successor, "{roomID}") {
+		return successor, true
+	}
+	roomID := mux.Vars(r)["roomID"]
+	if roomID == "" {
+		roomID = r.URL.Query().Get("roomID")
+	}
+	if roomID == "" {
+		return "", false
+	}
+	return strings.ReplaceAll(successor, "{roomID}", url.PathEscape(roomID)), true
+}
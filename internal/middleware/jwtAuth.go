@@ -2,35 +2,87 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/logging"
 	"websocket-chat/internal/utils"
+)
+
+type contextKey string
 
-	"github.com/golang-jwt/jwt/v4"
+const (
+	userIDKey    contextKey = "userID"
+	roomIDKey    contextKey = "roomID"
+	sessionIDKey contextKey = "sessionID"
+	accountIDKey contextKey = "accountID"
+	pendingKey   contextKey = "pending"
 )
 
 func JWTAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			apierr.Respond(w, r, apierr.Unauthorized, "Authorization header required")
 			return
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		claims := &utils.Claims{}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return utils.JwtKey, nil
-		})
-
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		claims, err := utils.ParseJWT(tokenString)
+		if errors.Is(err, utils.ErrSessionRevoked) {
+			apierr.Respond(w, r, apierr.Unauthorized, "Session revoked")
+			return
+		}
+		if err != nil {
+			apierr.Respond(w, r, apierr.Unauthorized, "Invalid token")
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "userID", claims.UserID)
-		ctx = context.WithValue(ctx, "roomID", claims.RoomID)
+		ctx := context.WithValue(r.Context(), userIDKey, claims.UserID)
+		ctx = context.WithValue(ctx, roomIDKey, claims.RoomID)
+		ctx = context.WithValue(ctx, sessionIDKey, claims.SessionID)
+		ctx = context.WithValue(ctx, accountIDKey, claims.AccountID)
+		ctx = context.WithValue(ctx, pendingKey, claims.Pending)
+		ctx = logging.NewContext(ctx, logging.FromContext(ctx).With("user_id", claims.UserID, "account_id", claims.AccountID))
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+func UserIDFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDKey).(string)
+	return userID
+}
+
+func RoomIDFromContext(ctx context.Context) string {
+	roomID, _ := ctx.Value(roomIDKey).(string)
+	return roomID
+}
+
+func SessionIDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionIDKey).(string)
+	return sessionID
+}
+
+func AccountIDFromContext(ctx context.Context) string {
+	accountID, _ := ctx.Value(accountIDKey).(string)
+	return accountID
+}
+
+// PendingFromContext reports whether the caller is still waiting for the
+// host to approve their join request.
+func PendingFromContext(ctx context.Context) bool {
+	pending, _ := ctx.Value(pendingKey).(bool)
+	return pending
+}
+
+// RequireAccount only lets through tokens issued to an account.
+func RequireAccount(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if AccountIDFromContext(r.Context()) == "" {
+			apierr.Respond(w, r, apierr.Forbidden, "Account token required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
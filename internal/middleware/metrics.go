@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+	"websocket-chat/internal/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// Metrics records request latency labelled by route template rather than
+// path, so IDs in URLs do not create new series. Install it with
+// router.Use so the matched route is known.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		metrics.ObserveHTTP(route, r.Method, rec.status, time.Since(start))
+	})
+}
+
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if tmpl, err := current.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/config"
+	"websocket-chat/internal/logging"
+	"websocket-chat/internal/ratelimit"
+
+	"github.com/gorilla/mux"
+)
+
+// maxPeekBody bounds how much of a request body RoomKey will buffer.
+const maxPeekBody = 1 << 20
+
+// KeyFunc picks the bucket a request is counted against. An empty key
+// leaves the request unlimited.
+type KeyFunc func(r *http.Request) string
+
+// RateLimit answers 429 with a Retry-After header once the caller's bucket
+// for this rule is empty. Limiter errors are logged and let the request
+// through rather than turning a store outage into an API outage.
+func RateLimit(limiter ratelimit.Limiter, rule string, rate config.Rate, key KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil || rate.Unlimited() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ok, wait, err := limiter.Allow(r.Context(), rule+":"+k, rate)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("Rate limiter failed, allowing request", "rule", rule, "err", err)
+			}
+			if err == nil && !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(ratelimit.RetryAfterSeconds(wait)))
+				apierr.Respond(w, r, apierr.RateLimited, "Too many requests")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP keys requests by the caller's IP. header names a list header,
+// such as X-Forwarded-For, that each of hops trusted proxies appends the
+// address it saw to. The address hops entries from the right is used, as the
+// entries left of it are whatever the client sent.
+func ClientIP(header string, hops int) KeyFunc {
+	return func(r *http.Request) string {
+		if header != "" {
+			var addrs []string
+			for _, v := range r.Header.Values(header) {
+				addrs = append(addrs, strings.Split(v, ",")...)
+			}
+			if len(addrs) > 0 {
+				return strings.TrimSpace(addrs[max(len(addrs)-hops, 0)])
+			}
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	}
+}
+
+// UserKey keys authenticated requests by room identity or account. It must
+// run after JWTAuthMiddleware.
+func UserKey(r *http.Request) string {
+	if userID := UserIDFromContext(r.Context()); userID != "" {
+		return "user:" + userID
+	}
+	if accountID := AccountIDFromContext(r.Context()); accountID != "" {
+		return "account:" + accountID
+	}
+	return ""
+}
+
+// RoomKey keys requests by the room they target, taken from the route, the
+// query string or a roomID field in a JSON body.
+func RoomKey(r *http.Request) string {
+	if roomID := mux.Vars(r)["roomID"]; roomID != "" {
+		return roomID
+	}
+	if roomID := r.URL.Query().Get("roomID"); roomID != "" {
+		return roomID
+	}
+	if r.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPeekBody))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var req struct {
+		RoomID string `json:"roomID"`
+	}
+	json.Unmarshal(body, &req)
+	return req.RoomID
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		hops   int
+		values []string
+		want   string
+	}{
+		{name: "no header configured", values: []string{"203.0.113.9"}, want: "192.0.2.1"},
+		{name: "header missing", header: "X-Forwarded-For", hops: 1, want: "192.0.2.1"},
+		{name: "one proxy", header: "X-Forwarded-For", hops: 1, values: []string{"198.51.100.7"}, want: "198.51.100.7"},
+		{name: "one proxy, spoofed entry", header: "X-Forwarded-For", hops: 1, values: []string{"203.0.113.9, 198.51.100.7"}, want: "198.51.100.7"},
+		{name: "one proxy, other spoofed entry", header: "X-Forwarded-For", hops: 1, values: []string{"203.0.113.10, 198.51.100.7"}, want: "198.51.100.7"},
+		{name: "two proxies", header: "X-Forwarded-For", hops: 2, values: []string{"203.0.113.9, 198.51.100.7, 10.0.0.2"}, want: "198.51.100.7"},
+		{name: "two proxies, repeated header", header: "X-Forwarded-For", hops: 2, values: []string{"203.0.113.9", "198.51.100.7, 10.0.0.2"}, want: "198.51.100.7"},
+		{name: "fewer entries than proxies", header: "X-Forwarded-For", hops: 3, values: []string{"198.51.100.7, 10.0.0.2"}, want: "198.51.100.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v1/rooms", nil)
+			r.RemoteAddr = "192.0.2.1:4321"
+			for _, v := range tt.values {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := ClientIP(tt.header, tt.hops)(r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type Account struct {
+	AccountID    string    `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type AccountRoom struct {
+	RoomID      string `json:"roomId"`
+	RoomName    string `json:"roomName"`
+	UserID      string `json:"userId"`
+	DisplayName string `json:"displayName"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// AvailabilityChange is what replacing a user's availability changed.
+type AvailabilityChange struct {
+	UserID  string   `json:"userID"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// Empty reports whether the replacement left the availability as it was.
+func (c *AvailabilityChange) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0
+}
@@ -0,0 +1,24 @@
+package models
+
+type RoomPolicy struct {
+	RoomID          string `json:"roomId"`
+	HostUserID      string `json:"hostUserId"`
+	PasscodeHash    string `json:"-"`
+	HasPasscode     bool   `json:"hasPasscode"`
+	MaxParticipants int    `json:"maxParticipants"`
+	InviteOnly      bool   `json:"inviteOnly"`
+	RequireApproval bool   `json:"requireApproval"`
+}
+
+const (
+	JoinPending  = "pending"
+	JoinApproved = "approved"
+	JoinDenied   = "denied"
+)
+
+type JoinRequest struct {
+	UserID      string `json:"userId"`
+	RoomID      string `json:"roomId"`
+	DisplayName string `json:"displayName"`
+	Status      string `json:"status"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type Session struct {
+	SessionID string     `json:"id"`
+	UserID    string     `json:"userId"`
+	RoomID    string     `json:"roomId"`
+	AccountID string     `json:"accountId,omitempty"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
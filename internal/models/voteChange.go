@@ -0,0 +1,10 @@
+package models
+
+// VoteChange sets a user's vote in a room, or retracts it when OptionID is
+// empty. VoteID identifies the vote once it is stored.
+type VoteChange struct {
+	VoteID   string `json:"voteId"`
+	RoomID   string `json:"roomId"`
+	UserID   string `json:"userId"`
+	OptionID string `json:"optionId,omitempty"`
+}
@@ -0,0 +1,203 @@
+// Package openapi embeds the OpenAPI document for the REST API and checks
+// it against the router, so the document cannot drift from the routes that
+// are actually served.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+//go:embed openapi.json
+var Spec []byte
+
+type Document struct {
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Components struct {
+	Schemas    map[string]*Schema   `json:"schemas"`
+	Parameters map[string]Parameter `json:"parameters"`
+	Responses  map[string]Response  `json:"responses"`
+}
+
+// PathItem holds a path's operations. Optional paths are only served with
+// some configurations, such as the OIDC login routes.
+type PathItem struct {
+	Optional bool       `json:"x-optional"`
+	Get      *Operation `json:"get"`
+	Put      *Operation `json:"put"`
+	Post     *Operation `json:"post"`
+	Delete   *Operation `json:"delete"`
+	Patch    *Operation `json:"patch"`
+}
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Deprecated  bool                  `json:"deprecated"`
+	Security    []map[string][]string `json:"security"`
+	Parameters  []Parameter           `json:"parameters"`
+	RequestBody *RequestBody          `json:"requestBody"`
+	Responses   map[string]Response   `json:"responses"`
+}
+
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Ref         string               `json:"$ref"`
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Description          string             `json:"description"`
+	Enum                 []string           `json:"enum"`
+	Nullable             bool               `json:"nullable"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*Schema `json:"properties"`
+	Items                *Schema            `json:"items"`
+	AdditionalProperties *Schema            `json:"additionalProperties"`
+}
+
+func Parse() (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(Spec, &doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	return &doc, nil
+}
+
+// Operations returns the path's operations keyed by HTTP method.
+func (p PathItem) Operations() map[string]*Operation {
+	ops := make(map[string]*Operation)
+	for method, op := range map[string]*Operation{
+		http.MethodGet:    p.Get,
+		http.MethodPut:    p.Put,
+		http.MethodPost:   p.Post,
+		http.MethodDelete: p.Delete,
+		http.MethodPatch:  p.Patch,
+	} {
+		if op != nil {
+			ops[method] = op
+		}
+	}
+	return ops
+}
+
+// Parameter resolves a reference to a shared parameter.
+func (d *Document) Parameter(p Parameter) Parameter {
+	if name, ok := strings.CutPrefix(p.Ref, "#/components/parameters/"); ok {
+		return d.Components.Parameters[name]
+	}
+	return p
+}
+
+func Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Write(Spec)
+	}
+}
+
+// CheckRoutes reports routes the document does not describe and documented
+// operations the router does not serve. Routes under the skip prefixes are
+// operator endpoints kept out of the public document.
+func CheckRoutes(router *mux.Router, skip ...string) error {
+	doc, err := Parse()
+	if err != nil {
+		return err
+	}
+
+	served := make(map[string]bool)
+	err = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		if slices.ContainsFunc(skip, func(prefix string) bool { return strings.HasPrefix(path, prefix) }) {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Routes without a method matcher, such as /ws, are documented
+			// as GET.
+			methods = []string{http.MethodGet}
+		}
+		for _, method := range methods {
+			served[method+" "+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	documented := make(map[string]bool)
+	for path, item := range doc.Paths {
+		for method := range item.Operations() {
+			key := method + " " + path
+			documented[key] = true
+			if !served[key] && !item.Optional {
+				errs = append(errs, fmt.Errorf("%s is documented but not routed", key))
+			}
+		}
+	}
+	for key := range served {
+		if !documented[key] {
+			errs = append(errs, fmt.Errorf("%s is routed but not documented", key))
+		}
+	}
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
+
+// CheckEnum reports whether a schema property lists exactly values, so enums
+// copied from Go constants into the document cannot drift.
+func CheckEnum(schema, property string, values []string) error {
+	doc, err := Parse()
+	if err != nil {
+		return err
+	}
+	s, ok := doc.Components.Schemas[schema]
+	if !ok || s.Properties[property] == nil {
+		return fmt.Errorf("%s.%s is not documented", schema, property)
+	}
+	documented := slices.Sorted(slices.Values(s.Properties[property].Enum))
+	want := slices.Sorted(slices.Values(values))
+	if !slices.Equal(documented, want) {
+		return fmt.Errorf("%s.%s documents %v, want %v", schema, property, documented, want)
+	}
+	return nil
+}
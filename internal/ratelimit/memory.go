@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+	"websocket-chat/internal/config"
+)
+
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	fullAt  time.Time
+}
+
+// MemoryLimiter keeps buckets in process memory. Each instance enforces its
+// own quotas, so limits multiply with the number of instances.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemoryLimiter) Allow(ctx context.Context, key string, rate config.Rate) (bool, time.Duration, error) {
+	now := time.Now()
+	capacity := float64(rate.Count)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = min(capacity, b.tokens+now.Sub(b.updated).Seconds()*refillPerSecond(rate))
+	b.updated = now
+	if b.tokens < 1 {
+		return false, retryAfter(b.tokens, rate), nil
+	}
+
+	b.tokens--
+	b.fullAt = now.Add(time.Duration((capacity - b.tokens) / refillPerSecond(rate) * float64(time.Second)))
+	return true, 0, nil
+}
+
+// sweep forgets buckets that have refilled completely, since a missing
+// bucket behaves exactly like a full one.
+func (m *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if now.After(b.fullAt) {
+			delete(m.buckets, key)
+		}
+	}
+}
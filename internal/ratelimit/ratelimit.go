@@ -0,0 +1,58 @@
+// Package ratelimit implements token bucket quotas shared by the HTTP
+// middleware and the WebSocket read loop.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+	"websocket-chat/internal/config"
+	"websocket-chat/internal/store"
+)
+
+type Limiter interface {
+	// Allow takes a token from the bucket named key. When the bucket is
+	// empty it returns false and how long until a token is available.
+	Allow(ctx context.Context, key string, rate config.Rate) (bool, time.Duration, error)
+}
+
+// New returns the limiter configured by cfg, or nil when rate limiting is
+// disabled. A nil Limiter allows everything.
+func New(cfg config.RateLimitConfig, sqlStore *store.SQLStore) (Limiter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	switch cfg.Store {
+	case "memory":
+		return NewMemoryLimiter(), nil
+	case "sql":
+		return NewStoreLimiter(sqlStore), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", cfg.Store)
+	}
+}
+
+// Allow is Limiter.Allow that tolerates a nil limiter and unlimited rates.
+func Allow(ctx context.Context, limiter Limiter, key string, rate config.Rate) (bool, time.Duration, error) {
+	if limiter == nil || rate.Unlimited() {
+		return true, 0, nil
+	}
+	return limiter.Allow(ctx, key, rate)
+}
+
+// RetryAfterSeconds rounds a wait up to whole seconds, as Retry-After needs.
+func RetryAfterSeconds(wait time.Duration) int {
+	return max(1, int(math.Ceil(wait.Seconds())))
+}
+
+// refillPerSecond is how many tokens a bucket regains each second.
+func refillPerSecond(rate config.Rate) float64 {
+	return float64(rate.Count) / rate.Per.Seconds()
+}
+
+// retryAfter is how long a bucket holding tokens needs to reach one token.
+func retryAfter(tokens float64, rate config.Rate) time.Duration {
+	wait := (1 - tokens) / refillPerSecond(rate)
+	return time.Duration(math.Ceil(wait * float64(time.Second)))
+}
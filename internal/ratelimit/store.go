@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+	"websocket-chat/internal/config"
+	"websocket-chat/internal/store"
+)
+
+const (
+	pruneInterval = 10 * time.Minute
+	// Buckets idle this long are deleted. Quotas with longer periods than
+	// this refill early.
+	pruneAfter = 24 * time.Hour
+)
+
+// StoreLimiter keeps buckets in the database so every instance draws from
+// the same quota.
+type StoreLimiter struct {
+	store *store.SQLStore
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+func NewStoreLimiter(sqlStore *store.SQLStore) *StoreLimiter {
+	return &StoreLimiter{store: sqlStore, lastPrune: time.Now()}
+}
+
+func (s *StoreLimiter) Allow(ctx context.Context, key string, rate config.Rate) (bool, time.Duration, error) {
+	now := time.Now()
+	s.prune(now)
+
+	refillPerMs := refillPerSecond(rate) / 1000
+	ok, tokens, err := s.store.TakeRateLimitToken(ctx, key, float64(rate.Count), refillPerMs, now)
+	if err != nil || ok {
+		return ok, 0, err
+	}
+	return false, retryAfter(tokens, rate), nil
+}
+
+func (s *StoreLimiter) prune(now time.Time) {
+	s.mu.Lock()
+	due := now.Sub(s.lastPrune) >= pruneInterval
+	if due {
+		s.lastPrune = now
+	}
+	s.mu.Unlock()
+
+	if due {
+		go func() {
+			if err := s.store.PruneRateLimits(context.Background(), now.Add(-pruneAfter)); err != nil {
+				slog.Error("Failed to prune rate limits", "err", err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/models"
+	"websocket-chat/internal/validate"
+)
+
+// AvailabilityService manages the dates participants are available on.
+type AvailabilityService struct {
+	store  Store
+	events *events
+}
+
+// Replace sets the actor's available dates to dates atomically and tells
+// the room which dates were added and removed. Replacing with the dates
+// already held changes nothing and sends nothing, so clients can retry.
+func (s *AvailabilityService) Replace(ctx context.Context, actor Actor, roomID string, dates []string) (*models.AvailabilityChange, error) {
+	var v validate.Checker
+	v.Required("roomID", roomID)
+	dates = v.Dates("dates", dates)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	if err := actor.authorize(roomID); err != nil {
+		return nil, err
+	}
+
+	change, err := s.store.ReplaceUserAvailability(ctx, roomID, actor.UserID, dates)
+	if err != nil {
+		return nil, apierr.Wrap(err, "Failed to save availability")
+	}
+	if !change.Empty() {
+		s.events.dates.invalidate(roomID)
+		s.events.notify.AvailabilityChanged(ctx, roomID, *change)
+	}
+	return change, nil
+}
+
+// Dates lists who is available on each date in the room.
+func (s *AvailabilityService) Dates(ctx context.Context, actor Actor, roomID string) (*models.RoomDatesResponse, error) {
+	if err := actor.authorize(roomID); err != nil {
+		return nil, err
+	}
+	return s.events.roomDates(ctx, roomID)
+}
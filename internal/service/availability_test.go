@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/models"
+)
+
+func TestReplaceAvailability(t *testing.T) {
+	f := newFixture(t, models.RoomPolicy{})
+
+	// Each step replaces the host's dates with the previous step's in place.
+	steps := []struct {
+		name    string
+		dates   []string
+		want    apierr.Code
+		added   []string
+		removed []string
+	}{
+		{name: "first dates", dates: []string{"2026-11-02", "2026-11-01", "2026-11-01"}, added: []string{"2026-11-01", "2026-11-02"}},
+		{name: "same dates again", dates: []string{"2026-11-01", "2026-11-02"}},
+		{name: "swap one date", dates: []string{"2026-11-01", "2026-11-03"}, added: []string{"2026-11-03"}, removed: []string{"2026-11-02"}},
+		{name: "invalid date", dates: []string{"next friday"}, want: apierr.ValidationFailed},
+		{name: "missing dates", dates: nil, want: apierr.ValidationFailed},
+		{name: "clear", dates: []string{}, removed: []string{"2026-11-01", "2026-11-03"}},
+	}
+	for _, step := range steps {
+		notified := len(f.notify.availability)
+		change, err := f.svc.Availability.Replace(context.Background(), f.host, f.roomID, step.dates)
+		if got := code(err); got != step.want {
+			t.Fatalf("%s: Replace error = %v, want code %q", step.name, err, step.want)
+		}
+		if err != nil {
+			continue
+		}
+		if !slices.Equal(change.Added, step.added) || !slices.Equal(change.Removed, step.removed) {
+			t.Errorf("%s: change = +%v -%v, want +%v -%v", step.name, change.Added, change.Removed, step.added, step.removed)
+		}
+		if sent := len(f.notify.availability) > notified; sent == change.Empty() {
+			t.Errorf("%s: notified = %v for change %+v", step.name, sent, change)
+		}
+	}
+
+	dates, err := f.svc.Availability.Dates(context.Background(), f.host, f.roomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dates.Dates) != 0 {
+		t.Errorf("dates after clearing = %v, want none", dates.Dates)
+	}
+}
+
+func TestReplaceAvailabilityPermissions(t *testing.T) {
+	tests := []struct {
+		name  string
+		actor func(f *fixture) Actor
+		want  apierr.Code
+	}{
+		{
+			name: "waiting for approval",
+			actor: func(f *fixture) Actor {
+				f.store.policies[f.roomID] = models.RoomPolicy{RoomID: f.roomID, HostUserID: f.host.UserID, RequireApproval: true}
+				return f.join(t, "Ana", "")
+			},
+			want: apierr.PendingApproval,
+		},
+		{
+			name:  "participant of another room",
+			actor: func(f *fixture) Actor { return f.otherRoom(t) },
+			want:  apierr.Forbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, models.RoomPolicy{})
+			_, err := f.svc.Availability.Replace(context.Background(), tt.actor(f), f.roomID, []string{"2026-11-01"})
+			if got := code(err); got != tt.want {
+				t.Fatalf("Replace error = %v, want code %q", err, tt.want)
+			}
+			if len(f.store.dates) != 0 {
+				t.Errorf("refused replacement was stored: %v", f.store.dates)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// roomCache keeps one value per room in memory between changes. The
+// services invalidate a room after every write to it; the TTL bounds how
+// long an entry can miss writes made through other instances. A zero TTL
+// disables the cache.
+type roomCache[T any] struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[string]*cacheEntry[T]
+	lastSweep time.Time
+}
+
+// cacheEntry holds a room's value until it expires. generation counts
+// invalidations, so a load that raced with a write is not cached; loads
+// counts the loads under way, which keep the entry from being swept.
+type cacheEntry[T any] struct {
+	generation uint64
+	loads      int
+	value      T
+	loaded     bool
+	expires    time.Time
+}
+
+// maxLoads bounds how many times get loads a value that keeps being
+// invalidated while it loads.
+const maxLoads = 3
+
+func newRoomCache[T any]() *roomCache[T] {
+	return &roomCache[T]{entries: make(map[string]*cacheEntry[T])}
+}
+
+func (c *roomCache[T]) setTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+// get returns the room's cached value, calling load on a miss. A load the
+// room was invalidated during may have read the store from before that
+// write, so it is loaded again, up to maxLoads times in all; the last load
+// is returned uncached. Loads are tracked like this with the cache
+// disabled too, so callers never get a value older than a write that
+// finished before get returned.
+func (c *roomCache[T]) get(ctx context.Context, roomID string, load func(context.Context, string) (T, error)) (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if c.ttl > 0 && now.Sub(c.lastSweep) > c.ttl {
+		c.sweep(now)
+	}
+	entry, ok := c.entries[roomID]
+	if !ok {
+		entry = &cacheEntry[T]{}
+		c.entries[roomID] = entry
+	}
+	if entry.loaded && now.Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	entry.loads++
+	defer func() {
+		entry.loads--
+		if c.ttl <= 0 && entry.loads == 0 && c.entries[roomID] == entry {
+			delete(c.entries, roomID)
+		}
+	}()
+	for attempt := 1; ; attempt++ {
+		generation := entry.generation
+		c.mu.Unlock()
+		value, err := load(ctx, roomID)
+		c.mu.Lock()
+		if err != nil || c.entries[roomID] != entry {
+			return value, err
+		}
+		if entry.generation == generation {
+			if c.ttl > 0 {
+				entry.value, entry.loaded, entry.expires = value, true, time.Now().Add(c.ttl)
+			}
+			return value, nil
+		}
+		if attempt == maxLoads {
+			return value, nil
+		}
+	}
+}
+
+// sweep drops expired entries, so rooms nobody reads any more do not stay
+// in memory. Entries with loads under way are kept.
+func (c *roomCache[T]) sweep(now time.Time) {
+	c.lastSweep = now
+	for roomID, entry := range c.entries {
+		if entry.loads == 0 && !now.Before(entry.expires) {
+			delete(c.entries, roomID)
+		}
+	}
+}
+
+// invalidate drops the room's value, and any load already under way.
+func (c *roomCache[T]) invalidate(roomID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[roomID]
+	if !ok {
+		return
+	}
+	var zero T
+	entry.generation++
+	entry.value, entry.loaded = zero, false
+}
+
+// forget removes a deleted room.
+func (c *roomCache[T]) forget(roomID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, roomID)
+}
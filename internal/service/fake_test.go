@@ -0,0 +1,589 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"websocket-chat/internal/models"
+	"websocket-chat/internal/store"
+)
+
+// fakeStore is an in-memory Store with the same rules as the SQL store:
+// users waiting for approval are left out of the room state, deleting an
+// option deletes its votes and each user holds at most one vote.
+type fakeStore struct {
+	mu       sync.Mutex
+	rooms    map[string]models.Room
+	users    map[string]models.User
+	policies map[string]models.RoomPolicy
+	joins    map[string]string
+	options  map[string]models.Option
+	votes    map[string]models.Vote
+	dates    map[string][]string
+	// joined lists user IDs in the order they joined.
+	joined []string
+	// afterLoad, when set, runs once after GetFullRoomState has read the
+	// room, before it returns.
+	afterLoad func()
+}
+
+var _ Store = (*fakeStore)(nil)
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		rooms:    make(map[string]models.Room),
+		users:    make(map[string]models.User),
+		policies: make(map[string]models.RoomPolicy),
+		joins:    make(map[string]string),
+		options:  make(map[string]models.Option),
+		votes:    make(map[string]models.Vote),
+		dates:    make(map[string][]string),
+	}
+}
+
+// fakeIDs is shared by every fake store so fixtures never hand out the same
+// ID for different rooms.
+var fakeIDs atomic.Int64
+
+func (f *fakeStore) id(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, fakeIDs.Add(1))
+}
+
+func (f *fakeStore) approved(userID string) bool {
+	status, ok := f.joins[userID]
+	return !ok || status == models.JoinApproved
+}
+
+func (f *fakeStore) CreateRoom(_ context.Context, name string) (*models.Room, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	room := models.Room{RoomID: f.id("room"), Name: name}
+	f.rooms[room.RoomID] = room
+	return &room, nil
+}
+
+func (f *fakeStore) GetRoomByID(_ context.Context, roomID string) (*models.Room, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	room, ok := f.rooms[roomID]
+	if !ok {
+		return nil, store.ErrRoomNotFound
+	}
+	return &room, nil
+}
+
+func (f *fakeStore) DeleteRoom(_ context.Context, roomID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.rooms[roomID]; !ok {
+		return store.ErrRoomNotFound
+	}
+	delete(f.rooms, roomID)
+	for userID, user := range f.users {
+		if user.RoomID == roomID {
+			f.deleteUser(userID)
+		}
+	}
+	delete(f.policies, roomID)
+	return nil
+}
+
+func (f *fakeStore) GetFullRoomState(_ context.Context, roomID string) (*store.FullRoomStateMessage, error) {
+	state, err := f.fullRoomState(roomID)
+	f.mu.Lock()
+	afterLoad := f.afterLoad
+	f.afterLoad = nil
+	f.mu.Unlock()
+	if afterLoad != nil {
+		afterLoad()
+	}
+	return state, err
+}
+
+func (f *fakeStore) fullRoomState(roomID string) (*store.FullRoomStateMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	room, ok := f.rooms[roomID]
+	if !ok {
+		return nil, store.ErrRoomNotFound
+	}
+	state := &store.FullRoomStateMessage{RoomName: room.Name, Users: []models.User{}, Options: []models.Option{}, Votes: []models.Vote{}}
+	for _, user := range f.users {
+		if user.RoomID == roomID && f.approved(user.UserID) {
+			state.Users = append(state.Users, user)
+		}
+	}
+	for _, option := range f.options {
+		if option.RoomID == roomID && f.approved(option.UserID) {
+			state.Options = append(state.Options, option)
+		}
+	}
+	for _, vote := range f.votes {
+		if option, ok := f.options[vote.OptionID]; ok && option.RoomID == roomID {
+			state.Votes = append(state.Votes, vote)
+		}
+	}
+	slices.SortFunc(state.Users, func(a, b models.User) int { return strings.Compare(a.UserID, b.UserID) })
+	slices.SortFunc(state.Options, func(a, b models.Option) int { return strings.Compare(a.OptionID, b.OptionID) })
+	slices.SortFunc(state.Votes, func(a, b models.Vote) int { return strings.Compare(a.UserID, b.UserID) })
+	return state, nil
+}
+
+func (f *fakeStore) GetUserByID(_ context.Context, userID string) (*models.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	user, ok := f.users[userID]
+	if !ok {
+		return nil, store.ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (f *fakeStore) ChangeUserName(_ context.Context, userID, roomID, newName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	user, ok := f.users[userID]
+	if !ok || user.RoomID != roomID {
+		return store.ErrUserNotFound
+	}
+	user.DisplayName = newName
+	f.users[userID] = user
+	return nil
+}
+
+func (f *fakeStore) DeleteUser(_ context.Context, roomID, userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user, ok := f.users[userID]; !ok || user.RoomID != roomID {
+		return store.ErrUserNotFound
+	}
+	f.deleteUser(userID)
+	if policy, ok := f.policies[roomID]; ok && policy.HostUserID == userID {
+		policy.HostUserID = ""
+		for _, id := range f.joined {
+			if user, ok := f.users[id]; ok && user.RoomID == roomID && f.approved(id) {
+				policy.HostUserID = id
+				break
+			}
+		}
+		f.policies[roomID] = policy
+	}
+	return nil
+}
+
+func (f *fakeStore) deleteUser(userID string) {
+	delete(f.users, userID)
+	delete(f.joins, userID)
+	delete(f.votes, userID)
+	for optionID, option := range f.options {
+		if option.UserID == userID {
+			f.deleteOption(optionID)
+		}
+	}
+	for key := range f.dates {
+		if strings.HasSuffix(key, "/"+userID) {
+			delete(f.dates, key)
+		}
+	}
+}
+
+func (f *fakeStore) GetUsersByRoomID(_ context.Context, roomID string) ([]models.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var users []models.User
+	for _, user := range f.users {
+		if user.RoomID == roomID && f.approved(user.UserID) {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (f *fakeStore) GetAccountUserInRoom(context.Context, string, string) (*models.User, error) {
+	return nil, store.ErrUserNotFound
+}
+
+func (f *fakeStore) JoinRoom(_ context.Context, p store.NewParticipant) (*models.User, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	policy := f.policies[p.RoomID]
+	if policy.MaxParticipants > 0 {
+		count := 0
+		for _, user := range f.users {
+			if user.RoomID == p.RoomID && f.joins[user.UserID] != models.JoinDenied {
+				count++
+			}
+		}
+		if count >= policy.MaxParticipants {
+			return nil, false, store.ErrRoomFull
+		}
+	}
+
+	user := models.User{UserID: f.id("user"), RoomID: p.RoomID, DisplayName: p.DisplayName}
+	f.users[user.UserID] = user
+	f.joined = append(f.joined, user.UserID)
+	if policy.HostUserID == "" && !policy.RequireApproval {
+		policy.RoomID = p.RoomID
+		policy.HostUserID = user.UserID
+		f.policies[p.RoomID] = policy
+	}
+	pending := policy.RequireApproval && policy.HostUserID != user.UserID
+	if pending {
+		f.joins[user.UserID] = models.JoinPending
+	}
+	if p.OptionContent != "" {
+		option := models.Option{OptionID: f.id("option"), RoomID: p.RoomID, UserID: user.UserID, Content: p.OptionContent}
+		f.options[option.OptionID] = option
+	}
+	return &user, pending, nil
+}
+
+func (f *fakeStore) GetRoomPolicy(_ context.Context, roomID string) (*models.RoomPolicy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	policy := f.policies[roomID]
+	policy.RoomID = roomID
+	policy.HasPasscode = policy.PasscodeHash != ""
+	return &policy, nil
+}
+
+func (f *fakeStore) SaveRoomPolicy(_ context.Context, policy *models.RoomPolicy) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.policies[policy.RoomID] = *policy
+	return nil
+}
+
+func (f *fakeStore) GetJoinStatus(_ context.Context, userID string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if status, ok := f.joins[userID]; ok {
+		return status, nil
+	}
+	return models.JoinApproved, nil
+}
+
+func (f *fakeStore) DecideJoinRequest(_ context.Context, roomID, userID, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.joins[userID] != models.JoinPending || f.users[userID].RoomID != roomID {
+		return store.ErrJoinRequestNotFound
+	}
+	f.joins[userID] = status
+	return nil
+}
+
+func (f *fakeStore) GetPendingJoinRequests(_ context.Context, roomID string) ([]models.JoinRequest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var requests []models.JoinRequest
+	for userID, status := range f.joins {
+		if user := f.users[userID]; user.RoomID == roomID && status == models.JoinPending {
+			requests = append(requests, models.JoinRequest{UserID: userID, RoomID: roomID, DisplayName: user.DisplayName, Status: status})
+		}
+	}
+	return requests, nil
+}
+
+func (f *fakeStore) ChangeOption(_ context.Context, userID, roomID, newContent string) (*models.Option, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for optionID, option := range f.options {
+		if option.UserID == userID {
+			option.Content = newContent
+			f.options[optionID] = option
+			return &option, nil
+		}
+	}
+	option := models.Option{OptionID: f.id("option"), RoomID: roomID, UserID: userID, Content: newContent}
+	f.options[option.OptionID] = option
+	return &option, nil
+}
+
+func (f *fakeStore) GetOption(_ context.Context, optionID string) (*models.Option, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	option, ok := f.options[optionID]
+	if !ok {
+		return nil, store.ErrOptionNotFound
+	}
+	return &option, nil
+}
+
+func (f *fakeStore) UpdateOption(_ context.Context, optionID, content string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	option, ok := f.options[optionID]
+	if !ok {
+		return store.ErrOptionNotFound
+	}
+	option.Content = content
+	f.options[optionID] = option
+	return nil
+}
+
+func (f *fakeStore) DeleteOption(_ context.Context, optionID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.options[optionID]; !ok {
+		return store.ErrOptionNotFound
+	}
+	f.deleteOption(optionID)
+	return nil
+}
+
+func (f *fakeStore) deleteOption(optionID string) {
+	delete(f.options, optionID)
+	for userID, vote := range f.votes {
+		if vote.OptionID == optionID {
+			delete(f.votes, userID)
+		}
+	}
+}
+
+func (f *fakeStore) GetOptionsByRoomID(_ context.Context, roomID string) ([]models.Option, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var options []models.Option
+	for _, option := range f.options {
+		if option.RoomID == roomID {
+			options = append(options, option)
+		}
+	}
+	return options, nil
+}
+
+func (f *fakeStore) ChangeVote(_ context.Context, userID, newOptionID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.options[newOptionID]; !ok {
+		return store.ErrOptionNotFound
+	}
+	f.votes[userID] = models.Vote{VoteID: f.id("vote"), OptionID: newOptionID, UserID: userID}
+	return nil
+}
+
+func (f *fakeStore) GetVote(_ context.Context, voteID string) (*models.Vote, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, vote := range f.votes {
+		if vote.VoteID == voteID {
+			return &vote, nil
+		}
+	}
+	return nil, store.ErrVoteNotFound
+}
+
+func (f *fakeStore) DeleteUserVote(_ context.Context, userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.votes[userID]; !ok {
+		return store.ErrVoteNotFound
+	}
+	delete(f.votes, userID)
+	return nil
+}
+
+func (f *fakeStore) GetVotesByRoomID(_ context.Context, roomID string) ([]models.Vote, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var votes []models.Vote
+	for _, vote := range f.votes {
+		if f.options[vote.OptionID].RoomID == roomID {
+			votes = append(votes, vote)
+		}
+	}
+	return votes, nil
+}
+
+// ApplyVoteChanges stores buffered vote changes, as the write-behind buffer
+// does on a flush.
+func (f *fakeStore) ApplyVoteChanges(_ context.Context, changes []models.VoteChange) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, change := range changes {
+		delete(f.votes, change.UserID)
+		if change.OptionID != "" {
+			f.votes[change.UserID] = models.Vote{VoteID: change.VoteID, OptionID: change.OptionID, UserID: change.UserID}
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) ReplaceUserAvailability(_ context.Context, roomID, userID string, dates []string) (*models.AvailabilityChange, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := roomID + "/" + userID
+	current := f.dates[key]
+	change := &models.AvailabilityChange{UserID: userID}
+	for _, date := range dates {
+		if !slices.Contains(current, date) {
+			change.Added = append(change.Added, date)
+		}
+	}
+	for _, date := range current {
+		if !slices.Contains(dates, date) {
+			change.Removed = append(change.Removed, date)
+		}
+	}
+	f.dates[key] = slices.Clone(dates)
+	return change, nil
+}
+
+func (f *fakeStore) GetDatesByRoomID(_ context.Context, roomID string) (*models.RoomDatesResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	byDate := make(map[string][]models.User)
+	for key, dates := range f.dates {
+		room, userID, _ := strings.Cut(key, "/")
+		if room != roomID {
+			continue
+		}
+		for _, date := range dates {
+			byDate[date] = append(byDate[date], f.users[userID])
+		}
+	}
+	response := &models.RoomDatesResponse{RoomID: roomID, Dates: []models.DateWithUsers{}}
+	for _, date := range slices.Sorted(maps.Keys(byDate)) {
+		response.Dates = append(response.Dates, models.DateWithUsers{Date: date, Users: byDate[date]})
+	}
+	return response, nil
+}
+
+func (f *fakeStore) RevokeUserSessions(context.Context, string) ([]string, error) {
+	return nil, nil
+}
+
+func (f *fakeStore) RevokeRoomSessions(context.Context, string) ([]string, error) {
+	return nil, nil
+}
+
+// fakeNotifier records what the services tell connected clients.
+type fakeNotifier struct {
+	mu           sync.Mutex
+	published    []interface{}
+	joinRequests []models.User
+	availability []models.AvailabilityChange
+	admissions   map[string]bool
+}
+
+var _ Notifier = (*fakeNotifier)(nil)
+
+func (n *fakeNotifier) Publish(_ context.Context, _ string, message interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.published = append(n.published, message)
+}
+
+func (n *fakeNotifier) RequestJoin(_ context.Context, _ string, user models.User) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.joinRequests = append(n.joinRequests, user)
+}
+
+func (n *fakeNotifier) AvailabilityChanged(_ context.Context, _ string, change models.AvailabilityChange) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.availability = append(n.availability, change)
+}
+
+func (n *fakeNotifier) Admit(_, userID string, approved bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.admissions == nil {
+		n.admissions = make(map[string]bool)
+	}
+	n.admissions[userID] = approved
+}
+
+func (n *fakeNotifier) CloseSession(string) {}
+
+// lastState returns the most recent room state broadcast.
+func (n *fakeNotifier) lastState() *store.FullRoomStateMessage {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i := len(n.published) - 1; i >= 0; i-- {
+		if state, ok := n.published[i].(store.FullRoomStateMessage); ok {
+			return &state
+		}
+	}
+	return nil
+}
+
+// fixture is a room with a host, under the given policy, and the services
+// under test.
+type fixture struct {
+	store  *fakeStore
+	notify *fakeNotifier
+	svc    *Services
+	roomID string
+	host   Actor
+}
+
+func newFixture(t testing.TB, policy models.RoomPolicy) *fixture {
+	t.Helper()
+	ctx := context.Background()
+	f := &fixture{store: newFakeStore(), notify: &fakeNotifier{}}
+	f.svc = New(f.store, f.notify)
+
+	room, err := f.svc.Rooms.Create(ctx, "Planning")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.roomID = room.RoomID
+
+	host, pending, err := f.svc.Rooms.Join(ctx, JoinParams{RoomID: room.RoomID, DisplayName: "Host", OptionContent: "Friday"})
+	if err != nil || pending {
+		t.Fatal("host join:", pending, err)
+	}
+	f.host = Actor{UserID: host.UserID, RoomID: room.RoomID}
+
+	// The host sets the policy once they are in, as they would through
+	// UpdatePolicy.
+	policy.RoomID = room.RoomID
+	policy.HostUserID = host.UserID
+	f.store.policies[room.RoomID] = policy
+	return f
+}
+
+// otherRoom creates a second room in the same store and returns its host.
+func (f *fixture) otherRoom(t testing.TB) Actor {
+	t.Helper()
+	ctx := context.Background()
+	room, err := f.svc.Rooms.Create(ctx, "Elsewhere")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, _, err := f.svc.Rooms.Join(ctx, JoinParams{RoomID: room.RoomID, DisplayName: "Other host", OptionContent: "Sunday"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Actor{UserID: host.UserID, RoomID: room.RoomID}
+}
+
+// join adds a participant and returns them as an actor.
+func (f *fixture) join(t testing.TB, name, option string) Actor {
+	t.Helper()
+	user, pending, err := f.svc.Rooms.Join(context.Background(), JoinParams{RoomID: f.roomID, DisplayName: name, OptionContent: option})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Actor{UserID: user.UserID, RoomID: f.roomID, Pending: pending}
+}
+
+// optionOf returns the ID of the option the user added.
+func (f *fixture) optionOf(userID string) string {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	for _, option := range f.store.options {
+		if option.UserID == userID {
+			return option.OptionID
+		}
+	}
+	return ""
+}
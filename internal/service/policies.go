@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"time"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/models"
+	"websocket-chat/internal/utils"
+	"websocket-chat/internal/validate"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	inviteAudience    = "room-invite"
+	minPasscodeLength = 4
+)
+
+// roomInvite is a signed, expiring invitation to a room. Invites are not
+// stored, so they stay valid until they expire.
+type roomInvite struct {
+	RoomID string `json:"room_id"`
+	jwt.RegisteredClaims
+}
+
+func validInvite(token, roomID string) bool {
+	var invite roomInvite
+	if err := utils.ParseToken(token, &invite); err != nil {
+		return false
+	}
+	return invite.VerifyAudience(inviteAudience, true) && invite.RoomID == roomID
+}
+
+// PolicyUpdate lists the policy fields to change. Nil fields are left as
+// they are; an empty Passcode removes the passcode.
+type PolicyUpdate struct {
+	Passcode        *string
+	MaxParticipants *int
+	InviteOnly      *bool
+	RequireApproval *bool
+}
+
+func (s *RoomService) Policy(ctx context.Context, actor Actor, roomID string) (*models.RoomPolicy, error) {
+	if err := requireRoomID(roomID); err != nil {
+		return nil, err
+	}
+	if err := actor.authorize(roomID); err != nil {
+		return nil, err
+	}
+	policy, err := s.store.GetRoomPolicy(ctx, roomID)
+	if err != nil {
+		return nil, apierr.Wrap(err, "Failed to get room policy")
+	}
+	return policy, nil
+}
+
+// UpdatePolicy changes who may join the room. Only the host may.
+func (s *RoomService) UpdatePolicy(ctx context.Context, actor Actor, roomID string, update PolicyUpdate) (*models.RoomPolicy, error) {
+	if err := requireRoomID(roomID); err != nil {
+		return nil, err
+	}
+	policy, err := requireHost(ctx, s.store, actor, roomID, "Only the host can do this")
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Passcode != nil {
+		switch {
+		case *update.Passcode == "":
+			policy.PasscodeHash = ""
+		default:
+			var v validate.Checker
+			v.Secret("passcode", *update.Passcode, minPasscodeLength)
+			if err := v.Err(); err != nil {
+				return nil, err
+			}
+			policy.PasscodeHash, err = utils.HashPassword(*update.Passcode)
+			if err != nil {
+				return nil, apierr.Wrap(err, "Failed to update room policy")
+			}
+		}
+		policy.HasPasscode = policy.PasscodeHash != ""
+	}
+	if update.MaxParticipants != nil {
+		if *update.MaxParticipants < 0 {
+			return nil, apierr.New(apierr.ValidationFailed, "maxParticipants cannot be negative")
+		}
+		policy.MaxParticipants = *update.MaxParticipants
+	}
+	if update.InviteOnly != nil {
+		policy.InviteOnly = *update.InviteOnly
+	}
+	if update.RequireApproval != nil {
+		policy.RequireApproval = *update.RequireApproval
+	}
+
+	if err := s.store.SaveRoomPolicy(ctx, policy); err != nil {
+		return nil, apierr.Wrap(err, "Failed to update room policy")
+	}
+	return policy, nil
+}
+
+// Invite signs an invitation to the room that expires at expiresAt. Only
+// the host may.
+func (s *RoomService) Invite(ctx context.Context, actor Actor, roomID string, expiresAt time.Time) (string, error) {
+	if err := requireRoomID(roomID); err != nil {
+		return "", err
+	}
+	if _, err := requireHost(ctx, s.store, actor, roomID, "Only the host can do this"); err != nil {
+		return "", err
+	}
+
+	token, err := utils.SignToken(&roomInvite{
+		RoomID: roomID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{inviteAudience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+	if err != nil {
+		return "", apierr.Wrap(err, "Failed to create invite")
+	}
+	return token, nil
+}
+
+// JoinRequests lists the users waiting in the lobby. Only the host may.
+func (s *RoomService) JoinRequests(ctx context.Context, actor Actor, roomID string) ([]models.JoinRequest, error) {
+	if err := requireRoomID(roomID); err != nil {
+		return nil, err
+	}
+	if _, err := requireHost(ctx, s.store, actor, roomID, "Only the host can do this"); err != nil {
+		return nil, err
+	}
+	requests, err := s.store.GetPendingJoinRequests(ctx, roomID)
+	if err != nil {
+		return nil, apierr.Wrap(err, "Failed to get join requests")
+	}
+	return requests, nil
+}
+
+func requireRoomID(roomID string) error {
+	var v validate.Checker
+	v.Required("roomID", roomID)
+	return v.Err()
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/authz"
+	"websocket-chat/internal/models"
+	"websocket-chat/internal/store"
+	"websocket-chat/internal/utils"
+	"websocket-chat/internal/validate"
+)
+
+// RoomService manages rooms and who is in them.
+type RoomService struct {
+	store  Store
+	events *events
+}
+
+func (s *RoomService) Create(ctx context.Context, name string) (*models.Room, error) {
+	var v validate.Checker
+	name = v.RoomName("roomName", name)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	room, err := s.store.CreateRoom(ctx, name)
+	if err != nil {
+		return nil, apierr.Wrap(err, "Failed to create room")
+	}
+	return room, nil
+}
+
+// JoinParams describes a new participant. AccountID links the identity to
+// an account when the caller is logged in.
+type JoinParams struct {
+	RoomID        string
+	DisplayName   string
+	OptionContent string
+	Passcode      string
+	InviteToken   string
+	AccountID     string
+}
+
+// Join adds a participant to a room, subject to its policy. The first
+// participant hosts the room; with approval required, everyone after them
+// waits in the lobby and Join reports them as pending.
+func (s *RoomService) Join(ctx context.Context, p JoinParams) (*models.User, bool, error) {
+	var v validate.Checker
+	v.Required("roomID", p.RoomID)
+	p.DisplayName = v.DisplayName("displayName", p.DisplayName)
+	p.OptionContent = v.Option("optionContent", p.OptionContent, false)
+	if err := v.Err(); err != nil {
+		return nil, false, err
+	}
+
+	if _, err := s.store.GetRoomByID(ctx, p.RoomID); err != nil {
+		return nil, false, apierr.Wrap(err, "Failed to get room")
+	}
+
+	if p.AccountID != "" {
+		if _, err := s.store.GetAccountUserInRoom(ctx, p.AccountID, p.RoomID); err == nil {
+			return nil, false, apierr.New(apierr.Conflict, "Your account already has an identity in this room")
+		}
+	}
+
+	policy, err := s.store.GetRoomPolicy(ctx, p.RoomID)
+	if err != nil {
+		return nil, false, apierr.Wrap(err, "Failed to get room policy")
+	}
+	if err := s.checkJoinPolicy(policy, p); err != nil {
+		return nil, false, err
+	}
+
+	user, pending, err := s.store.JoinRoom(ctx, store.NewParticipant{
+		RoomID:        p.RoomID,
+		DisplayName:   p.DisplayName,
+		OptionContent: p.OptionContent,
+		AccountID:     p.AccountID,
+	})
+	if err != nil {
+		return nil, false, apierr.Wrap(err, "Failed to create user")
+	}
+
+	if pending {
+		s.events.invalidate(p.RoomID)
+		s.events.notify.RequestJoin(ctx, p.RoomID, *user)
+		return user, true, nil
+	}
+	return user, false, s.events.publishState(ctx, p.RoomID)
+}
+
+// checkJoinPolicy returns an error when the room's policy refuses a new
+// participant. A valid invite stands in for the passcode. Capacity is
+// checked by the store as the participant is added.
+func (s *RoomService) checkJoinPolicy(policy *models.RoomPolicy, p JoinParams) error {
+	invited := false
+	if p.InviteToken != "" {
+		if !validInvite(p.InviteToken, p.RoomID) {
+			return apierr.New(apierr.Forbidden, "Invalid or expired invite")
+		}
+		invited = true
+	}
+
+	if policy.InviteOnly && !invited {
+		return apierr.New(apierr.Forbidden, "This room is invite only")
+	}
+	if policy.HasPasscode && !invited && !utils.CheckPassword(policy.PasscodeHash, p.Passcode) {
+		return apierr.New(apierr.Forbidden, "Incorrect room passcode")
+	}
+	return nil
+}
+
+// UpdateParticipant renames the actor and, when optionContent is set,
+// replaces their option.
+func (s *RoomService) UpdateParticipant(ctx context.Context, actor Actor, roomID, displayName, optionContent string) error {
+	var v validate.Checker
+	v.Required("roomID", roomID)
+	displayName = v.DisplayName("displayName", displayName)
+	optionContent = v.Option("optionContent", optionContent, false)
+	if err := v.Err(); err != nil {
+		return err
+	}
+	if err := actor.authorize(roomID); err != nil {
+		return err
+	}
+
+	if err := s.store.ChangeUserName(ctx, actor.UserID, roomID, displayName); err != nil {
+		return apierr.Wrap(err, "Failed to update user")
+	}
+	if optionContent != "" {
+		if _, err := s.store.ChangeOption(ctx, actor.UserID, roomID, optionContent); err != nil {
+			return apierr.Wrap(err, "Failed to update option")
+		}
+	}
+	return s.events.publishState(ctx, roomID)
+}
+
+func (s *RoomService) State(ctx context.Context, actor Actor, roomID string) (*store.FullRoomStateMessage, error) {
+	if err := actor.authorize(roomID); err != nil {
+		return nil, err
+	}
+	return s.events.state(ctx, roomID)
+}
+
+// Users lists the room's admitted participants.
+func (s *RoomService) Users(ctx context.Context, actor Actor, roomID string) ([]models.User, error) {
+	if err := actor.authorize(roomID); err != nil {
+		return nil, err
+	}
+	users, err := s.store.GetUsersByRoomID(ctx, roomID)
+	if err != nil {
+		return nil, apierr.Wrap(err, "Failed to get users")
+	}
+	return users, nil
+}
+
+// DecideJoin lets a user waiting in the lobby into the room or turns them
+// away. Only the host may.
+func (s *RoomService) DecideJoin(ctx context.Context, actor Actor, roomID, userID string, approved bool) error {
+	if _, err := requireHost(ctx, s.store, actor, roomID, "Only the host can decide join requests"); err != nil {
+		return err
+	}
+
+	status := models.JoinDenied
+	if approved {
+		status = models.JoinApproved
+	}
+	if err := s.store.DecideJoinRequest(ctx, roomID, userID, status); err != nil {
+		return apierr.Wrap(err, "Failed to decide join request")
+	}
+
+	s.events.notify.Admit(roomID, userID, approved)
+	if approved {
+		return s.events.publishState(ctx, roomID)
+	}
+	s.events.invalidate(roomID)
+	return nil
+}
+
+// Leave removes the actor from the room with everything they added, and
+// ends their sessions.
+func (s *RoomService) Leave(ctx context.Context, actor Actor, roomID string) error {
+	if err := actor.authorize(roomID); err != nil {
+		return err
+	}
+	if err := s.store.DeleteUser(ctx, roomID, actor.UserID); err != nil {
+		return apierr.Wrap(err, "Failed to leave room")
+	}
+	sessionIDs, err := s.store.RevokeUserSessions(ctx, actor.UserID)
+	if err != nil {
+		return apierr.Wrap(err, "Failed to revoke sessions")
+	}
+	s.events.closeSessions(sessionIDs)
+	return s.events.publishState(ctx, roomID)
+}
+
+// Delete deletes the room and disconnects everyone in it. Only the host
+// may.
+func (s *RoomService) Delete(ctx context.Context, actor Actor, roomID string) error {
+	if _, err := requireHost(ctx, s.store, actor, roomID, "Only the host can delete the room"); err != nil {
+		return err
+	}
+	if err := s.store.DeleteRoom(ctx, roomID); err != nil {
+		return apierr.Wrap(err, "Failed to delete room")
+	}
+	s.events.forget(roomID)
+	sessionIDs, err := s.store.RevokeRoomSessions(ctx, roomID)
+	if err != nil {
+		return apierr.Wrap(err, "Failed to revoke sessions")
+	}
+	s.events.closeSessions(sessionIDs)
+	return nil
+}
+
+// Connect looks up the room and the actor's identity for a new connection.
+// The stored join status wins over the token's pending flag, so users
+// approved since their token was issued join straight away.
+func (s *RoomService) Connect(ctx context.Context, actor Actor, roomID string) (*models.Room, *models.User, bool, error) {
+	if err := authz.AuthorizeRoom(actor.RoomID, roomID); err != nil {
+		return nil, nil, false, err
+	}
+
+	room, err := s.store.GetRoomByID(ctx, roomID)
+	if err != nil {
+		return nil, nil, false, apierr.Wrap(err, "Failed to get room")
+	}
+
+	user, err := s.store.GetUserByID(ctx, actor.UserID)
+	if err != nil {
+		return nil, nil, false, apierr.Wrap(err, "Failed to get user")
+	}
+	if err := authz.AuthorizeRoom(user.RoomID, room.RoomID); err != nil {
+		return nil, nil, false, err
+	}
+
+	status, err := s.store.GetJoinStatus(ctx, user.UserID)
+	if err != nil {
+		return nil, nil, false, apierr.Wrap(err, "Failed to check join status")
+	}
+	if status == models.JoinDenied {
+		return nil, nil, false, apierr.New(apierr.Forbidden, "Join request denied")
+	}
+	return room, user, status == models.JoinPending, nil
+}
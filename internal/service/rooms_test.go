@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/models"
+	"websocket-chat/internal/utils"
+)
+
+// code returns the API error code err maps to, or "" for nil.
+func code(err error) apierr.Code {
+	if err == nil {
+		return ""
+	}
+	var e *apierr.Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return apierr.Wrap(err, "").Code
+}
+
+func TestJoin(t *testing.T) {
+	passcodeHash, err := utils.HashPassword("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		policy  models.RoomPolicy
+		params  func(f *fixture) JoinParams
+		want    apierr.Code
+		pending bool
+	}{
+		{
+			name:   "open room",
+			params: func(*fixture) JoinParams { return JoinParams{DisplayName: "Ana"} },
+		},
+		{
+			name:   "missing display name",
+			params: func(*fixture) JoinParams { return JoinParams{} },
+			want:   apierr.ValidationFailed,
+		},
+		{
+			name:   "wrong passcode",
+			policy: models.RoomPolicy{PasscodeHash: passcodeHash},
+			params: func(*fixture) JoinParams { return JoinParams{DisplayName: "Ana", Passcode: "guess"} },
+			want:   apierr.Forbidden,
+		},
+		{
+			name:   "right passcode",
+			policy: models.RoomPolicy{PasscodeHash: passcodeHash},
+			params: func(*fixture) JoinParams { return JoinParams{DisplayName: "Ana", Passcode: "s3cret"} },
+		},
+		{
+			name:   "invite only without an invite",
+			policy: models.RoomPolicy{InviteOnly: true},
+			params: func(*fixture) JoinParams { return JoinParams{DisplayName: "Ana"} },
+			want:   apierr.Forbidden,
+		},
+		{
+			name:   "invite only with the host's invite",
+			policy: models.RoomPolicy{InviteOnly: true, PasscodeHash: passcodeHash},
+			params: func(f *fixture) JoinParams {
+				invite, err := f.svc.Rooms.Invite(context.Background(), f.host, f.roomID, time.Now().Add(time.Hour))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return JoinParams{DisplayName: "Ana", InviteToken: invite}
+			},
+		},
+		{
+			name:   "invite for another room",
+			policy: models.RoomPolicy{InviteOnly: true},
+			params: func(f *fixture) JoinParams {
+				other := f.otherRoom(t)
+				invite, err := f.svc.Rooms.Invite(context.Background(), other, other.RoomID, time.Now().Add(time.Hour))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return JoinParams{DisplayName: "Ana", InviteToken: invite}
+			},
+			want: apierr.Forbidden,
+		},
+		{
+			name:   "room at capacity",
+			policy: models.RoomPolicy{MaxParticipants: 1},
+			params: func(*fixture) JoinParams { return JoinParams{DisplayName: "Ana"} },
+			want:   apierr.RoomFull,
+		},
+		{
+			name:    "approval required",
+			policy:  models.RoomPolicy{RequireApproval: true},
+			params:  func(*fixture) JoinParams { return JoinParams{DisplayName: "Ana", OptionContent: "Monday"} },
+			pending: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, tt.policy)
+			p := tt.params(f)
+			p.RoomID = f.roomID
+
+			user, pending, err := f.svc.Rooms.Join(context.Background(), p)
+			if got := code(err); got != tt.want {
+				t.Fatalf("Join error = %v, want code %q", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			if pending != tt.pending {
+				t.Errorf("pending = %v, want %v", pending, tt.pending)
+			}
+
+			state, err := f.svc.Rooms.State(context.Background(), f.host, f.roomID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			inState := false
+			for _, u := range state.Users {
+				inState = inState || u.UserID == user.UserID
+			}
+			if inState == pending {
+				t.Errorf("user in room state = %v with pending = %v", inState, pending)
+			}
+			if pending && (len(f.notify.joinRequests) != 1 || f.notify.joinRequests[0].UserID != user.UserID) {
+				t.Errorf("join requests = %v, want one for %s", f.notify.joinRequests, user.UserID)
+			}
+		})
+	}
+}
+
+func TestJoinFirstParticipantHosts(t *testing.T) {
+	f := newFixture(t, models.RoomPolicy{RequireApproval: true})
+	policy, err := f.svc.Rooms.Policy(context.Background(), f.host, f.roomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.HostUserID != f.host.UserID {
+		t.Errorf("host = %q, want the first participant %q", policy.HostUserID, f.host.UserID)
+	}
+}
+
+func TestDecideJoin(t *testing.T) {
+	tests := []struct {
+		name     string
+		decider  func(f *fixture, waiting Actor) Actor
+		approved bool
+		want     apierr.Code
+		status   string
+	}{
+		{
+			name:     "host approves",
+			decider:  func(f *fixture, _ Actor) Actor { return f.host },
+			approved: true,
+			status:   models.JoinApproved,
+		},
+		{
+			name:    "host denies",
+			decider: func(f *fixture, _ Actor) Actor { return f.host },
+			status:  models.JoinDenied,
+		},
+		{
+			name: "participant is not the host",
+			decider: func(f *fixture, _ Actor) Actor {
+				// Approved by the host first, so they are a full participant.
+				guest := f.join(t, "Guest", "")
+				if err := f.svc.Rooms.DecideJoin(context.Background(), f.host, f.roomID, guest.UserID, true); err != nil {
+					t.Fatal(err)
+				}
+				guest.Pending = false
+				return guest
+			},
+			approved: true,
+			want:     apierr.Forbidden,
+			status:   models.JoinPending,
+		},
+		{
+			name:     "waiting user cannot admit themselves",
+			decider:  func(_ *fixture, waiting Actor) Actor { return waiting },
+			approved: true,
+			want:     apierr.PendingApproval,
+			status:   models.JoinPending,
+		},
+		{
+			name:     "host of another room",
+			decider:  func(f *fixture, _ Actor) Actor { return f.otherRoom(t) },
+			approved: true,
+			want:     apierr.Forbidden,
+			status:   models.JoinPending,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t, models.RoomPolicy{RequireApproval: true})
+			waiting := f.join(t, "Ana", "")
+			if !waiting.Pending {
+				t.Fatal("join did not wait for approval")
+			}
+
+			err := f.svc.Rooms.DecideJoin(ctx, tt.decider(f, waiting), f.roomID, waiting.UserID, tt.approved)
+			if got := code(err); got != tt.want {
+				t.Fatalf("DecideJoin error = %v, want code %q", err, tt.want)
+			}
+			status, _ := f.store.GetJoinStatus(ctx, waiting.UserID)
+			if status != tt.status {
+				t.Errorf("status = %q, want %q", status, tt.status)
+			}
+			if err != nil {
+				if _, ok := f.notify.admissions[waiting.UserID]; ok {
+					t.Error("refused decision still admitted or removed the user")
+				}
+				return
+			}
+			if approved, ok := f.notify.admissions[waiting.UserID]; !ok || approved != tt.approved {
+				t.Errorf("admission = %v (sent %v), want %v", approved, ok, tt.approved)
+			}
+
+			state, err := f.svc.Rooms.State(ctx, f.host, f.roomID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			inState := false
+			for _, u := range state.Users {
+				inState = inState || u.UserID == waiting.UserID
+			}
+			if inState != tt.approved {
+				t.Errorf("user in room state = %v, want %v", inState, tt.approved)
+			}
+		})
+	}
+}
+
+func TestDecideJoinWithoutRequest(t *testing.T) {
+	f := newFixture(t, models.RoomPolicy{})
+	guest := f.join(t, "Ana", "")
+	err := f.svc.Rooms.DecideJoin(context.Background(), f.host, f.roomID, guest.UserID, true)
+	if got := code(err); got != apierr.JoinRequestNotFound {
+		t.Fatalf("DecideJoin error = %v, want code %q", err, apierr.JoinRequestNotFound)
+	}
+}
@@ -0,0 +1,259 @@
+// Package service owns the rules of the room API: validation,
+// authorization, the store calls an action makes and the events it sends
+// to the room. The REST handlers and the WebSocket protocol are thin
+// adapters that decode a request, call a service and encode the result, so
+// both transports behave the same.
+package service
+
+import (
+	"context"
+	"slices"
+	"time"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/authz"
+	"websocket-chat/internal/models"
+	"websocket-chat/internal/store"
+	"websocket-chat/internal/utils"
+)
+
+// Store is the persistence the services need. *store.SQLStore implements
+// it; tests can substitute an in-memory fake.
+type Store interface {
+	CreateRoom(ctx context.Context, name string) (*models.Room, error)
+	GetRoomByID(ctx context.Context, roomID string) (*models.Room, error)
+	DeleteRoom(ctx context.Context, roomID string) error
+	GetFullRoomState(ctx context.Context, roomID string) (*store.FullRoomStateMessage, error)
+
+	GetUserByID(ctx context.Context, userID string) (*models.User, error)
+	ChangeUserName(ctx context.Context, userID, roomID, newName string) error
+	DeleteUser(ctx context.Context, roomID, userID string) error
+	GetUsersByRoomID(ctx context.Context, roomID string) ([]models.User, error)
+	GetAccountUserInRoom(ctx context.Context, accountID, roomID string) (*models.User, error)
+
+	JoinRoom(ctx context.Context, p store.NewParticipant) (*models.User, bool, error)
+	GetRoomPolicy(ctx context.Context, roomID string) (*models.RoomPolicy, error)
+	SaveRoomPolicy(ctx context.Context, policy *models.RoomPolicy) error
+	GetJoinStatus(ctx context.Context, userID string) (string, error)
+	DecideJoinRequest(ctx context.Context, roomID, userID, status string) error
+	GetPendingJoinRequests(ctx context.Context, roomID string) ([]models.JoinRequest, error)
+
+	ChangeOption(ctx context.Context, userID, roomID, newContent string) (*models.Option, error)
+	GetOption(ctx context.Context, optionID string) (*models.Option, error)
+	UpdateOption(ctx context.Context, optionID, content string) error
+	DeleteOption(ctx context.Context, optionID string) error
+	GetOptionsByRoomID(ctx context.Context, roomID string) ([]models.Option, error)
+
+	ChangeVote(ctx context.Context, userID, newOptionID string) error
+	GetVote(ctx context.Context, voteID string) (*models.Vote, error)
+	DeleteUserVote(ctx context.Context, userID string) error
+	GetVotesByRoomID(ctx context.Context, roomID string) ([]models.Vote, error)
+
+	ReplaceUserAvailability(ctx context.Context, roomID, userID string, dates []string) (*models.AvailabilityChange, error)
+	GetDatesByRoomID(ctx context.Context, roomID string) (*models.RoomDatesResponse, error)
+
+	RevokeUserSessions(ctx context.Context, userID string) ([]string, error)
+	RevokeRoomSessions(ctx context.Context, roomID string) ([]string, error)
+}
+
+var _ Store = (*store.SQLStore)(nil)
+
+// Notifier delivers the results of an action to connected clients. The
+// WebSocket hub implements it.
+type Notifier interface {
+	Publish(ctx context.Context, roomID string, message interface{})
+	RequestJoin(ctx context.Context, roomID string, user models.User)
+	AvailabilityChanged(ctx context.Context, roomID string, change models.AvailabilityChange)
+	Admit(roomID, userID string, approved bool)
+	CloseSession(sessionID string)
+}
+
+// Actor is the authenticated participant performing an action: the user
+// and room their token was issued for, and whether they are still waiting
+// in the lobby.
+type Actor struct {
+	UserID  string
+	RoomID  string
+	Pending bool
+}
+
+// authorize lets the actor act on roomID only if it is their room and they
+// have been admitted to it.
+func (a Actor) authorize(roomID string) error {
+	if a.Pending {
+		return authz.ErrPendingApproval
+	}
+	return authz.AuthorizeRoom(a.RoomID, roomID)
+}
+
+type Services struct {
+	Rooms        *RoomService
+	Voting       *VotingService
+	Availability *AvailabilityService
+
+	events *events
+}
+
+func New(s Store, n Notifier) *Services {
+	e := &events{
+		store:  s,
+		notify: n,
+		states: newRoomCache[*store.FullRoomStateMessage](),
+		dates:  newRoomCache[*models.RoomDatesResponse](),
+	}
+	return &Services{
+		Rooms:        &RoomService{store: s, events: e},
+		Voting:       &VotingService{store: s, events: e},
+		Availability: &AvailabilityService{store: s, events: e},
+		events:       e,
+	}
+}
+
+// VoteBuffer queues vote changes for the store to pick up later. The
+// write-behind buffer implements it.
+type VoteBuffer interface {
+	Record(change models.VoteChange) error
+	Pending(roomID string) []models.VoteChange
+	OnStored(fn func(roomIDs []string))
+}
+
+// SetVoteBuffer switches voting to write-behind: votes are applied to the
+// room state in memory and broadcast at once, and reach the store through
+// votes later. It needs the cache, since every vote is answered from the
+// cached room state. It must be called before the services are used.
+func (s *Services) SetVoteBuffer(votes VoteBuffer) {
+	s.events.votes = votes
+	votes.OnStored(s.events.votesStored)
+}
+
+// SetCacheTTL keeps each room's state and dates in memory for up to ttl
+// between changes. Writes through this instance are seen at once; ttl
+// bounds how long writes through other instances may go unseen. Zero, the
+// default, disables the cache. It must be called before the services are
+// used.
+func (s *Services) SetCacheTTL(ttl time.Duration) {
+	s.events.states.setTTL(ttl)
+	s.events.dates.setTTL(ttl)
+}
+
+// events sends what changed to the room's clients and keeps the cached
+// room state in step with it.
+type events struct {
+	store  Store
+	notify Notifier
+	states *roomCache[*store.FullRoomStateMessage]
+	dates  *roomCache[*models.RoomDatesResponse]
+	votes  VoteBuffer
+}
+
+// state returns the room state, from the cache when it is current, with
+// any votes not yet stored applied. The result is a copy the caller may
+// change.
+func (e *events) state(ctx context.Context, roomID string) (*store.FullRoomStateMessage, error) {
+	state, err := e.states.get(ctx, roomID, e.store.GetFullRoomState)
+	if err != nil {
+		return nil, apierr.Wrap(err, "Failed to get room state")
+	}
+	copied := *state
+	if e.votes != nil {
+		copied.Votes = applyVoteChanges(state, e.votes.Pending(roomID))
+	}
+	return &copied, nil
+}
+
+// applyVoteChanges returns the state's votes with changes applied in order.
+// Votes for options or users no longer in the room are left out, as the
+// store drops them too.
+func applyVoteChanges(state *store.FullRoomStateMessage, changes []models.VoteChange) []models.Vote {
+	if len(changes) == 0 {
+		return state.Votes
+	}
+
+	options := make(map[string]bool, len(state.Options))
+	for _, option := range state.Options {
+		options[option.OptionID] = true
+	}
+	users := make(map[string]bool, len(state.Users))
+	for _, user := range state.Users {
+		users[user.UserID] = true
+	}
+
+	votes := slices.Clone(state.Votes)
+	for _, change := range changes {
+		votes = slices.DeleteFunc(votes, func(vote models.Vote) bool { return vote.UserID == change.UserID })
+		if change.OptionID != "" && options[change.OptionID] && users[change.UserID] {
+			votes = append(votes, models.Vote{VoteID: change.VoteID, OptionID: change.OptionID, UserID: change.UserID})
+		}
+	}
+	return votes
+}
+
+func (e *events) roomDates(ctx context.Context, roomID string) (*models.RoomDatesResponse, error) {
+	dates, err := e.dates.get(ctx, roomID, e.store.GetDatesByRoomID)
+	if err != nil {
+		return nil, apierr.Wrap(err, "Failed to get dates")
+	}
+	return dates, nil
+}
+
+// invalidate drops what is cached for the room after a write to it.
+func (e *events) invalidate(roomID string) {
+	e.states.invalidate(roomID)
+	e.dates.invalidate(roomID)
+}
+
+// votesStored drops the cached state of rooms whose buffered votes reached
+// the store. The buffer stops overlaying them after its next flush, so the
+// state must be loaded again before then.
+func (e *events) votesStored(roomIDs []string) {
+	for _, roomID := range roomIDs {
+		e.states.invalidate(roomID)
+	}
+}
+
+// forget drops a deleted room from the cache.
+func (e *events) forget(roomID string) {
+	e.states.forget(roomID)
+	e.dates.forget(roomID)
+}
+
+// publishState broadcasts the room state after a change.
+func (e *events) publishState(ctx context.Context, roomID string) error {
+	e.invalidate(roomID)
+	return e.publish(ctx, roomID, false)
+}
+
+func (e *events) publish(ctx context.Context, roomID string, revealVotes bool) error {
+	state, err := e.state(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	state.RevealVotes = revealVotes
+	e.notify.Publish(ctx, roomID, *state)
+	return nil
+}
+
+// closeSessions disconnects revoked sessions here at once. Other instances
+// pick the revocations up from the store.
+func (e *events) closeSessions(sessionIDs []string) {
+	now := time.Now()
+	for _, sessionID := range sessionIDs {
+		utils.Revoked.Add(sessionID, now)
+		e.notify.CloseSession(sessionID)
+	}
+}
+
+// requireHost returns the room's policy, or a forbidden error with message
+// unless the actor hosts the room.
+func requireHost(ctx context.Context, s Store, actor Actor, roomID, message string) (*models.RoomPolicy, error) {
+	if err := actor.authorize(roomID); err != nil {
+		return nil, err
+	}
+	policy, err := s.GetRoomPolicy(ctx, roomID)
+	if err != nil {
+		return nil, apierr.Wrap(err, "Failed to get room policy")
+	}
+	if policy.HostUserID != actor.UserID {
+		return nil, apierr.New(apierr.Forbidden, message)
+	}
+	return policy, nil
+}
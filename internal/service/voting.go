@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/authz"
+	"websocket-chat/internal/models"
+	"websocket-chat/internal/store"
+	"websocket-chat/internal/validate"
+
+	"github.com/google/uuid"
+)
+
+// VotingService manages a room's options and the votes cast on them.
+type VotingService struct {
+	store  Store
+	events *events
+}
+
+// AddOption sets the actor's option, replacing any they added before.
+func (s *VotingService) AddOption(ctx context.Context, actor Actor, roomID, content string) (*models.Option, error) {
+	var v validate.Checker
+	content = v.Option("content", content, true)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	if err := actor.authorize(roomID); err != nil {
+		return nil, err
+	}
+
+	option, err := s.store.ChangeOption(ctx, actor.UserID, roomID, content)
+	if err != nil {
+		return nil, apierr.Wrap(err, "Failed to create option")
+	}
+	return option, s.events.publishState(ctx, roomID)
+}
+
+func (s *VotingService) GetOption(ctx context.Context, actor Actor, roomID, optionID string) (*models.Option, error) {
+	if err := actor.authorize(roomID); err != nil {
+		return nil, err
+	}
+	option, err := s.store.GetOption(ctx, optionID)
+	if err != nil {
+		return nil, apierr.Wrap(err, "Failed to get option")
+	}
+	if err := authz.AuthorizeRoom(option.RoomID, roomID); err != nil {
+		return nil, err
+	}
+	return option, nil
+}
+
+// EditOption changes an option's text. Only its author and the host may.
+func (s *VotingService) EditOption(ctx context.Context, actor Actor, roomID, optionID, content string) (*models.Option, error) {
+	var v validate.Checker
+	content = v.Option("content", content, true)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	option, err := s.ownedOption(ctx, actor, roomID, optionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.UpdateOption(ctx, optionID, content); err != nil {
+		return nil, apierr.Wrap(err, "Failed to update option")
+	}
+	option.Content = content
+	return option, s.events.publishState(ctx, roomID)
+}
+
+// DeleteOption removes an option and its votes. Only its author and the
+// host may.
+func (s *VotingService) DeleteOption(ctx context.Context, actor Actor, roomID, optionID string) error {
+	if _, err := s.ownedOption(ctx, actor, roomID, optionID); err != nil {
+		return err
+	}
+	if err := s.store.DeleteOption(ctx, optionID); err != nil {
+		return apierr.Wrap(err, "Failed to delete option")
+	}
+	return s.events.publishState(ctx, roomID)
+}
+
+func (s *VotingService) ownedOption(ctx context.Context, actor Actor, roomID, optionID string) (*models.Option, error) {
+	option, err := s.GetOption(ctx, actor, roomID, optionID)
+	if err != nil {
+		return nil, err
+	}
+	if option.UserID == actor.UserID {
+		return option, nil
+	}
+	if _, err := requireHost(ctx, s.store, actor, roomID, "Only the option's author or the host can change it"); err != nil {
+		return nil, err
+	}
+	return option, nil
+}
+
+// Options lists the room's options.
+func (s *VotingService) Options(ctx context.Context, actor Actor, roomID string) ([]models.Option, error) {
+	if err := actor.authorize(roomID); err != nil {
+		return nil, err
+	}
+	options, err := s.store.GetOptionsByRoomID(ctx, roomID)
+	if err != nil {
+		return nil, apierr.Wrap(err, "Failed to get options")
+	}
+	return options, nil
+}
+
+// Vote casts the actor's vote, moving it if they had already voted.
+func (s *VotingService) Vote(ctx context.Context, actor Actor, roomID, optionID string) error {
+	var v validate.Checker
+	v.Required("optionID", optionID)
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	if s.events.votes != nil {
+		return s.bufferVote(ctx, actor, roomID, optionID)
+	}
+	if _, err := s.GetOption(ctx, actor, roomID, optionID); err != nil {
+		return err
+	}
+	if err := s.store.ChangeVote(ctx, actor.UserID, optionID); err != nil {
+		return apierr.Wrap(err, "Failed to create vote")
+	}
+	return s.events.publishState(ctx, roomID)
+}
+
+func (s *VotingService) RetractVote(ctx context.Context, actor Actor, roomID string) error {
+	if err := actor.authorize(roomID); err != nil {
+		return err
+	}
+	if s.events.votes != nil {
+		return s.bufferVote(ctx, actor, roomID, "")
+	}
+	if err := s.store.DeleteUserVote(ctx, actor.UserID); err != nil {
+		return apierr.Wrap(err, "Failed to delete vote")
+	}
+	return s.events.publishState(ctx, roomID)
+}
+
+func (s *VotingService) GetVote(ctx context.Context, actor Actor, roomID, voteID string) (*models.Vote, error) {
+	if err := actor.authorize(roomID); err != nil {
+		return nil, err
+	}
+	if s.events.votes != nil {
+		state, err := s.events.state(ctx, roomID)
+		if err != nil {
+			return nil, err
+		}
+		for _, vote := range state.Votes {
+			if vote.VoteID == voteID {
+				return &vote, nil
+			}
+		}
+		return nil, apierr.Wrap(store.ErrVoteNotFound, "Failed to get vote")
+	}
+	vote, err := s.store.GetVote(ctx, voteID)
+	if err != nil {
+		return nil, apierr.Wrap(err, "Failed to get vote")
+	}
+	if _, err := s.GetOption(ctx, actor, roomID, vote.OptionID); err != nil {
+		return nil, err
+	}
+	return vote, nil
+}
+
+// Votes lists the room's votes.
+func (s *VotingService) Votes(ctx context.Context, actor Actor, roomID string) ([]models.Vote, error) {
+	if err := actor.authorize(roomID); err != nil {
+		return nil, err
+	}
+	if s.events.votes != nil {
+		state, err := s.events.state(ctx, roomID)
+		if err != nil {
+			return nil, err
+		}
+		return state.Votes, nil
+	}
+	votes, err := s.store.GetVotesByRoomID(ctx, roomID)
+	if err != nil {
+		return nil, apierr.Wrap(err, "Failed to get votes")
+	}
+	return votes, nil
+}
+
+// bufferVote sets the actor's vote to optionID, or retracts it when optionID
+// is empty, in the room state held in memory and broadcasts the result. The
+// vote buffer stores the change later.
+func (s *VotingService) bufferVote(ctx context.Context, actor Actor, roomID, optionID string) error {
+	if err := actor.authorize(roomID); err != nil {
+		return err
+	}
+	state, err := s.events.state(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	if optionID != "" && !slices.ContainsFunc(state.Options, func(option models.Option) bool { return option.OptionID == optionID }) {
+		return apierr.Wrap(store.ErrOptionNotFound, "Failed to get option")
+	}
+
+	change := models.VoteChange{RoomID: roomID, UserID: actor.UserID, OptionID: optionID}
+	i := slices.IndexFunc(state.Votes, func(vote models.Vote) bool { return vote.UserID == actor.UserID })
+	switch {
+	case i >= 0:
+		change.VoteID = state.Votes[i].VoteID
+	case optionID == "":
+		return apierr.Wrap(store.ErrVoteNotFound, "Failed to delete vote")
+	default:
+		change.VoteID = uuid.NewString()
+	}
+
+	if err := s.events.votes.Record(change); err != nil {
+		return apierr.Wrap(err, "Failed to save vote")
+	}
+	return s.events.publish(ctx, roomID, false)
+}
+
+// Reveal broadcasts the room state with votes shown.
+func (s *VotingService) Reveal(ctx context.Context, actor Actor, roomID string) error {
+	if err := actor.authorize(roomID); err != nil {
+		return err
+	}
+	return s.events.publish(ctx, roomID, true)
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/models"
+	"websocket-chat/internal/writebehind"
+)
+
+func TestVote(t *testing.T) {
+	tests := []struct {
+		name   string
+		voter  func(f *fixture) Actor
+		option func(f *fixture) string
+		want   apierr.Code
+	}{
+		{
+			name:   "participant votes",
+			voter:  func(f *fixture) Actor { return f.join(t, "Ana", "") },
+			option: func(f *fixture) string { return f.optionOf(f.host.UserID) },
+		},
+		{
+			name:   "no option",
+			voter:  func(f *fixture) Actor { return f.host },
+			option: func(*fixture) string { return "" },
+			want:   apierr.ValidationFailed,
+		},
+		{
+			name:   "unknown option",
+			voter:  func(f *fixture) Actor { return f.host },
+			option: func(*fixture) string { return "missing" },
+			want:   apierr.OptionNotFound,
+		},
+		{
+			name:   "option from another room",
+			voter:  func(f *fixture) Actor { return f.host },
+			option: func(f *fixture) string { return f.optionOf(f.otherRoom(t).UserID) },
+			want:   apierr.Forbidden,
+		},
+		{
+			name:   "participant of another room",
+			voter:  func(f *fixture) Actor { return f.otherRoom(t) },
+			option: func(f *fixture) string { return f.optionOf(f.host.UserID) },
+			want:   apierr.Forbidden,
+		},
+		{
+			name: "waiting for approval",
+			voter: func(f *fixture) Actor {
+				f.store.policies[f.roomID] = models.RoomPolicy{RoomID: f.roomID, HostUserID: f.host.UserID, RequireApproval: true}
+				return f.join(t, "Ana", "")
+			},
+			option: func(f *fixture) string { return f.optionOf(f.host.UserID) },
+			want:   apierr.PendingApproval,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, models.RoomPolicy{})
+			voter, optionID := tt.voter(f), tt.option(f)
+
+			err := f.svc.Voting.Vote(context.Background(), voter, f.roomID, optionID)
+			if got := code(err); got != tt.want {
+				t.Fatalf("Vote error = %v, want code %q", err, tt.want)
+			}
+			if err != nil {
+				if len(f.store.votes) != 0 {
+					t.Errorf("refused vote was stored: %v", f.store.votes)
+				}
+				return
+			}
+			state := f.notify.lastState()
+			if state == nil || len(state.Votes) != 1 || state.Votes[0].UserID != voter.UserID || state.Votes[0].OptionID != optionID {
+				t.Errorf("broadcast state = %+v, want the vote", state)
+			}
+		})
+	}
+}
+
+func TestReveal(t *testing.T) {
+	tests := []struct {
+		name  string
+		actor func(f *fixture) Actor
+		want  apierr.Code
+	}{
+		{
+			name:  "host reveals",
+			actor: func(f *fixture) Actor { return f.host },
+		},
+		{
+			name:  "participant reveals",
+			actor: func(f *fixture) Actor { return f.join(t, "Ana", "") },
+		},
+		{
+			name: "waiting for approval",
+			actor: func(f *fixture) Actor {
+				f.store.policies[f.roomID] = models.RoomPolicy{RoomID: f.roomID, HostUserID: f.host.UserID, RequireApproval: true}
+				return f.join(t, "Ana", "")
+			},
+			want: apierr.PendingApproval,
+		},
+		{
+			name:  "participant of another room",
+			actor: func(f *fixture) Actor { return f.otherRoom(t) },
+			want:  apierr.Forbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, models.RoomPolicy{})
+			actor := tt.actor(f)
+			f.notify.published = nil
+
+			err := f.svc.Voting.Reveal(context.Background(), actor, f.roomID)
+			if got := code(err); got != tt.want {
+				t.Fatalf("Reveal error = %v, want code %q", err, tt.want)
+			}
+			state := f.notify.lastState()
+			if revealed := state != nil && state.RevealVotes; revealed != (err == nil) {
+				t.Errorf("votes revealed = %v, want %v", revealed, err == nil)
+			}
+		})
+	}
+}
+
+func TestRetractVote(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, models.RoomPolicy{})
+	if err := f.svc.Voting.RetractVote(ctx, f.host, f.roomID); code(err) != apierr.NotFound {
+		t.Fatalf("RetractVote without a vote = %v, want code %q", err, apierr.NotFound)
+	}
+	if err := f.svc.Voting.Vote(ctx, f.host, f.roomID, f.optionOf(f.host.UserID)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.svc.Voting.RetractVote(ctx, f.host, f.roomID); err != nil {
+		t.Fatal(err)
+	}
+	if state := f.notify.lastState(); len(state.Votes) != 0 {
+		t.Errorf("broadcast votes = %v, want none", state.Votes)
+	}
+}
+
+func TestBufferedVotesSurviveFlush(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t, models.RoomPolicy{})
+	votes, err := writebehind.Open(t.TempDir(), f.store, time.Hour, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { votes.Close(ctx) })
+	f.svc.SetCacheTTL(time.Hour)
+	f.svc.SetVoteBuffer(votes)
+	guest := f.join(t, "Ana", "")
+	option := f.optionOf(f.host.UserID)
+
+	// Each vote lands in a room state cached before its flush, and the
+	// second flush takes the first vote out of the buffer.
+	for i, voter := range []Actor{f.host, guest} {
+		if err := f.svc.Voting.Vote(ctx, voter, f.roomID, option); err != nil {
+			t.Fatal(err)
+		}
+		if err := votes.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.svc.Voting.Reveal(ctx, f.host, f.roomID); err != nil {
+			t.Fatal(err)
+		}
+		if state := f.notify.lastState(); len(state.Votes) != i+1 {
+			t.Fatalf("broadcast votes after flush %d = %v, want %d", i+1, state.Votes, i+1)
+		}
+	}
+	if votes.Len() != 0 || len(f.store.votes) != 2 {
+		t.Errorf("%d votes queued and %d stored, want 0 and 2", votes.Len(), len(f.store.votes))
+	}
+}
+
+func TestRoomStateLoadSpanningTwoFlushes(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+	}{
+		{name: "cache enabled", ttl: time.Hour},
+		{name: "cache disabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t, models.RoomPolicy{})
+			votes, err := writebehind.Open(t.TempDir(), f.store, time.Hour, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { votes.Close(ctx) })
+			f.svc.SetCacheTTL(tt.ttl)
+			f.svc.SetVoteBuffer(votes)
+			guest := f.join(t, "Ana", "")
+			option := f.optionOf(f.host.UserID)
+
+			if err := f.svc.Voting.Vote(ctx, f.host, f.roomID, option); err != nil {
+				t.Fatal(err)
+			}
+			// The next load reads the store before the host's vote is
+			// flushed and returns after a second flush has taken it out of
+			// the buffer.
+			f.svc.events.invalidate(f.roomID)
+			f.store.mu.Lock()
+			f.store.afterLoad = func() {
+				if err := votes.Flush(ctx); err != nil {
+					t.Error(err)
+				}
+				if err := f.svc.Voting.Vote(ctx, guest, f.roomID, option); err != nil {
+					t.Error(err)
+				}
+				if err := votes.Flush(ctx); err != nil {
+					t.Error(err)
+				}
+			}
+			f.store.mu.Unlock()
+
+			if err := f.svc.Voting.Reveal(ctx, f.host, f.roomID); err != nil {
+				t.Fatal(err)
+			}
+			if state := f.notify.lastState(); len(state.Votes) != 2 {
+				t.Errorf("broadcast votes = %v, want both", state.Votes)
+			}
+		})
+	}
+}
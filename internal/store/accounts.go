@@ -0,0 +1,231 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"websocket-chat/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func (s *SQLStore) CreateAccount(ctx context.Context, email, passwordHash string) (_ *models.Account, err error) {
+	ctx, done := s.observe(ctx, "CreateAccount")
+	defer done(&err)
+
+	account := &models.Account{
+		AccountID:    uuid.New().String(),
+		Email:        email,
+		PasswordHash: passwordHash,
+		CreatedAt:    time.Now().UTC().Truncate(time.Second),
+	}
+	query := `INSERT INTO Accounts (AccountID, Email, PasswordHash, CreatedAt) VALUES (?, ?, ?, ?);`
+
+	_, err = s.DB.ExecContext(ctx, query, account.AccountID, account.Email, account.PasswordHash, account.CreatedAt.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create account: %w", err)
+	}
+
+	return account, nil
+}
+
+func (s *SQLStore) GetAccountByEmail(ctx context.Context, email string) (_ *models.Account, err error) {
+	ctx, done := s.observe(ctx, "GetAccountByEmail")
+	defer done(&err)
+
+	query := `SELECT AccountID, Email, PasswordHash, CreatedAt FROM Accounts WHERE Email = ?;`
+	return s.getAccount(ctx, query, email)
+}
+
+func (s *SQLStore) GetAccountByID(ctx context.Context, accountID string) (_ *models.Account, err error) {
+	ctx, done := s.observe(ctx, "GetAccountByID")
+	defer done(&err)
+
+	query := `SELECT AccountID, Email, PasswordHash, CreatedAt FROM Accounts WHERE AccountID = ?;`
+	return s.getAccount(ctx, query, accountID)
+}
+
+func (s *SQLStore) getAccount(ctx context.Context, query string, arg string) (*models.Account, error) {
+	account := &models.Account{}
+	var createdAt int64
+
+	err := s.DB.QueryRowContext(ctx, query, arg).Scan(&account.AccountID, &account.Email, &account.PasswordHash, &createdAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	account.CreatedAt = time.Unix(createdAt, 0).UTC()
+	return account, nil
+}
+
+// LinkUserToAccount makes an existing room identity part of an account. An
+// account holds at most one identity per room.
+func (s *SQLStore) LinkUserToAccount(ctx context.Context, accountID, userID, roomID string) (err error) {
+	ctx, done := s.observe(ctx, "LinkUserToAccount")
+	defer done(&err)
+
+	query := `INSERT INTO AccountMemberships (UserID, AccountID, RoomID, CreatedAt) VALUES (?, ?, ?, ?);`
+
+	_, err = s.DB.ExecContext(ctx, query, userID, accountID, roomID, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to link user to account: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetAccountIDForUser(ctx context.Context, userID string) (_ string, err error) {
+	ctx, done := s.observe(ctx, "GetAccountIDForUser")
+	defer done(&err)
+
+	query := `SELECT AccountID FROM AccountMemberships WHERE UserID = ?;`
+
+	var accountID string
+	err = s.DB.QueryRowContext(ctx, query, userID).Scan(&accountID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get account membership: %w", err)
+	}
+	return accountID, nil
+}
+
+func (s *SQLStore) GetAccountUserInRoom(ctx context.Context, accountID, roomID string) (_ *models.User, err error) {
+	ctx, done := s.observe(ctx, "GetAccountUserInRoom")
+	defer done(&err)
+
+	query := `
+        SELECT u.UserID, u.RoomID, u.DisplayName
+        FROM AccountMemberships m
+        JOIN Users u ON u.UserID = m.UserID
+        WHERE m.AccountID = ? AND m.RoomID = ?;
+    `
+
+	user := &models.User{}
+	err = s.DB.QueryRowContext(ctx, query, accountID, roomID).Scan(&user.UserID, &user.RoomID, &user.DisplayName)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get account user: %w", err)
+	}
+	return user, nil
+}
+
+func (s *SQLStore) GetAccountRooms(ctx context.Context, accountID string) (_ []models.AccountRoom, err error) {
+	ctx, done := s.observe(ctx, "GetAccountRooms")
+	defer done(&err)
+
+	query := `
+        SELECT r.RoomID, r.Name, u.UserID, u.DisplayName
+        FROM AccountMemberships m
+        JOIN Users u ON u.UserID = m.UserID
+        JOIN Rooms r ON r.RoomID = m.RoomID
+        WHERE m.AccountID = ?
+        ORDER BY m.CreatedAt DESC;
+    `
+
+	rows, err := s.DB.QueryContext(ctx, query, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account rooms: %w", err)
+	}
+	defer rows.Close()
+
+	rooms := []models.AccountRoom{}
+	for rows.Next() {
+		var room models.AccountRoom
+		err := rows.Scan(&room.RoomID, &room.RoomName, &room.UserID, &room.DisplayName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan account room: %w", err)
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, rows.Err()
+}
+
+func (s *SQLStore) CreateMagicLink(ctx context.Context, tokenHash, email string, expiresAt time.Time) (err error) {
+	ctx, done := s.observe(ctx, "CreateMagicLink")
+	defer done(&err)
+
+	query := `INSERT INTO MagicLinks (TokenHash, Email, ExpiresAt) VALUES (?, ?, ?);`
+
+	_, err = s.DB.ExecContext(ctx, query, tokenHash, email, expiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to create magic link: %w", err)
+	}
+	return nil
+}
+
+// ConsumeMagicLink marks a link as used and returns its email. A link can be
+// consumed once and only before it expires.
+func (s *SQLStore) ConsumeMagicLink(ctx context.Context, tokenHash string) (_ string, err error) {
+	ctx, done := s.observe(ctx, "ConsumeMagicLink")
+	defer done(&err)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	result, err := tx.ExecContext(ctx, `
+        UPDATE MagicLinks SET UsedAt = ?
+        WHERE TokenHash = ? AND UsedAt IS NULL AND ExpiresAt > ?
+    `, now, tokenHash, now)
+	if err != nil {
+		return "", fmt.Errorf("failed to consume magic link: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("failed to consume magic link: %w", err)
+	}
+	if rows == 0 {
+		return "", ErrMagicLinkNotFound
+	}
+
+	var email string
+	err = tx.QueryRowContext(ctx, `SELECT Email FROM MagicLinks WHERE TokenHash = ?`, tokenHash).Scan(&email)
+	if err != nil {
+		return "", fmt.Errorf("failed to read magic link: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return email, nil
+}
+
+func (s *SQLStore) GetAccountIDByIdentity(ctx context.Context, issuer, subject string) (_ string, err error) {
+	ctx, done := s.observe(ctx, "GetAccountIDByIdentity")
+	defer done(&err)
+
+	query := `SELECT AccountID FROM AccountIdentities WHERE Issuer = ? AND Subject = ?;`
+
+	var accountID string
+	err = s.DB.QueryRowContext(ctx, query, issuer, subject).Scan(&accountID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrIdentityNotFound
+		}
+		return "", fmt.Errorf("failed to get identity: %w", err)
+	}
+	return accountID, nil
+}
+
+func (s *SQLStore) LinkIdentity(ctx context.Context, issuer, subject, accountID string) (err error) {
+	ctx, done := s.observe(ctx, "LinkIdentity")
+	defer done(&err)
+
+	query := `INSERT INTO AccountIdentities (Issuer, Subject, AccountID) VALUES (?, ?, ?);`
+
+	_, err = s.DB.ExecContext(ctx, query, issuer, subject, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	return nil
+}
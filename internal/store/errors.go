@@ -0,0 +1,20 @@
+package store
+
+import "errors"
+
+// Lookups that find nothing return these, so callers can tell a missing
+// row from a failed query with errors.Is.
+var (
+	ErrRoomNotFound        = errors.New("room not found")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrOptionNotFound      = errors.New("option not found")
+	ErrVoteNotFound        = errors.New("vote not found")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrJoinRequestNotFound = errors.New("join request not found")
+	ErrAccountNotFound     = errors.New("account not found")
+	ErrMagicLinkNotFound   = errors.New("magic link not found")
+	ErrIdentityNotFound    = errors.New("identity not found")
+)
+
+// ErrRoomFull is returned when a room is at its participant limit.
+var ErrRoomFull = errors.New("room is full")
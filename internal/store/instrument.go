@@ -0,0 +1,37 @@
+package store
+
+import (
+	"context"
+	"time"
+	"websocket-chat/internal/metrics"
+	"websocket-chat/internal/tracing"
+)
+
+// observe applies the method's timeout, starts a span for it and returns a
+// function that ends both and records the method's latency and outcome.
+// Methods call it as
+//
+//	ctx, done := s.observe(ctx, "Name")
+//	defer done(&err)
+//
+// with a named error result.
+func (s *SQLStore) observe(ctx context.Context, method string) (context.Context, func(*error)) {
+	start := time.Now()
+	cancel := context.CancelFunc(func() {})
+	if timeout := s.timeout(method); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	ctx, span := tracing.Start(ctx, "store."+method)
+	return ctx, func(err *error) {
+		cancel()
+		metrics.ObserveStore(method, time.Since(start), *err)
+		tracing.End(span, *err)
+	}
+}
+
+func (s *SQLStore) timeout(method string) time.Duration {
+	if timeout, ok := s.methodTimeouts[method]; ok {
+		return timeout
+	}
+	return s.queryTimeout
+}
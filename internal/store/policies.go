@@ -0,0 +1,221 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"websocket-chat/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// GetRoomPolicy returns the room's access policy. Rooms without a stored
+// policy are open to anyone.
+func (s *SQLStore) GetRoomPolicy(ctx context.Context, roomID string) (_ *models.RoomPolicy, err error) {
+	ctx, done := s.observe(ctx, "GetRoomPolicy")
+	defer done(&err)
+
+	query := `
+        SELECT HostUserID, PasscodeHash, MaxParticipants, InviteOnly, RequireApproval
+        FROM RoomPolicies WHERE RoomID = ?;
+    `
+
+	policy := &models.RoomPolicy{RoomID: roomID}
+	err = s.DB.QueryRowContext(ctx, query, roomID).Scan(&policy.HostUserID, &policy.PasscodeHash, &policy.MaxParticipants, &policy.InviteOnly, &policy.RequireApproval)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get room policy: %w", err)
+	}
+
+	policy.HasPasscode = policy.PasscodeHash != ""
+	return policy, nil
+}
+
+func (s *SQLStore) SaveRoomPolicy(ctx context.Context, policy *models.RoomPolicy) (err error) {
+	ctx, done := s.observe(ctx, "SaveRoomPolicy")
+	defer done(&err)
+
+	query := `
+        INSERT INTO RoomPolicies (RoomID, HostUserID, PasscodeHash, MaxParticipants, InviteOnly, RequireApproval)
+        VALUES (?, ?, ?, ?, ?, ?)
+        ON CONFLICT (RoomID) DO UPDATE SET
+            HostUserID = excluded.HostUserID,
+            PasscodeHash = excluded.PasscodeHash,
+            MaxParticipants = excluded.MaxParticipants,
+            InviteOnly = excluded.InviteOnly,
+            RequireApproval = excluded.RequireApproval;
+    `
+
+	_, err = s.DB.ExecContext(ctx, query, policy.RoomID, policy.HostUserID, policy.PasscodeHash, policy.MaxParticipants, policy.InviteOnly, policy.RequireApproval)
+	if err != nil {
+		return fmt.Errorf("failed to save room policy: %w", err)
+	}
+	return nil
+}
+
+// NewParticipant is a user joining a room. OptionContent and AccountID are
+// optional.
+type NewParticipant struct {
+	RoomID        string
+	DisplayName   string
+	OptionContent string
+	AccountID     string
+}
+
+// JoinRoom adds a participant in one transaction: the user, the host claim
+// when the room has no host yet, a pending join request when the room
+// requires approval, the account link and the option. A room that requires
+// approval is never claimed: if its host left with nobody to hand it to,
+// joiners wait rather than admit themselves. The user is inserted
+// first so the capacity check runs under the write lock and concurrent
+// joins cannot overfill the room. It returns ErrRoomFull, and writes
+// nothing, when the room is at its participant limit. Denied join requests
+// do not count towards the limit.
+func (s *SQLStore) JoinRoom(ctx context.Context, p NewParticipant) (_ *models.User, pending bool, err error) {
+	ctx, done := s.observe(ctx, "JoinRoom")
+	defer done(&err)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	user := &models.User{UserID: uuid.New().String(), RoomID: p.RoomID, DisplayName: p.DisplayName}
+	_, err = tx.ExecContext(ctx, `INSERT INTO Users (UserID, RoomID, DisplayName) VALUES (?, ?, ?);`, user.UserID, user.RoomID, user.DisplayName)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO RoomPolicies (RoomID, HostUserID) VALUES (?, ?)
+        ON CONFLICT (RoomID) DO UPDATE SET HostUserID = excluded.HostUserID
+        WHERE RoomPolicies.HostUserID = '' AND NOT RoomPolicies.RequireApproval;
+    `, p.RoomID, user.UserID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to claim room host: %w", err)
+	}
+
+	var hostUserID string
+	var maxParticipants int
+	var requireApproval bool
+	err = tx.QueryRowContext(ctx, `
+        SELECT HostUserID, MaxParticipants, RequireApproval FROM RoomPolicies WHERE RoomID = ?;
+    `, p.RoomID).Scan(&hostUserID, &maxParticipants, &requireApproval)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get room policy: %w", err)
+	}
+
+	if maxParticipants > 0 {
+		var count int
+		err = tx.QueryRowContext(ctx, `
+            SELECT COUNT(*) FROM Users u
+            LEFT JOIN JoinRequests j ON j.UserID = u.UserID
+            WHERE u.RoomID = ? AND (j.Status IS NULL OR j.Status != ?);
+        `, p.RoomID, models.JoinDenied).Scan(&count)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to count participants: %w", err)
+		}
+		if count > maxParticipants {
+			return nil, false, ErrRoomFull
+		}
+	}
+
+	pending = requireApproval && hostUserID != user.UserID
+	if pending {
+		_, err = tx.ExecContext(ctx, `INSERT INTO JoinRequests (UserID, RoomID, Status, CreatedAt) VALUES (?, ?, ?, ?);`,
+			user.UserID, p.RoomID, models.JoinPending, time.Now().Unix())
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to create join request: %w", err)
+		}
+	}
+
+	if p.AccountID != "" {
+		_, err = tx.ExecContext(ctx, `INSERT INTO AccountMemberships (UserID, AccountID, RoomID, CreatedAt) VALUES (?, ?, ?, ?);`,
+			user.UserID, p.AccountID, p.RoomID, time.Now().Unix())
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to link user to account: %w", err)
+		}
+	}
+
+	if p.OptionContent != "" {
+		_, err = tx.ExecContext(ctx, `INSERT INTO Options (OptionID, RoomID, UserID, Content) VALUES (?, ?, ?, ?);`,
+			uuid.New().String(), p.RoomID, user.UserID, p.OptionContent)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to create option: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return user, pending, nil
+}
+
+// GetJoinStatus returns the user's join request status, or JoinApproved for
+// users who joined without needing approval.
+func (s *SQLStore) GetJoinStatus(ctx context.Context, userID string) (_ string, err error) {
+	ctx, done := s.observe(ctx, "GetJoinStatus")
+	defer done(&err)
+
+	query := `SELECT Status FROM JoinRequests WHERE UserID = ?;`
+
+	var status string
+	err = s.DB.QueryRowContext(ctx, query, userID).Scan(&status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.JoinApproved, nil
+		}
+		return "", fmt.Errorf("failed to get join status: %w", err)
+	}
+	return status, nil
+}
+
+func (s *SQLStore) DecideJoinRequest(ctx context.Context, roomID, userID, status string) (err error) {
+	ctx, done := s.observe(ctx, "DecideJoinRequest")
+	defer done(&err)
+
+	query := `UPDATE JoinRequests SET Status = ? WHERE UserID = ? AND RoomID = ? AND Status = ?;`
+
+	result, err := s.DB.ExecContext(ctx, query, status, userID, roomID, models.JoinPending)
+	if err != nil {
+		return fmt.Errorf("failed to update join request: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update join request: %w", err)
+	}
+	if rows == 0 {
+		return ErrJoinRequestNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) GetPendingJoinRequests(ctx context.Context, roomID string) (_ []models.JoinRequest, err error) {
+	ctx, done := s.observe(ctx, "GetPendingJoinRequests")
+	defer done(&err)
+
+	query := `
+        SELECT j.UserID, u.DisplayName
+        FROM JoinRequests j
+        JOIN Users u ON u.UserID = j.UserID
+        WHERE j.RoomID = ? AND j.Status = ?
+        ORDER BY j.CreatedAt;
+    `
+
+	rows, err := s.DB.QueryContext(ctx, query, roomID, models.JoinPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get join requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := []models.JoinRequest{}
+	for rows.Next() {
+		request := models.JoinRequest{RoomID: roomID, Status: models.JoinPending}
+		if err := rows.Scan(&request.UserID, &request.DisplayName); err != nil {
+			return nil, fmt.Errorf("failed to scan join request: %w", err)
+		}
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
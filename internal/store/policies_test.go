@@ -0,0 +1,87 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"websocket-chat/internal/models"
+	"websocket-chat/internal/store"
+	"websocket-chat/internal/store/storetest"
+)
+
+func TestDeleteUserHandsOverHost(t *testing.T) {
+	tests := []struct {
+		name            string
+		requireApproval bool
+		admitted        bool
+		waiting         bool
+		admittedHosts   bool
+		strangerPending bool
+		strangerHosts   bool
+	}{
+		{name: "approval with an admitted participant", requireApproval: true, admitted: true, waiting: true, admittedHosts: true, strangerPending: true},
+		{name: "approval with only a waiting participant", requireApproval: true, waiting: true, strangerPending: true},
+		{name: "approval with nobody left", requireApproval: true, strangerPending: true},
+		{name: "open room with a participant", admitted: true, admittedHosts: true},
+		{name: "open room with nobody left", strangerHosts: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := storetest.New(t)
+			room, err := s.CreateRoom(ctx, "Planning")
+			if err != nil {
+				t.Fatal(err)
+			}
+			join := func(name string) (*models.User, bool) {
+				t.Helper()
+				user, pending, err := s.JoinRoom(ctx, store.NewParticipant{RoomID: room.RoomID, DisplayName: name})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return user, pending
+			}
+
+			host, _ := join("Host")
+			var admitted *models.User
+			if tt.admitted {
+				admitted, _ = join("Admitted")
+			}
+			policy := &models.RoomPolicy{RoomID: room.RoomID, HostUserID: host.UserID, RequireApproval: tt.requireApproval}
+			if err := s.SaveRoomPolicy(ctx, policy); err != nil {
+				t.Fatal(err)
+			}
+			if tt.waiting {
+				if _, pending := join("Waiting"); !pending {
+					t.Fatal("join did not wait for approval")
+				}
+			}
+
+			if err := s.DeleteUser(ctx, room.RoomID, host.UserID); err != nil {
+				t.Fatal(err)
+			}
+			policy, err = s.GetRoomPolicy(ctx, room.RoomID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := ""
+			if tt.admittedHosts {
+				want = admitted.UserID
+			}
+			if policy.HostUserID != want {
+				t.Errorf("host after leaving = %q, want %q", policy.HostUserID, want)
+			}
+
+			stranger, pending := join("Stranger")
+			if pending != tt.strangerPending {
+				t.Errorf("stranger pending = %v, want %v", pending, tt.strangerPending)
+			}
+			policy, err = s.GetRoomPolicy(ctx, room.RoomID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hosts := policy.HostUserID == stranger.UserID; hosts != tt.strangerHosts {
+				t.Errorf("stranger hosts = %v, want %v", hosts, tt.strangerHosts)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TakeRateLimitToken refills the bucket for the time since it was last used
+// and takes one token in a single statement, so concurrent instances never
+// spend the same token. It returns the tokens left, or on refusal the tokens
+// currently available.
+func (s *SQLStore) TakeRateLimitToken(ctx context.Context, key string, capacity, refillPerMs float64, now time.Time) (_ bool, _ float64, err error) {
+	ctx, done := s.observe(ctx, "TakeRateLimitToken")
+	defer done(&err)
+
+	query := `
+        INSERT INTO RateLimits (BucketKey, Tokens, UpdatedAt) VALUES (?, ?, ?)
+        ON CONFLICT (BucketKey) DO UPDATE SET
+            Tokens = MIN(?, Tokens + MAX(0, excluded.UpdatedAt - UpdatedAt) * ?) - 1,
+            UpdatedAt = excluded.UpdatedAt
+        WHERE MIN(?, Tokens + MAX(0, excluded.UpdatedAt - UpdatedAt) * ?) >= 1
+        RETURNING Tokens;
+    `
+
+	ms := now.UnixMilli()
+	var tokens float64
+	err = s.DB.QueryRowContext(ctx, query, key, capacity-1, ms, capacity, refillPerMs, capacity, refillPerMs).Scan(&tokens)
+	if err == nil {
+		return true, tokens, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, 0, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+
+	var updatedAt int64
+	err = s.DB.QueryRowContext(ctx, `SELECT Tokens, UpdatedAt FROM RateLimits WHERE BucketKey = ?;`, key).Scan(&tokens, &updatedAt)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to read rate limit bucket: %w", err)
+	}
+	return false, min(capacity, tokens+float64(max(0, ms-updatedAt))*refillPerMs), nil
+}
+
+// PruneRateLimits drops buckets that have not been touched since before.
+func (s *SQLStore) PruneRateLimits(ctx context.Context, before time.Time) (err error) {
+	ctx, done := s.observe(ctx, "PruneRateLimits")
+	defer done(&err)
+
+	_, err = s.DB.ExecContext(ctx, `DELETE FROM RateLimits WHERE UpdatedAt < ?;`, before.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to prune rate limits: %w", err)
+	}
+	return nil
+}
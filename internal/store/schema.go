@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Schema changes made after the original Rooms, Users, Options, Votes and
+// Dates tables. Entries are applied once, in order, and must never be edited
+// after release; append a new entry instead.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS Sessions (
+		SessionID TEXT PRIMARY KEY,
+		UserID TEXT NOT NULL,
+		RoomID TEXT NOT NULL,
+		RefreshTokenHash TEXT NOT NULL UNIQUE,
+		ExpiresAt INTEGER NOT NULL,
+		RevokedAt INTEGER
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_sessions_revoked ON Sessions (RevokedAt);`,
+	`ALTER TABLE Sessions ADD COLUMN AccountID TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE Accounts (
+		AccountID TEXT PRIMARY KEY,
+		Email TEXT NOT NULL UNIQUE,
+		PasswordHash TEXT NOT NULL DEFAULT '',
+		CreatedAt INTEGER NOT NULL
+	);`,
+	`CREATE TABLE AccountMemberships (
+		UserID TEXT PRIMARY KEY,
+		AccountID TEXT NOT NULL,
+		RoomID TEXT NOT NULL,
+		CreatedAt INTEGER NOT NULL,
+		UNIQUE (AccountID, RoomID)
+	);`,
+	`CREATE TABLE MagicLinks (
+		TokenHash TEXT PRIMARY KEY,
+		Email TEXT NOT NULL,
+		ExpiresAt INTEGER NOT NULL,
+		UsedAt INTEGER
+	);`,
+	`CREATE TABLE AccountIdentities (
+		Issuer TEXT NOT NULL,
+		Subject TEXT NOT NULL,
+		AccountID TEXT NOT NULL,
+		PRIMARY KEY (Issuer, Subject)
+	);`,
+	`CREATE TABLE RoomPolicies (
+		RoomID TEXT PRIMARY KEY,
+		HostUserID TEXT NOT NULL DEFAULT '',
+		PasscodeHash TEXT NOT NULL DEFAULT '',
+		MaxParticipants INTEGER NOT NULL DEFAULT 0,
+		InviteOnly INTEGER NOT NULL DEFAULT 0,
+		RequireApproval INTEGER NOT NULL DEFAULT 0
+	);`,
+	`CREATE TABLE JoinRequests (
+		UserID TEXT PRIMARY KEY,
+		RoomID TEXT NOT NULL,
+		Status TEXT NOT NULL,
+		CreatedAt INTEGER NOT NULL
+	);`,
+	`CREATE TABLE RateLimits (
+		BucketKey TEXT PRIMARY KEY,
+		Tokens REAL NOT NULL,
+		UpdatedAt INTEGER NOT NULL
+	);`,
+	`DELETE FROM Dates WHERE rowid NOT IN (SELECT MIN(rowid) FROM Dates GROUP BY UserID, RoomID, Date);`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_dates_user_room_date ON Dates (UserID, RoomID, Date);`,
+	`CREATE INDEX IF NOT EXISTS idx_users_room ON Users (RoomID);`,
+	`CREATE INDEX IF NOT EXISTS idx_options_room ON Options (RoomID);`,
+	`CREATE INDEX IF NOT EXISTS idx_votes_option ON Votes (OptionID);`,
+	`CREATE INDEX IF NOT EXISTS idx_dates_room_date ON Dates (RoomID, Date);`,
+}
+
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	_, err := s.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS SchemaMigrations (Version INTEGER PRIMARY KEY);`)
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var current sql.NullInt64
+	err = s.DB.QueryRowContext(ctx, `SELECT MAX(Version) FROM SchemaMigrations;`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := int(current.Int64); i < len(migrations); i++ {
+		if err := s.applyMigration(ctx, i+1, migrations[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) applyMigration(ctx context.Context, version int, stmt string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("failed to apply migration %d: %w", version, err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO SchemaMigrations (Version) VALUES (?);`, version); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d: %w", version, err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"websocket-chat/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func (s *SQLStore) CreateSession(ctx context.Context, userID, roomID, accountID, refreshTokenHash string, expiresAt time.Time) (_ *models.Session, err error) {
+	ctx, done := s.observe(ctx, "CreateSession")
+	defer done(&err)
+
+	session := &models.Session{
+		SessionID: uuid.New().String(),
+		UserID:    userID,
+		RoomID:    roomID,
+		AccountID: accountID,
+		ExpiresAt: expiresAt,
+	}
+	query := `INSERT INTO Sessions (SessionID, UserID, RoomID, AccountID, RefreshTokenHash, ExpiresAt) VALUES (?, ?, ?, ?, ?, ?);`
+
+	_, err = s.DB.ExecContext(ctx, query, session.SessionID, session.UserID, session.RoomID, session.AccountID, refreshTokenHash, expiresAt.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return session, nil
+}
+
+func (s *SQLStore) GetSessionByRefreshTokenHash(ctx context.Context, refreshTokenHash string) (_ *models.Session, err error) {
+	ctx, done := s.observe(ctx, "GetSessionByRefreshTokenHash")
+	defer done(&err)
+
+	query := `SELECT SessionID, UserID, RoomID, AccountID, ExpiresAt, RevokedAt FROM Sessions WHERE RefreshTokenHash = ?;`
+
+	session := &models.Session{}
+	var expiresAt int64
+	var revokedAt sql.NullInt64
+
+	err = s.DB.QueryRowContext(ctx, query, refreshTokenHash).Scan(&session.SessionID, &session.UserID, &session.RoomID, &session.AccountID, &expiresAt, &revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	session.ExpiresAt = time.Unix(expiresAt, 0)
+	if revokedAt.Valid {
+		t := time.Unix(revokedAt.Int64, 0)
+		session.RevokedAt = &t
+	}
+	return session, nil
+}
+
+// RotateRefreshToken swaps the session's refresh token, failing if the old
+// one has already been used or the session was revoked in the meantime.
+func (s *SQLStore) RotateRefreshToken(ctx context.Context, sessionID, oldHash, newHash string, expiresAt time.Time) (err error) {
+	ctx, done := s.observe(ctx, "RotateRefreshToken")
+	defer done(&err)
+
+	query := `
+        UPDATE Sessions SET RefreshTokenHash = ?, ExpiresAt = ?
+        WHERE SessionID = ? AND RefreshTokenHash = ? AND RevokedAt IS NULL;
+    `
+
+	result, err := s.DB.ExecContext(ctx, query, newHash, expiresAt.Unix(), sessionID, oldHash)
+	if err != nil {
+		return fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) RevokeSession(ctx context.Context, sessionID string) (err error) {
+	ctx, done := s.observe(ctx, "RevokeSession")
+	defer done(&err)
+
+	query := `UPDATE Sessions SET RevokedAt = ? WHERE SessionID = ? AND RevokedAt IS NULL;`
+
+	_, err = s.DB.ExecContext(ctx, query, time.Now().Unix(), sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes every live session of a participant and
+// returns their IDs.
+func (s *SQLStore) RevokeUserSessions(ctx context.Context, userID string) (_ []string, err error) {
+	ctx, done := s.observe(ctx, "RevokeUserSessions")
+	defer done(&err)
+
+	return s.revokeSessions(ctx, `UserID = ?`, userID)
+}
+
+// RevokeRoomSessions revokes every live session in a room and returns their
+// IDs.
+func (s *SQLStore) RevokeRoomSessions(ctx context.Context, roomID string) (_ []string, err error) {
+	ctx, done := s.observe(ctx, "RevokeRoomSessions")
+	defer done(&err)
+
+	return s.revokeSessions(ctx, `RoomID = ?`, roomID)
+}
+
+func (s *SQLStore) revokeSessions(ctx context.Context, where string, arg string) ([]string, error) {
+	query := `UPDATE Sessions SET RevokedAt = ? WHERE ` + where + ` AND RevokedAt IS NULL RETURNING SessionID;`
+
+	rows, err := s.DB.QueryContext(ctx, query, time.Now().Unix(), arg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessionIDs []string
+	for rows.Next() {
+		var sessionID string
+		if err := rows.Scan(&sessionID); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	return sessionIDs, rows.Err()
+}
+
+func (s *SQLStore) GetSessionsRevokedSince(ctx context.Context, since time.Time) (_ []models.Session, err error) {
+	ctx, done := s.observe(ctx, "GetSessionsRevokedSince")
+	defer done(&err)
+
+	query := `SELECT SessionID, UserID, RoomID, AccountID, ExpiresAt, RevokedAt FROM Sessions WHERE RevokedAt >= ?;`
+
+	rows, err := s.DB.QueryContext(ctx, query, since.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revoked sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var session models.Session
+		var expiresAt, revokedAt int64
+		err := rows.Scan(&session.SessionID, &session.UserID, &session.RoomID, &session.AccountID, &expiresAt, &revokedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		session.ExpiresAt = time.Unix(expiresAt, 0)
+		t := time.Unix(revokedAt, 0)
+		session.RevokedAt = &t
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 	"websocket-chat/internal/models"
 
 	"github.com/google/uuid"
@@ -11,6 +14,9 @@ import (
 
 type SQLStore struct {
 	DB *sql.DB
+
+	queryTimeout   time.Duration
+	methodTimeouts map[string]time.Duration
 }
 
 func NewSQLStore(db *sql.DB) *SQLStore {
@@ -19,7 +25,25 @@ func NewSQLStore(db *sql.DB) *SQLStore {
 	}
 }
 
-func (s *SQLStore) CreateRoom(name string) (*models.Room, error) {
+// SetQueryTimeouts bounds how long each method may run: methods named in
+// perMethod get their own limit and the rest get def. Zero means no limit.
+// It must be called before the store is used.
+func (s *SQLStore) SetQueryTimeouts(def time.Duration, perMethod map[string]time.Duration) {
+	s.queryTimeout = def
+	s.methodTimeouts = perMethod
+}
+
+func (s *SQLStore) Ping(ctx context.Context) (err error) {
+	ctx, done := s.observe(ctx, "Ping")
+	defer done(&err)
+
+	return s.DB.PingContext(ctx)
+}
+
+func (s *SQLStore) CreateRoom(ctx context.Context, name string) (_ *models.Room, err error) {
+	ctx, done := s.observe(ctx, "CreateRoom")
+	defer done(&err)
+
 	roomID := uuid.New().String()
 
 	room := &models.Room{
@@ -28,7 +52,7 @@ func (s *SQLStore) CreateRoom(name string) (*models.Room, error) {
 	}
 	query := `INSERT INTO Rooms (RoomID, Name) VALUES (?, ?);`
 
-	_, err := s.DB.ExecContext(context.Background(), query, room.RoomID, room.Name)
+	_, err = s.DB.ExecContext(ctx, query, room.RoomID, room.Name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create room: %w", err)
 	}
@@ -36,15 +60,18 @@ func (s *SQLStore) CreateRoom(name string) (*models.Room, error) {
 	return room, nil
 }
 
-func (s *SQLStore) GetRoomByID(roomID string) (*models.Room, error) {
+func (s *SQLStore) GetRoomByID(ctx context.Context, roomID string) (_ *models.Room, err error) {
+	ctx, done := s.observe(ctx, "GetRoomByID")
+	defer done(&err)
+
 	query := `SELECT RoomID, Name FROM Rooms WHERE RoomID = ?;`
 
 	room := &models.Room{}
 
-	err := s.DB.QueryRowContext(context.Background(), query, roomID).Scan(&room.RoomID, &room.Name)
+	err = s.DB.QueryRowContext(ctx, query, roomID).Scan(&room.RoomID, &room.Name)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("room not found")
+			return nil, ErrRoomNotFound
 		}
 		return nil, fmt.Errorf("failed to get room: %w", err)
 	}
@@ -52,7 +79,10 @@ func (s *SQLStore) GetRoomByID(roomID string) (*models.Room, error) {
 	return room, nil
 }
 
-func (s *SQLStore) CreateUser(roomID, displayName string) (*models.User, error) {
+func (s *SQLStore) CreateUser(ctx context.Context, roomID, displayName string) (_ *models.User, err error) {
+	ctx, done := s.observe(ctx, "CreateUser")
+	defer done(&err)
+
 	userID := uuid.New().String()
 
 	user := &models.User{
@@ -62,7 +92,7 @@ func (s *SQLStore) CreateUser(roomID, displayName string) (*models.User, error)
 	}
 	query := `INSERT INTO Users (UserID, RoomID, DisplayName) VALUES (?, ?, ?);`
 
-	_, err := s.DB.ExecContext(context.Background(), query, user.UserID, user.RoomID, user.DisplayName)
+	_, err = s.DB.ExecContext(ctx, query, user.UserID, user.RoomID, user.DisplayName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
@@ -70,15 +100,18 @@ func (s *SQLStore) CreateUser(roomID, displayName string) (*models.User, error)
 	return user, nil
 }
 
-func (s *SQLStore) GetUserByID(userID string) (*models.User, error) {
+func (s *SQLStore) GetUserByID(ctx context.Context, userID string) (_ *models.User, err error) {
+	ctx, done := s.observe(ctx, "GetUserByID")
+	defer done(&err)
+
 	query := `SELECT UserID, RoomID, DisplayName FROM Users WHERE UserID = ?;`
 
 	user := &models.User{}
 
-	err := s.DB.QueryRowContext(context.Background(), query, userID).Scan(&user.UserID, &user.RoomID, &user.DisplayName)
+	err = s.DB.QueryRowContext(ctx, query, userID).Scan(&user.UserID, &user.RoomID, &user.DisplayName)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -86,7 +119,10 @@ func (s *SQLStore) GetUserByID(userID string) (*models.User, error) {
 	return user, nil
 }
 
-func (s *SQLStore) CreateOption(roomID, userID, content string) (*models.Option, error) {
+func (s *SQLStore) CreateOption(ctx context.Context, roomID, userID, content string) (_ *models.Option, err error) {
+	ctx, done := s.observe(ctx, "CreateOption")
+	defer done(&err)
+
 	optionID := uuid.New().String()
 
 	option := &models.Option{
@@ -97,7 +133,7 @@ func (s *SQLStore) CreateOption(roomID, userID, content string) (*models.Option,
 	}
 	query := `INSERT INTO Options (OptionID, RoomID, UserID, Content) VALUES (?, ?, ?, ?);`
 
-	_, err := s.DB.ExecContext(context.Background(), query, option.OptionID, option.RoomID, option.UserID, option.Content)
+	_, err = s.DB.ExecContext(ctx, query, option.OptionID, option.RoomID, option.UserID, option.Content)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create option: %w", err)
 	}
@@ -105,15 +141,18 @@ func (s *SQLStore) CreateOption(roomID, userID, content string) (*models.Option,
 	return option, nil
 }
 
-func (s *SQLStore) GetOption(optionID string) (*models.Option, error) {
+func (s *SQLStore) GetOption(ctx context.Context, optionID string) (_ *models.Option, err error) {
+	ctx, done := s.observe(ctx, "GetOption")
+	defer done(&err)
+
 	query := `SELECT OptionID, RoomID, UserID, content FROM Options WHERE OptionID = ?;`
 
 	option := &models.Option{}
 
-	err := s.DB.QueryRowContext(context.Background(), query, optionID).Scan(&option.OptionID, &option.RoomID, &option.UserID, &option.Content)
+	err = s.DB.QueryRowContext(ctx, query, optionID).Scan(&option.OptionID, &option.RoomID, &option.UserID, &option.Content)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("option not found")
+			return nil, ErrOptionNotFound
 		}
 		return nil, fmt.Errorf("failed to get option: %w", err)
 	}
@@ -121,7 +160,10 @@ func (s *SQLStore) GetOption(optionID string) (*models.Option, error) {
 	return option, nil
 }
 
-func (s *SQLStore) CreateVote(optionID, userID string) (*models.Vote, error) {
+func (s *SQLStore) CreateVote(ctx context.Context, optionID, userID string) (_ *models.Vote, err error) {
+	ctx, done := s.observe(ctx, "CreateVote")
+	defer done(&err)
+
 	voteID := uuid.New().String()
 
 	vote := &models.Vote{
@@ -131,7 +173,7 @@ func (s *SQLStore) CreateVote(optionID, userID string) (*models.Vote, error) {
 	}
 	query := `INSERT INTO Votes ( VoteID, OptionID, UserID ) VALUES (?, ?, ?);`
 
-	_, err := s.DB.ExecContext(context.Background(), query, vote.VoteID, vote.OptionID, vote.UserID)
+	_, err = s.DB.ExecContext(ctx, query, vote.VoteID, vote.OptionID, vote.UserID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create vote: %w", err)
 	}
@@ -139,15 +181,18 @@ func (s *SQLStore) CreateVote(optionID, userID string) (*models.Vote, error) {
 	return vote, nil
 }
 
-func (s *SQLStore) GetVote(voteID string) (*models.Vote, error) {
+func (s *SQLStore) GetVote(ctx context.Context, voteID string) (_ *models.Vote, err error) {
+	ctx, done := s.observe(ctx, "GetVote")
+	defer done(&err)
+
 	query := `SELECT VoteID, OptionID, UserID FROM Votes WHERE VoteID = ?;`
 
 	vote := &models.Vote{}
 
-	err := s.DB.QueryRowContext(context.Background(), query, voteID).Scan(&vote.VoteID, &vote.OptionID, &vote.UserID)
+	err = s.DB.QueryRowContext(ctx, query, voteID).Scan(&vote.VoteID, &vote.OptionID, &vote.UserID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("vote not found")
+			return nil, ErrVoteNotFound
 		}
 		return nil, fmt.Errorf("failed to get vote: %w", err)
 	}
@@ -155,42 +200,84 @@ func (s *SQLStore) GetVote(voteID string) (*models.Vote, error) {
 	return vote, nil
 }
 
-func (s *SQLStore) GetFullRoomState(roomID string) (*FullRoomStateMessage, error) {
-	room, err := s.GetRoomByID(roomID)
-	if err != nil {
-		return nil, err
-	}
+// GetFullRoomState loads the room with its admitted users, their options
+// and the votes in one round trip. Each row is tagged with what it holds.
+func (s *SQLStore) GetFullRoomState(ctx context.Context, roomID string) (_ *FullRoomStateMessage, err error) {
+	ctx, done := s.observe(ctx, "GetFullRoomState")
+	defer done(&err)
 
-	users, err := s.GetUsersByRoomID(roomID)
-	if err != nil {
-		return nil, err
-	}
+	query := `
+        SELECT 'room', r.Name, '', ''
+        FROM Rooms r
+        WHERE r.RoomID = ?
+        UNION ALL
+        SELECT 'user', u.UserID, u.DisplayName, ''
+        FROM Users u
+        LEFT JOIN JoinRequests j ON j.UserID = u.UserID
+        WHERE u.RoomID = ? AND (j.Status IS NULL OR j.Status = ?)
+        UNION ALL
+        SELECT 'option', o.OptionID, o.UserID, o.Content
+        FROM Options o
+        LEFT JOIN JoinRequests j ON j.UserID = o.UserID
+        WHERE o.RoomID = ? AND (j.Status IS NULL OR j.Status = ?)
+        UNION ALL
+        SELECT 'vote', v.VoteID, v.OptionID, v.UserID
+        FROM Votes v
+        JOIN Options o ON v.OptionID = o.OptionID
+        WHERE o.RoomID = ?;
+    `
 
-	options, err := s.GetOptionsByRoomID(roomID)
+	rows, err := s.DB.QueryContext(ctx, query, roomID, roomID, models.JoinApproved, roomID, models.JoinApproved, roomID)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to get room state: %w", err)
 	}
+	defer rows.Close()
 
-	votes, err := s.GetVotesByRoomID(roomID)
-	if err != nil {
-		return nil, err
+	var state *FullRoomStateMessage
+	var users []models.User
+	var options []models.Option
+	var votes []models.Vote
+	for rows.Next() {
+		var kind, a, b, c string
+		if err := rows.Scan(&kind, &a, &b, &c); err != nil {
+			return nil, fmt.Errorf("failed to scan room state: %w", err)
+		}
+		switch kind {
+		case "room":
+			state = &FullRoomStateMessage{RoomName: a}
+		case "user":
+			users = append(users, models.User{UserID: a, RoomID: roomID, DisplayName: b})
+		case "option":
+			options = append(options, models.Option{OptionID: a, RoomID: roomID, UserID: b, Content: c})
+		case "vote":
+			votes = append(votes, models.Vote{VoteID: a, OptionID: b, UserID: c})
+		}
 	}
-
-	fullState := &FullRoomStateMessage{
-		RoomName:    room.Name,
-		Users:       users,
-		Options:     options,
-		Votes:       votes,
-		RevealVotes: false,
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get room state: %w", err)
+	}
+	if state == nil {
+		return nil, ErrRoomNotFound
 	}
 
-	return fullState, nil
+	state.Users = users
+	state.Options = options
+	state.Votes = votes
+	return state, nil
 }
 
-func (s *SQLStore) GetUsersByRoomID(roomID string) ([]models.User, error) {
-	query := `SELECT UserID, DisplayName FROM Users WHERE RoomID = ?;`
+func (s *SQLStore) GetUsersByRoomID(ctx context.Context, roomID string) (_ []models.User, err error) {
+	ctx, done := s.observe(ctx, "GetUsersByRoomID")
+	defer done(&err)
 
-	rows, err := s.DB.Query(query, roomID)
+	query := `
+        SELECT u.UserID, u.DisplayName
+        FROM Users u
+        LEFT JOIN JoinRequests j ON j.UserID = u.UserID
+        WHERE u.RoomID = ? AND (j.Status IS NULL OR j.Status = ?);
+    `
+
+	rows, err := s.DB.QueryContext(ctx, query, roomID, models.JoinApproved)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get users: %w", err)
 	}
@@ -209,10 +296,18 @@ func (s *SQLStore) GetUsersByRoomID(roomID string) ([]models.User, error) {
 	return users, nil
 }
 
-func (s *SQLStore) GetOptionsByRoomID(roomID string) ([]models.Option, error) {
-	query := `SELECT OptionID, UserID, Content FROM Options WHERE RoomID = ?;`
+func (s *SQLStore) GetOptionsByRoomID(ctx context.Context, roomID string) (_ []models.Option, err error) {
+	ctx, done := s.observe(ctx, "GetOptionsByRoomID")
+	defer done(&err)
+
+	query := `
+        SELECT o.OptionID, o.UserID, o.Content
+        FROM Options o
+        LEFT JOIN JoinRequests j ON j.UserID = o.UserID
+        WHERE o.RoomID = ? AND (j.Status IS NULL OR j.Status = ?);
+    `
 
-	rows, err := s.DB.Query(query, roomID)
+	rows, err := s.DB.QueryContext(ctx, query, roomID, models.JoinApproved)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get options: %w", err)
 	}
@@ -231,7 +326,10 @@ func (s *SQLStore) GetOptionsByRoomID(roomID string) ([]models.Option, error) {
 	return options, nil
 }
 
-func (s *SQLStore) GetVotesByRoomID(roomID string) ([]models.Vote, error) {
+func (s *SQLStore) GetVotesByRoomID(ctx context.Context, roomID string) (_ []models.Vote, err error) {
+	ctx, done := s.observe(ctx, "GetVotesByRoomID")
+	defer done(&err)
+
 	query := `
         SELECT v.VoteID, v.OptionID, v.UserID
         FROM Votes v
@@ -239,7 +337,7 @@ func (s *SQLStore) GetVotesByRoomID(roomID string) ([]models.Vote, error) {
         WHERE o.RoomID = ?;	
     `
 
-	rows, err := s.DB.Query(query, roomID)
+	rows, err := s.DB.QueryContext(ctx, query, roomID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get votes: %w", err)
 	}
@@ -257,10 +355,13 @@ func (s *SQLStore) GetVotesByRoomID(roomID string) ([]models.Vote, error) {
 	return votes, nil
 }
 
-func (s *SQLStore) GetOptionByUserID(userID string) ([]models.Option, error) {
+func (s *SQLStore) GetOptionByUserID(ctx context.Context, userID string) (_ []models.Option, err error) {
+	ctx, done := s.observe(ctx, "GetOptionByUserID")
+	defer done(&err)
+
 	query := `SELECT OptionID, RoomID, Content FROM Options WHERE UserID = ?;`
 
-	rows, err := s.DB.Query(query, userID)
+	rows, err := s.DB.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get options: %w", err)
 	}
@@ -279,21 +380,24 @@ func (s *SQLStore) GetOptionByUserID(userID string) ([]models.Option, error) {
 	return options, nil
 }
 
-func (s *SQLStore) ChangeVote(userID, newOptionID string) error {
-	tx, err := s.DB.Begin()
+func (s *SQLStore) ChangeVote(ctx context.Context, userID, newOptionID string) (err error) {
+	ctx, done := s.observe(ctx, "ChangeVote")
+	defer done(&err)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
 	var existingVoteID string
-	err = tx.QueryRow(`
+	err = tx.QueryRowContext(ctx, `
         SELECT VoteID FROM Votes WHERE UserID = ?
     `, userID).Scan(&existingVoteID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			voteID := uuid.New().String()
-			_, err = tx.Exec(`
+			_, err = tx.ExecContext(ctx, `
                 INSERT INTO Votes (VoteID, UserID, OptionID) VALUES (?, ?, ?)
             `, voteID, userID, newOptionID)
 			if err != nil {
@@ -303,7 +407,7 @@ func (s *SQLStore) ChangeVote(userID, newOptionID string) error {
 			return fmt.Errorf("failed to check existing vote: %w", err)
 		}
 	} else {
-		_, err = tx.Exec(`
+		_, err = tx.ExecContext(ctx, `
             UPDATE Votes SET OptionID = ? WHERE VoteID = ?
         `, newOptionID, existingVoteID)
 		if err != nil {
@@ -318,65 +422,212 @@ func (s *SQLStore) ChangeVote(userID, newOptionID string) error {
 	return nil
 }
 
-func (s *SQLStore) ChangeOption(userID, roomID, newContent string) error {
-	tx, err := s.DB.Begin()
+// voteChangeBatch is how many users' votes ApplyVoteChanges writes per
+// statement.
+const voteChangeBatch = 100
+
+// ApplyVoteChanges stores a batch of queued vote changes in one
+// transaction. Only each user's last change counts, and votes for options
+// or users deleted since they were cast are dropped, so applying the same
+// batch twice leaves the same votes.
+func (s *SQLStore) ApplyVoteChanges(ctx context.Context, changes []models.VoteChange) (err error) {
+	ctx, done := s.observe(ctx, "ApplyVoteChanges")
+	defer done(&err)
+
+	latest := make(map[string]models.VoteChange, len(changes))
+	var userIDs []string
+	for _, change := range changes {
+		if _, ok := latest[change.UserID]; !ok {
+			userIDs = append(userIDs, change.UserID)
+		}
+		latest[change.UserID] = change
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	var existingOptionID string
-	err = tx.QueryRow(`
+	for batch := range slices.Chunk(userIDs, voteChangeBatch) {
+		args := make([]interface{}, len(batch))
+		for i, userID := range batch {
+			args[i] = userID
+		}
+		query := `DELETE FROM Votes WHERE UserID IN (` + placeholders(len(batch)) + `);`
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to delete votes: %w", err)
+		}
+
+		var values []string
+		args = args[:0]
+		for _, userID := range batch {
+			change := latest[userID]
+			if change.OptionID == "" {
+				continue
+			}
+			values = append(values, "(?, ?, ?)")
+			args = append(args, change.VoteID, change.OptionID, change.UserID)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		query = `
+            INSERT INTO Votes (VoteID, OptionID, UserID)
+            SELECT column1, column2, column3 FROM (VALUES ` + strings.Join(values, ", ") + `)
+            WHERE column2 IN (SELECT OptionID FROM Options) AND column3 IN (SELECT UserID FROM Users);
+        `
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to insert votes: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ChangeOption sets the user's option, creating it on first use, and
+// returns it.
+func (s *SQLStore) ChangeOption(ctx context.Context, userID, roomID, newContent string) (_ *models.Option, err error) {
+	ctx, done := s.observe(ctx, "ChangeOption")
+	defer done(&err)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	option := &models.Option{RoomID: roomID, UserID: userID, Content: newContent}
+	err = tx.QueryRowContext(ctx, `
         SELECT OptionID FROM Options WHERE UserID = ?
-    `, userID).Scan(&existingOptionID)
+    `, userID).Scan(&option.OptionID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			optionID := uuid.New().String()
-			_, err = tx.Exec(`
-                INSERT INTO Options (OptionID, UserID, OptionID) VALUES (?, ?, ?)
-            `, optionID, roomID, userID, newContent)
+			option.OptionID = uuid.New().String()
+			_, err = tx.ExecContext(ctx, `
+                INSERT INTO Options (OptionID, RoomID, UserID, Content) VALUES (?, ?, ?, ?)
+            `, option.OptionID, roomID, userID, newContent)
 			if err != nil {
-				return fmt.Errorf("failed to insert new option: %w", err)
+				return nil, fmt.Errorf("failed to insert new option: %w", err)
 			}
 		} else {
-			return fmt.Errorf("failed to check existing option: %w", err)
+			return nil, fmt.Errorf("failed to check existing option: %w", err)
 		}
 	} else {
-		_, err = tx.Exec(`
+		_, err = tx.ExecContext(ctx, `
             UPDATE Options SET Content = ? WHERE OptionID = ?
-        `, newContent, existingOptionID)
+        `, newContent, option.OptionID)
 		if err != nil {
-			return fmt.Errorf("failed to update option: %w", err)
+			return nil, fmt.Errorf("failed to update option: %w", err)
 		}
 	}
 
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return option, nil
+}
+
+func (s *SQLStore) UpdateOption(ctx context.Context, optionID, content string) (err error) {
+	ctx, done := s.observe(ctx, "UpdateOption")
+	defer done(&err)
+
+	query := `UPDATE Options SET Content = ? WHERE OptionID = ?;`
+
+	result, err := s.DB.ExecContext(ctx, query, content, optionID)
+	if err != nil {
+		return fmt.Errorf("failed to update option: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update option: %w", err)
+	}
+	if rows == 0 {
+		return ErrOptionNotFound
+	}
+	return nil
+}
+
+// DeleteOption removes an option and the votes cast for it.
+func (s *SQLStore) DeleteOption(ctx context.Context, optionID string) (err error) {
+	ctx, done := s.observe(ctx, "DeleteOption")
+	defer done(&err)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM Votes WHERE OptionID = ?;`, optionID); err != nil {
+		return fmt.Errorf("failed to delete votes: %w", err)
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM Options WHERE OptionID = ?;`, optionID)
+	if err != nil {
+		return fmt.Errorf("failed to delete option: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete option: %w", err)
+	}
+	if rows == 0 {
+		return ErrOptionNotFound
+	}
+
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	return nil
+}
+
+// DeleteUserVote retracts the user's vote.
+func (s *SQLStore) DeleteUserVote(ctx context.Context, userID string) (err error) {
+	ctx, done := s.observe(ctx, "DeleteUserVote")
+	defer done(&err)
+
+	query := `DELETE FROM Votes WHERE UserID = ?;`
 
+	result, err := s.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete vote: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete vote: %w", err)
+	}
+	if rows == 0 {
+		return ErrVoteNotFound
+	}
 	return nil
 }
 
-func (s *SQLStore) ChangeUserName(userID, roomID, newName string) error {
-	tx, err := s.DB.Begin()
+func (s *SQLStore) ChangeUserName(ctx context.Context, userID, roomID, newName string) (err error) {
+	ctx, done := s.observe(ctx, "ChangeUserName")
+	defer done(&err)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
 	var existingUserID string
-	err = tx.QueryRow(`
+	err = tx.QueryRowContext(ctx, `
         SELECT UserID FROM Users WHERE UserID = ?
     `, userID).Scan(&existingUserID)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return fmt.Errorf("failed to find user: %w", err)
+			return ErrUserNotFound
 		} else {
 			return fmt.Errorf("failed to check existing user: %w", err)
 		}
 	} else {
-		_, err = tx.Exec(`
+		_, err = tx.ExecContext(ctx, `
             UPDATE Users SET DisplayName = ? WHERE UserID = ?
         `, newName, existingUserID)
 		if err != nil {
@@ -390,7 +641,10 @@ func (s *SQLStore) ChangeUserName(userID, roomID, newName string) error {
 	return nil
 }
 
-func (s *SQLStore) CreateDate(roomID, userID, dateContent string) (*models.Date, error) {
+func (s *SQLStore) CreateDate(ctx context.Context, roomID, userID, dateContent string) (_ *models.Date, err error) {
+	ctx, done := s.observe(ctx, "CreateDate")
+	defer done(&err)
+
 	dateID := uuid.New().String()
 
 	date := &models.Date{
@@ -401,7 +655,7 @@ func (s *SQLStore) CreateDate(roomID, userID, dateContent string) (*models.Date,
 	}
 	query := `INSERT INTO Dates (DateID, RoomID, UserID, Date) VALUES (?, ?, ?, ?);`
 
-	_, err := s.DB.ExecContext(context.Background(), query, date.DateID, date.RoomID, date.UserID, date.Date)
+	_, err = s.DB.ExecContext(ctx, query, date.DateID, date.RoomID, date.UserID, date.Date)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create date: %w", err)
 	}
@@ -409,11 +663,13 @@ func (s *SQLStore) CreateDate(roomID, userID, dateContent string) (*models.Date,
 	return date, nil
 }
 
-func (s *SQLStore) DeleteUserDates(roomID, userID string) error {
+func (s *SQLStore) DeleteUserDates(ctx context.Context, roomID, userID string) (err error) {
+	ctx, done := s.observe(ctx, "DeleteUserDates")
+	defer done(&err)
 
 	query := `DELETE FROM Dates WHERE UserID = ? AND RoomID = ?;`
 
-	_, err := s.DB.ExecContext(context.Background(), query, userID, roomID)
+	_, err = s.DB.ExecContext(ctx, query, userID, roomID)
 	if err != nil {
 		return fmt.Errorf("failed to create date: %w", err)
 	}
@@ -421,10 +677,103 @@ func (s *SQLStore) DeleteUserDates(roomID, userID string) error {
 	return nil
 }
 
-func (s *SQLStore) GetDateByUserID(userID string) ([]models.Date, error) {
+// dateInsertBatch is how many dates ReplaceUserAvailability inserts per
+// statement, keeping each well under SQLite's bound parameter limit.
+const dateInsertBatch = 100
+
+// ReplaceUserAvailability sets the user's dates in the room to dates in one
+// transaction and reports which were added and removed. Dates already held
+// are left in place, so retrying a replacement changes nothing.
+func (s *SQLStore) ReplaceUserAvailability(ctx context.Context, roomID, userID string, dates []string) (_ *models.AvailabilityChange, err error) {
+	ctx, done := s.observe(ctx, "ReplaceUserAvailability")
+	defer done(&err)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT Date FROM Dates WHERE UserID = ? AND RoomID = ?;`, userID, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dates: %w", err)
+	}
+	current := make(map[string]bool)
+	for rows.Next() {
+		var date string
+		if err := rows.Scan(&date); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan date: %w", err)
+		}
+		current[date] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get dates: %w", err)
+	}
+
+	change := &models.AvailabilityChange{UserID: userID, Added: []string{}, Removed: []string{}}
+	wanted := make(map[string]bool, len(dates))
+	for _, date := range dates {
+		if wanted[date] {
+			continue
+		}
+		wanted[date] = true
+		if !current[date] {
+			change.Added = append(change.Added, date)
+		}
+	}
+	for date := range current {
+		if !wanted[date] {
+			change.Removed = append(change.Removed, date)
+		}
+	}
+	slices.Sort(change.Added)
+	slices.Sort(change.Removed)
+
+	for batch := range slices.Chunk(change.Removed, dateInsertBatch) {
+		args := []interface{}{userID, roomID}
+		for _, date := range batch {
+			args = append(args, date)
+		}
+		query := `DELETE FROM Dates WHERE UserID = ? AND RoomID = ? AND Date IN (` + placeholders(len(batch)) + `);`
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return nil, fmt.Errorf("failed to delete dates: %w", err)
+		}
+	}
+
+	for batch := range slices.Chunk(change.Added, dateInsertBatch) {
+		values := make([]string, len(batch))
+		args := make([]interface{}, 0, 4*len(batch))
+		for i, date := range batch {
+			values[i] = "(?, ?, ?, ?)"
+			args = append(args, uuid.New().String(), roomID, userID, date)
+		}
+		query := `INSERT INTO Dates (DateID, RoomID, UserID, Date) VALUES ` + strings.Join(values, ", ") +
+			` ON CONFLICT (UserID, RoomID, Date) DO NOTHING;`
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return nil, fmt.Errorf("failed to create dates: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return change, nil
+}
+
+// placeholders returns n comma-separated bind parameters.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func (s *SQLStore) GetDateByUserID(ctx context.Context, userID string) (_ []models.Date, err error) {
+	ctx, done := s.observe(ctx, "GetDateByUserID")
+	defer done(&err)
+
 	query := `SELECT DateID, RoomID, Date FROM Dates WHERE UserID = ?;`
 
-	rows, err := s.DB.Query(query, userID)
+	rows, err := s.DB.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get dates: %w", err)
 	}
@@ -443,34 +792,45 @@ func (s *SQLStore) GetDateByUserID(userID string) ([]models.Date, error) {
 	return dates, nil
 }
 
-func (s *SQLStore) GetDatesByRoomID(roomID string) (*models.RoomDatesResponse, error) {
-	users, err := s.GetUsersByRoomID(roomID)
+// GetDatesByRoomID lists the room's dates, earliest first, with the
+// admitted users available on each.
+func (s *SQLStore) GetDatesByRoomID(ctx context.Context, roomID string) (_ *models.RoomDatesResponse, err error) {
+	ctx, done := s.observe(ctx, "GetDatesByRoomID")
+	defer done(&err)
+
+	query := `
+        SELECT d.Date, u.UserID, u.DisplayName
+        FROM Dates d
+        JOIN Users u ON u.UserID = d.UserID
+        LEFT JOIN JoinRequests j ON j.UserID = u.UserID
+        WHERE d.RoomID = ? AND u.RoomID = ? AND (j.Status IS NULL OR j.Status = ?)
+        ORDER BY d.Date;
+    `
+
+	rows, err := s.DB.QueryContext(ctx, query, roomID, roomID, models.JoinApproved)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get users for room %s: %w", roomID, err)
+		return nil, fmt.Errorf("failed to get dates: %w", err)
 	}
-	dateWithUsersList := []models.DateWithUsers{}
+	defer rows.Close()
 
-	for _, user := range users {
-		dates, err := s.GetDateByUserID(user.UserID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get dates for user %s: %w", user.UserID, err)
-		}
-		for _, date := range dates {
-			found := false
-			for i, dateWithUsers := range dateWithUsersList {
-				if dateWithUsers.Date == date.Date {
-					dateWithUsersList[i].Users = append(dateWithUsersList[i].Users, user)
-					found = true
-					break
-				}
-			}
-			if !found {
-				dateWithUsersList = append(dateWithUsersList, models.DateWithUsers{
-					Date:  date.Date,
-					Users: []models.User{user},
-				})
-			}
+	dateWithUsersList := []models.DateWithUsers{}
+	for rows.Next() {
+		var date string
+		user := models.User{RoomID: roomID}
+		if err := rows.Scan(&date, &user.UserID, &user.DisplayName); err != nil {
+			return nil, fmt.Errorf("failed to scan date: %w", err)
 		}
+		if n := len(dateWithUsersList); n > 0 && dateWithUsersList[n-1].Date == date {
+			dateWithUsersList[n-1].Users = append(dateWithUsersList[n-1].Users, user)
+			continue
+		}
+		dateWithUsersList = append(dateWithUsersList, models.DateWithUsers{
+			Date:  date,
+			Users: []models.User{user},
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get dates: %w", err)
 	}
 
 	return &models.RoomDatesResponse{
@@ -478,3 +838,107 @@ func (s *SQLStore) GetDatesByRoomID(roomID string) (*models.RoomDatesResponse, e
 		Dates:  dateWithUsersList,
 	}, nil
 }
+
+// DeleteUser removes a participant and everything they added to the room:
+// their votes, their option and the votes cast for it, their availability,
+// join request and account link. A host who leaves hands the room to the
+// earliest admitted participant still in it. With nobody left to take
+// over, the room has no host; see JoinRoom for who may claim it then.
+func (s *SQLStore) DeleteUser(ctx context.Context, roomID, userID string) (err error) {
+	ctx, done := s.observe(ctx, "DeleteUser")
+	defer done(&err)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`DELETE FROM Votes WHERE UserID = ? OR OptionID IN (SELECT OptionID FROM Options WHERE UserID = ?);`, []interface{}{userID, userID}},
+		{`DELETE FROM Options WHERE UserID = ?;`, []interface{}{userID}},
+		{`DELETE FROM Dates WHERE UserID = ?;`, []interface{}{userID}},
+		{`DELETE FROM JoinRequests WHERE UserID = ?;`, []interface{}{userID}},
+		{`DELETE FROM AccountMemberships WHERE UserID = ?;`, []interface{}{userID}},
+		{`
+            UPDATE RoomPolicies SET HostUserID = COALESCE((
+                SELECT u.UserID FROM Users u
+                LEFT JOIN JoinRequests j ON j.UserID = u.UserID
+                WHERE u.RoomID = ? AND u.UserID != ? AND (j.Status IS NULL OR j.Status = ?)
+                ORDER BY u.rowid LIMIT 1
+            ), '')
+            WHERE RoomID = ? AND HostUserID = ?;
+        `, []interface{}{roomID, userID, models.JoinApproved, roomID, userID}},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM Users WHERE UserID = ? AND RoomID = ?;`, userID, roomID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// DeleteRoom removes a room with its participants, options, votes,
+// availability and policy. Sessions are kept so their revocation can still
+// be seen by other instances.
+func (s *SQLStore) DeleteRoom(ctx context.Context, roomID string) (err error) {
+	ctx, done := s.observe(ctx, "DeleteRoom")
+	defer done(&err)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`DELETE FROM Votes WHERE OptionID IN (SELECT OptionID FROM Options WHERE RoomID = ?);`,
+		`DELETE FROM Options WHERE RoomID = ?;`,
+		`DELETE FROM Dates WHERE RoomID = ?;`,
+		`DELETE FROM JoinRequests WHERE RoomID = ?;`,
+		`DELETE FROM AccountMemberships WHERE RoomID = ?;`,
+		`DELETE FROM RoomPolicies WHERE RoomID = ?;`,
+		`DELETE FROM Users WHERE RoomID = ?;`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt, roomID); err != nil {
+			return fmt.Errorf("failed to delete room: %w", err)
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM Rooms WHERE RoomID = ?;`, roomID)
+	if err != nil {
+		return fmt.Errorf("failed to delete room: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete room: %w", err)
+	}
+	if rows == 0 {
+		return ErrRoomNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+	"websocket-chat/internal/store"
+	"websocket-chat/internal/store/storetest"
+)
+
+var benchRoomSizes = []int{10, 100, 1000}
+
+// seedRooms seeds one room per size and returns their IDs by size.
+func seedRooms(b *testing.B) (*store.SQLStore, map[int]string) {
+	b.Helper()
+	s := storetest.New(b)
+	rooms := make(map[int]string, len(benchRoomSizes))
+	for _, members := range benchRoomSizes {
+		room, _, err := storetest.SeedRoom(context.Background(), s, members, time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			b.Fatal(err)
+		}
+		rooms[members] = room.RoomID
+	}
+	return s, rooms
+}
+
+func BenchmarkGetFullRoomState(b *testing.B) {
+	s, rooms := seedRooms(b)
+	for _, members := range benchRoomSizes {
+		b.Run(fmt.Sprintf("members=%d", members), func(b *testing.B) {
+			ctx := context.Background()
+			b.ResetTimer()
+			for range b.N {
+				state, err := s.GetFullRoomState(ctx, rooms[members])
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(state.Users) != members || len(state.Votes) != members {
+					b.Fatalf("room state has %d users and %d votes, want %d of each", len(state.Users), len(state.Votes), members)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetDatesByRoomID(b *testing.B) {
+	s, rooms := seedRooms(b)
+	for _, members := range benchRoomSizes {
+		b.Run(fmt.Sprintf("members=%d", members), func(b *testing.B) {
+			ctx := context.Background()
+			b.ResetTimer()
+			for range b.N {
+				dates, err := s.GetDatesByRoomID(ctx, rooms[members])
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(dates.Dates) == 0 {
+					b.Fatal("room has no dates")
+				}
+			}
+		})
+	}
+}
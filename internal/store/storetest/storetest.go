@@ -0,0 +1,126 @@
+// Package storetest sets up stores on local SQLite files for tests,
+// benchmarks and tools such as roombench, and seeds rooms of a given size.
+// It never touches a configured database.
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"websocket-chat/internal/models"
+	"websocket-chat/internal/store"
+
+	"github.com/google/uuid"
+	_ "github.com/tursodatabase/libsql-client-go/libsql"
+	_ "modernc.org/sqlite"
+)
+
+// DatesPerMember is how many available dates SeedRoom gives each member.
+const DatesPerMember = 5
+
+const seedBatch = 100
+
+// The tables that predate Migrate, which only applies later changes.
+var baseSchema = []string{
+	`CREATE TABLE Rooms (RoomID TEXT PRIMARY KEY, Name TEXT NOT NULL);`,
+	`CREATE TABLE Users (UserID TEXT PRIMARY KEY, RoomID TEXT NOT NULL, DisplayName TEXT NOT NULL);`,
+	`CREATE TABLE Options (OptionID TEXT PRIMARY KEY, RoomID TEXT NOT NULL, UserID TEXT NOT NULL, Content TEXT NOT NULL);`,
+	`CREATE TABLE Votes (VoteID TEXT PRIMARY KEY, OptionID TEXT NOT NULL, UserID TEXT NOT NULL);`,
+	`CREATE TABLE Dates (DateID TEXT PRIMARY KEY, RoomID TEXT NOT NULL, UserID TEXT NOT NULL, Date TEXT NOT NULL);`,
+}
+
+// Open creates the schema in the SQLite file at path and returns a store on
+// it, opened through the libsql driver as the server does for file: URLs.
+// The file must be new or empty.
+func Open(ctx context.Context, path string) (*store.SQLStore, error) {
+	db, err := sql.Open("libsql", "file:"+path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	// SQLite allows one writer; a single connection keeps seeding simple.
+	db.SetMaxOpenConns(1)
+
+	for _, stmt := range baseSchema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create tables: %w", err)
+		}
+	}
+	s := store.NewSQLStore(db)
+	if err := s.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// New returns a store on a new file in the test's temporary directory.
+func New(tb testing.TB) *store.SQLStore {
+	tb.Helper()
+	s, err := Open(context.Background(), filepath.Join(tb.TempDir(), "test.db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { s.DB.Close() })
+	return s
+}
+
+// SeedRoom creates a room with members participants, each with an option,
+// a vote for the first participant's option and DatesPerMember available
+// dates from start on. Rows are inserted in batches so large rooms seed in
+// a few round trips. It returns the room and its participants' IDs in the
+// order they were created.
+func SeedRoom(ctx context.Context, s *store.SQLStore, members int, start time.Time) (*models.Room, []string, error) {
+	room, err := s.CreateRoom(ctx, fmt.Sprintf("seeded %d", members))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userIDs := make([]string, members)
+	optionIDs := make([]string, members)
+	for i := range userIDs {
+		userIDs[i] = uuid.NewString()
+		optionIDs[i] = uuid.NewString()
+	}
+
+	var users, options, votes, dates [][]interface{}
+	for i, userID := range userIDs {
+		users = append(users, []interface{}{userID, room.RoomID, fmt.Sprintf("User %d", i)})
+		options = append(options, []interface{}{optionIDs[i], room.RoomID, userID, fmt.Sprintf("Option %d", i)})
+		votes = append(votes, []interface{}{uuid.NewString(), optionIDs[0], userID})
+		for d := range DatesPerMember {
+			date := start.AddDate(0, 0, (i+d)%30).Format("2006-01-02")
+			dates = append(dates, []interface{}{uuid.NewString(), room.RoomID, userID, date})
+		}
+	}
+
+	tables := []struct {
+		insert string
+		rows   [][]interface{}
+	}{
+		{"INSERT INTO Users (UserID, RoomID, DisplayName) VALUES ", users},
+		{"INSERT INTO Options (OptionID, RoomID, UserID, Content) VALUES ", options},
+		{"INSERT INTO Votes (VoteID, OptionID, UserID) VALUES ", votes},
+		{"INSERT INTO Dates (DateID, RoomID, UserID, Date) VALUES ", dates},
+	}
+	for _, table := range tables {
+		for batch := range slices.Chunk(table.rows, seedBatch) {
+			row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(batch[0])), ", ") + ")"
+			values := make([]string, len(batch))
+			var args []interface{}
+			for i, r := range batch {
+				values[i] = row
+				args = append(args, r...)
+			}
+			if _, err := s.DB.ExecContext(ctx, table.insert+strings.Join(values, ", ")+";", args...); err != nil {
+				return nil, nil, fmt.Errorf("failed to seed %d participants: %w", members, err)
+			}
+		}
+	}
+	return room, userIDs, nil
+}
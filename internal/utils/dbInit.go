@@ -1,38 +1,37 @@
 package utils
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"os"
-	"time"
+	"websocket-chat/internal/config"
 	"websocket-chat/internal/store"
-
-	"github.com/joho/godotenv"
 )
 
-func InitialiseDb() (*store.SQLStore, error) {
-	err := godotenv.Load()
-	if err != nil {
-		fmt.Println("Error loading .env file")
-	}
-	url := os.Getenv("TURSO_DATABASE_URL")
-	authToken := os.Getenv("TURSO_AUTH_TOKEN")
-
-	fullURL := fmt.Sprintf("%s?authToken=%s", url, authToken)
+func InitialiseDb(cfg config.DatabaseConfig) (*store.SQLStore, error) {
+	fullURL := fmt.Sprintf("%s?authToken=%s", cfg.URL, cfg.AuthToken)
 	db, err := sql.Open("libsql", fullURL)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to open db %s: %w", url, err)
+		return nil, fmt.Errorf("failed to open db %s: %w", cfg.URL, err)
 	}
 
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(time.Hour)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
-	if err := db.Ping(); err != nil {
+	ctx := context.Background()
+	if err := db.PingContext(ctx); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to connect to the database: %w", err)
 	}
 
-	return store.NewSQLStore(db), nil
+	sqlStore := store.NewSQLStore(db)
+	sqlStore.SetQueryTimeouts(cfg.QueryTimeout, cfg.QueryTimeouts)
+	if err := sqlStore.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return sqlStore, nil
 }
@@ -1,29 +1,161 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
+	"sync/atomic"
 	"time"
+	"websocket-chat/internal/config"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
-var JwtKey = []byte("randomtest")
+var (
+	ErrSessionRevoked = errors.New("session has been revoked")
+	ErrNoSession      = errors.New("token is not bound to a session")
+)
+
+var (
+	jwtIssuer       = "WhenRU3"
+	tokenTTL        = time.Minute * 15
+	refreshTokenTTL = time.Hour * 360
+	keysFile        string
+	currentKeys     atomic.Pointer[KeySet]
+)
+
+func init() {
+	currentKeys.Store(secretKeySet("randomtest"))
+}
 
 type Claims struct {
-	UserID string `json:"user_id"`
-	RoomID string `json:"room_id"`
+	UserID    string `json:"user_id"`
+	RoomID    string `json:"room_id"`
+	SessionID string `json:"sid"`
+	AccountID string `json:"account_id,omitempty"`
+	Pending   bool   `json:"pending,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID string, roomID string) (string, error) {
-	now := time.Now()
-	claims := &Claims{
-		UserID: userID,
-		RoomID: roomID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    "WhenRU3",
-			ExpiresAt: &jwt.NumericDate{Time: now.Add(time.Hour * 360)},
-		},
+// ConfigureJWT installs the signing keys: the key file when one is
+// configured, otherwise the shared HMAC secret.
+func ConfigureJWT(cfg config.JWTConfig) error {
+	jwtIssuer = cfg.Issuer
+	tokenTTL = cfg.TokenTTL
+	refreshTokenTTL = cfg.RefreshTokenTTL
+	keysFile = cfg.KeysFile
+
+	if keysFile == "" {
+		currentKeys.Store(secretKeySet(cfg.Secret))
+		return nil
+	}
+	return ReloadKeys()
+}
+
+// ReloadKeys re-reads the key file so a rotation takes effect without a restart.
+func ReloadKeys() error {
+	if keysFile == "" {
+		return nil
+	}
+	ks, err := LoadKeySet(keysFile)
+	if err != nil {
+		return err
+	}
+	currentKeys.Store(ks)
+	return nil
+}
+
+func CurrentJWKS() JSONWebKeySet {
+	return currentKeys.Load().JWKS()
+}
+
+func TokenTTL() time.Duration {
+	return tokenTTL
+}
+
+func RefreshTokenTTL() time.Duration {
+	return refreshTokenTTL
+}
+
+func GenerateJWT(userID string, roomID string, sessionID string) (string, error) {
+	return signClaims(&Claims{
+		UserID:    userID,
+		RoomID:    roomID,
+		SessionID: sessionID,
+	})
+}
+
+// GeneratePendingJWT issues a room token for a user waiting in the lobby for
+// the host's approval. It is refused everywhere except the WebSocket lobby.
+func GeneratePendingJWT(userID string, roomID string, sessionID string) (string, error) {
+	return signClaims(&Claims{
+		UserID:    userID,
+		RoomID:    roomID,
+		SessionID: sessionID,
+		Pending:   true,
+	})
+}
+
+// GenerateAccountJWT issues a token for an account rather than a room
+// identity. It grants access to account routes only.
+func GenerateAccountJWT(accountID string, sessionID string) (string, error) {
+	return signClaims(&Claims{
+		AccountID: accountID,
+		SessionID: sessionID,
+	})
+}
+
+func signClaims(claims *Claims) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    jwtIssuer,
+		ExpiresAt: &jwt.NumericDate{Time: time.Now().Add(tokenTTL)},
+	}
+	return SignToken(claims)
+}
+
+// SignToken signs arbitrary claims with the active key. Tokens that are not
+// access tokens must set an audience naming their purpose so they cannot be
+// mistaken for one another.
+func SignToken(claims jwt.Claims) (string, error) {
+	key := currentKeys.Load().Active()
+	if key == nil {
+		return "", errors.New("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(signingMethods[key.Algorithm], claims)
+	token.Header["kid"] = key.KeyID
+	return token.SignedString(key.signKey)
+}
+
+// ParseToken verifies a token against the key named by its kid header and
+// only accepts the algorithm that key was created for.
+func ParseToken(tokenString string, claims jwt.Claims) error {
+	ks := currentKeys.Load()
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := ks.verificationKey(kid, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing algorithm %s for key %s", token.Method.Alg(), key.KeyID)
+		}
+		return key.verifyKey, nil
+	}, jwt.WithValidMethods([]string{AlgHS256, AlgRS256, AlgEdDSA}))
+	return err
+}
+
+// ParseJWT verifies an access token and rejects revoked sessions.
+func ParseJWT(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	if err := ParseToken(tokenString, claims); err != nil {
+		return nil, err
+	}
+	if claims.SessionID == "" {
+		return nil, ErrNoSession
+	}
+	if Revoked.Contains(claims.SessionID) {
+		return nil, ErrSessionRevoked
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(JwtKey)
+	return claims, nil
 }
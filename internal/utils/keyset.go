@@ -0,0 +1,323 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	hmacKeySize = 32
+	rsaKeyBits  = 2048
+)
+
+var signingMethods = map[string]jwt.SigningMethod{
+	AlgHS256: jwt.SigningMethodHS256,
+	AlgRS256: jwt.SigningMethodRS256,
+	AlgEdDSA: jwt.SigningMethodEdDSA,
+}
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type SigningKey struct {
+	KeyID      string     `json:"kid"`
+	Algorithm  string     `json:"alg"`
+	Secret     []byte     `json:"secret,omitempty"`
+	PrivateKey string     `json:"privateKey,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	RetireAt   *time.Time `json:"retireAt,omitempty"`
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet holds the key used to sign new tokens plus any retiring keys that
+// are still accepted so tokens issued before a rotation keep working.
+type KeySet struct {
+	ActiveKeyID string        `json:"activeKid"`
+	Keys        []*SigningKey `json:"keys"`
+
+	// legacyKeyID verifies tokens issued before tokens carried a kid header.
+	legacyKeyID string
+}
+
+func GenerateSigningKey(alg string) (*SigningKey, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	key := &SigningKey{
+		KeyID:     hex.EncodeToString(id),
+		Algorithm: alg,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	var private interface{}
+	switch alg {
+	case AlgHS256:
+		key.Secret = make([]byte, hmacKeySize)
+		if _, err := rand.Read(key.Secret); err != nil {
+			return nil, err
+		}
+	case AlgEdDSA:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		private = priv
+	case AlgRS256:
+		priv, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		private = priv
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	if private != nil {
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		if err != nil {
+			return nil, err
+		}
+		key.PrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	}
+
+	if err := key.parse(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (k *SigningKey) parse() error {
+	if _, ok := signingMethods[k.Algorithm]; !ok {
+		return fmt.Errorf("key %s: unsupported algorithm %q", k.KeyID, k.Algorithm)
+	}
+
+	if k.Algorithm == AlgHS256 {
+		if len(k.Secret) < hmacKeySize {
+			return fmt.Errorf("key %s: HMAC secret must be at least %d bytes", k.KeyID, hmacKeySize)
+		}
+		k.signKey, k.verifyKey = k.Secret, k.Secret
+		return nil
+	}
+
+	block, _ := pem.Decode([]byte(k.PrivateKey))
+	if block == nil {
+		return fmt.Errorf("key %s: private key is not PEM encoded", k.KeyID)
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("key %s: %w", k.KeyID, err)
+	}
+
+	switch priv := private.(type) {
+	case ed25519.PrivateKey:
+		if k.Algorithm != AlgEdDSA {
+			return fmt.Errorf("key %s: Ed25519 key cannot be used with %s", k.KeyID, k.Algorithm)
+		}
+		k.signKey, k.verifyKey = priv, priv.Public()
+	case *rsa.PrivateKey:
+		if k.Algorithm != AlgRS256 {
+			return fmt.Errorf("key %s: RSA key cannot be used with %s", k.KeyID, k.Algorithm)
+		}
+		k.signKey, k.verifyKey = priv, &priv.PublicKey
+	default:
+		return fmt.Errorf("key %s: unsupported private key type %T", k.KeyID, private)
+	}
+	return nil
+}
+
+func (k *SigningKey) retired(now time.Time) bool {
+	return k.RetireAt != nil && now.After(*k.RetireAt)
+}
+
+// NewKeySet returns a key set with a single freshly generated active key.
+func NewKeySet(alg string) (*KeySet, error) {
+	key, err := GenerateSigningKey(alg)
+	if err != nil {
+		return nil, err
+	}
+	return &KeySet{ActiveKeyID: key.KeyID, Keys: []*SigningKey{key}}, nil
+}
+
+// secretKeySet wraps a plain HMAC secret for deployments without a key file.
+func secretKeySet(secret string) *KeySet {
+	key := &SigningKey{
+		KeyID:     "default",
+		Algorithm: AlgHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+	return &KeySet{ActiveKeyID: key.KeyID, Keys: []*SigningKey{key}, legacyKeyID: key.KeyID}
+}
+
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key set %s: %w", path, err)
+	}
+
+	ks := &KeySet{}
+	if err := json.Unmarshal(data, ks); err != nil {
+		return nil, fmt.Errorf("failed to parse key set %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool, len(ks.Keys))
+	for _, key := range ks.Keys {
+		if seen[key.KeyID] {
+			return nil, fmt.Errorf("key set %s: duplicate kid %q", path, key.KeyID)
+		}
+		seen[key.KeyID] = true
+		if err := key.parse(); err != nil {
+			return nil, fmt.Errorf("key set %s: %w", path, err)
+		}
+	}
+
+	active, ok := ks.Lookup(ks.ActiveKeyID)
+	if !ok {
+		return nil, fmt.Errorf("key set %s: active kid %q not found", path, ks.ActiveKeyID)
+	}
+	if active.retired(time.Now()) {
+		return nil, fmt.Errorf("key set %s: active key %q is retired", path, ks.ActiveKeyID)
+	}
+	return ks, nil
+}
+
+func (ks *KeySet) Save(path string) error {
+	data, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keys-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (ks *KeySet) Lookup(kid string) (*SigningKey, bool) {
+	for _, key := range ks.Keys {
+		if key.KeyID == kid {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+func (ks *KeySet) Active() *SigningKey {
+	key, _ := ks.Lookup(ks.ActiveKeyID)
+	return key
+}
+
+// Rotate makes a new key active. The previous active key stays valid for
+// verification for the overlap period and already retired keys are pruned.
+func (ks *KeySet) Rotate(alg string, overlap time.Duration) (*SigningKey, error) {
+	key, err := GenerateSigningKey(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if previous := ks.Active(); previous != nil && previous.RetireAt == nil {
+		retireAt := now.Add(overlap)
+		previous.RetireAt = &retireAt
+	}
+
+	kept := []*SigningKey{key}
+	for _, k := range ks.Keys {
+		if !k.retired(now) {
+			kept = append(kept, k)
+		}
+	}
+	ks.Keys = kept
+	ks.ActiveKeyID = key.KeyID
+	return key, nil
+}
+
+func (ks *KeySet) verificationKey(kid string, now time.Time) (*SigningKey, error) {
+	if kid == "" {
+		kid = ks.legacyKeyID
+	}
+	key, ok := ks.Lookup(kid)
+	if !ok || kid == "" {
+		return nil, ErrUnknownKey
+	}
+	if key.retired(now) {
+		return nil, fmt.Errorf("signing key %s has been retired", kid)
+	}
+	return key, nil
+}
+
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS publishes the public half of every asymmetric key that is still
+// accepted. HMAC keys are never published.
+func (ks *KeySet) JWKS() JSONWebKeySet {
+	now := time.Now()
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range ks.Keys {
+		if key.retired(now) {
+			continue
+		}
+		jwk := JSONWebKey{KeyID: key.KeyID, Algorithm: key.Algorithm, Use: "sig"}
+		switch pub := key.verifyKey.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
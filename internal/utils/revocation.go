@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// RevocationList remembers revoked sessions for as long as an access token
+// issued to them could still be presented.
+type RevocationList struct {
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+var Revoked = NewRevocationList()
+
+func NewRevocationList() *RevocationList {
+	return &RevocationList{revoked: make(map[string]time.Time)}
+}
+
+func (l *RevocationList) Add(sessionID string, revokedAt time.Time) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for id, until := range l.revoked {
+		if now.After(until) {
+			delete(l.revoked, id)
+		}
+	}
+	l.revoked[sessionID] = revokedAt.Add(tokenTTL)
+}
+
+func (l *RevocationList) Contains(sessionID string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.revoked[sessionID]
+	return ok
+}
+
+// GenerateOpaqueToken returns a random bearer token and the hash that is
+// stored in its place, as used for refresh tokens and magic links.
+func GenerateOpaqueToken() (token string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashOpaqueToken(token), nil
+}
+
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,162 @@
+// Package validate cleans and bounds user-supplied input. REST handlers
+// and WebSocket messages run names, options and dates through the same
+// Checker, so both reject the same input with the same field errors.
+package validate
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/config"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// DateLayout is the only accepted availability date format.
+const DateLayout = "2006-01-02"
+
+// maxSecretBytes is bcrypt's input limit; longer passwords fail to hash.
+const maxSecretBytes = 72
+
+var (
+	limits    = config.Default().Input
+	profanity *regexp.Regexp
+	htmlTag   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// Configure applies the input limits and filters. It must be called before
+// serving requests.
+func Configure(cfg config.InputConfig) {
+	limits = cfg
+	profanity = nil
+	if cfg.Profanity != "off" && len(cfg.ProfanityWords) > 0 {
+		words := make([]string, len(cfg.ProfanityWords))
+		for i, word := range cfg.ProfanityWords {
+			words[i] = regexp.QuoteMeta(word)
+		}
+		profanity = regexp.MustCompile(`(?i)\b(` + strings.Join(words, "|") + `)\b`)
+	}
+}
+
+// Checker cleans fields one at a time and collects what is wrong with them.
+// Its zero value is ready to use.
+type Checker struct {
+	errs []apierr.FieldError
+}
+
+func (c *Checker) fail(field, format string, args ...interface{}) {
+	c.errs = append(c.errs, apierr.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns a validation_failed error listing every invalid field, or nil.
+func (c *Checker) Err() error {
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return apierr.Invalid(c.errs...)
+}
+
+// Required checks an identifier or token that is used as is.
+func (c *Checker) Required(field, value string) {
+	if value == "" {
+		c.fail(field, "is required")
+	}
+}
+
+func (c *Checker) RoomName(field, value string) string {
+	return c.text(field, value, limits.MaxRoomName, true)
+}
+
+func (c *Checker) DisplayName(field, value string) string {
+	return c.text(field, value, limits.MaxDisplayName, true)
+}
+
+// Option cleans an option's content. Options are optional when joining but
+// required when set over the WebSocket.
+func (c *Checker) Option(field, value string, required bool) string {
+	return c.text(field, value, limits.MaxOption, required)
+}
+
+// Secret checks a password or passcode, which is hashed rather than shown
+// and so is never rewritten.
+func (c *Checker) Secret(field, value string, minLength int) {
+	switch {
+	case utf8.RuneCountInString(value) < minLength:
+		c.fail(field, "must be at least %d characters", minLength)
+	case len(value) > maxSecretBytes:
+		c.fail(field, "must be at most %d bytes", maxSecretBytes)
+	}
+}
+
+// Dates checks each date's format and returns them sorted without
+// duplicates.
+func (c *Checker) Dates(field string, dates []string) []string {
+	if dates == nil {
+		c.fail(field, "is required")
+		return nil
+	}
+	if len(dates) > limits.MaxDates {
+		c.fail(field, "must have at most %d dates", limits.MaxDates)
+		return nil
+	}
+
+	cleaned := make([]string, 0, len(dates))
+	for i, date := range dates {
+		date = strings.TrimSpace(date)
+		if _, err := time.Parse(DateLayout, date); err != nil {
+			c.fail(fmt.Sprintf("%s[%d]", field, i), "must be a date in YYYY-MM-DD format")
+			continue
+		}
+		cleaned = append(cleaned, date)
+	}
+	slices.Sort(cleaned)
+	return slices.Compact(cleaned)
+}
+
+// text normalises to NFC, strips HTML tags when configured, drops control
+// and invisible formatting characters, collapses whitespace and applies the
+// profanity filter before checking the length.
+func (c *Checker) text(field, value string, max int, required bool) string {
+	if !utf8.ValidString(value) {
+		c.fail(field, "must be valid UTF-8")
+		return ""
+	}
+
+	value = norm.NFC.String(value)
+	if limits.StripHTML {
+		value = htmlTag.ReplaceAllString(value, "")
+	}
+	value = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r):
+			return -1
+		}
+		return r
+	}, value)
+	value = strings.Join(strings.Fields(value), " ")
+
+	if profanity != nil && profanity.MatchString(value) {
+		if limits.Profanity == "reject" {
+			c.fail(field, "contains words that are not allowed")
+			return ""
+		}
+		value = profanity.ReplaceAllStringFunc(value, func(word string) string {
+			return strings.Repeat("*", utf8.RuneCountInString(word))
+		})
+	}
+
+	switch n := utf8.RuneCountInString(value); {
+	case n == 0 && required:
+		c.fail(field, "is required")
+	case n > max:
+		c.fail(field, "must be at most %d characters", max)
+	}
+	return value
+}
@@ -1,146 +1,272 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/authz"
+	"websocket-chat/internal/config"
+	"websocket-chat/internal/logging"
+	"websocket-chat/internal/metrics"
 	"websocket-chat/internal/models"
+	"websocket-chat/internal/ratelimit"
+	"websocket-chat/internal/service"
+	"websocket-chat/internal/tracing"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	sendBufferSize = 16
+	writeWait      = 10 * time.Second
+	maxMessageSize = 8192
 )
 
 type Client struct {
-	Conn   *websocket.Conn
-	Send   chan interface{}
-	RoomID string
-	User   *models.User
+	ID        string
+	Conn      *websocket.Conn
+	Send      chan interface{}
+	RoomID    string
+	SessionID string
+	User      *models.User
+
+	log         *slog.Logger
+	ctx         context.Context
+	cancel      context.CancelFunc
+	closeCode   int
+	closeReason string
+	pending     atomic.Bool
 }
 
-type ErrorMessage struct {
-	Type    string `json:"type"`
-	Message string `json:"message"`
+// NewClient gives the connection an ID and derives its logger from the
+// upgrade request's context, so every line it logs and every message span
+// can be traced back to that request. The client's own context outlives the
+// request and is cancelled when the connection closes, aborting the queries
+// of any message still being handled.
+func NewClient(ctx context.Context, conn *websocket.Conn, roomID, sessionID string, user *models.User, pending bool) *Client {
+	id := uuid.NewString()
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	client := &Client{
+		ID:        id,
+		Conn:      conn,
+		Send:      make(chan interface{}, sendBufferSize),
+		RoomID:    roomID,
+		SessionID: sessionID,
+		User:      user,
+		log:       logging.FromContext(ctx).With("conn_id", id, "room_id", roomID, "user_id", user.UserID),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	client.pending.Store(pending)
+	return client
 }
 
-func sendError(c *Client, message string) {
-	errorMsg := ErrorMessage{
-		Type:    "error",
-		Message: message,
+// Pending reports whether the client is waiting in the lobby for the host
+// to approve it. Lobby clients receive no room updates and cannot act.
+func (c *Client) Pending() bool {
+	return c.pending.Load()
+}
+
+// reply acknowledges a handled message or reports why it was rejected,
+// echoing its request ID so the client can match the two. Messages without
+// an ID are only answered when they fail. Failures the client cannot act on
+// are logged and mark the message's span as failed, and are reported
+// without the underlying error.
+func (c *Client) reply(ctx context.Context, hub *Hub, msg BaseMessage, err error) {
+	if err == nil {
+		if msg.RequestID != "" {
+			hub.reply(c, AckMessage{Type: "ack", RequestID: msg.RequestID, For: msg.Type})
+		}
+		return
+	}
+
+	e := apierr.Wrap(err, "Internal error")
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("ws.error_code", string(e.Code)))
+	if e.Status() >= http.StatusInternalServerError {
+		c.log.Error(e.Message, "err", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, e.Message)
 	}
-	c.Send <- errorMsg
+	hub.reply(c, ErrorMessage{
+		Type:      "error",
+		Code:      string(e.Code),
+		Message:   e.Message,
+		Details:   e.Details,
+		RequestID: msg.RequestID,
+	})
 }
 
 func (c *Client) ReadPump(hub *Hub) {
 	defer func() {
+		c.cancel()
 		hub.UnregisterClient(c)
 		c.Conn.Close()
+		c.log.Info("WebSocket disconnected")
 	}()
+	c.log.Info("WebSocket connected", "pending", c.Pending())
+	c.Conn.SetReadLimit(maxMessageSize)
 	for {
 		_, messageData, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+				c.log.Warn("WebSocket read failed", "err", err)
 			}
 			break
 		}
 
-		var baseMsg BaseMessage
-		err = json.Unmarshal(messageData, &baseMsg)
-		if err != nil {
-			log.Printf("Invalid message format: %v", err)
+		// Every frame is charged before any work is done on it, so invalid
+		// and unknown messages cannot be sent without limit either.
+		var msg BaseMessage
+		if err := json.Unmarshal(messageData, &msg); err != nil {
+			c.log.Warn("Invalid message format", "err", err)
+			if err := c.limit(c.ctx, hub, inboundType("")); err != nil {
+				c.reply(c.ctx, hub, msg, err)
+				continue
+			}
+			c.reply(c.ctx, hub, msg, apierr.New(apierr.InvalidMessage, "Message must be a JSON object with a string type"))
 			continue
 		}
+		metrics.WSMessagesReceived.WithLabelValues(inboundType(msg.Type)).Inc()
 
-		switch baseMsg.Type {
-		case "add_option":
-			var addOptionMsg AddOptionMessage
-			err = json.Unmarshal(messageData, &addOptionMsg)
-			if err != nil {
-				log.Printf("Invalid add_option message: %v", err)
-				continue
-			}
-			c.handleAddOption(hub, addOptionMsg)
-		case "vote":
-			var voteMsg VoteMessage
-			err = json.Unmarshal(messageData, &voteMsg)
-			if err != nil {
-				log.Printf("Invalid vote message: %v", err)
-				continue
-			}
-			c.handleVote(hub, voteMsg)
-		case "revealVotes":
-			c.handleRevealVotes(hub)
-		default:
-			log.Printf("Unknown message type: %s", baseMsg.Type)
+		ctx, span := c.startSpan(msg)
+		err = c.limit(ctx, hub, inboundType(msg.Type))
+		if err == nil {
+			err = c.handleMessage(ctx, hub, msg, messageData)
 		}
+		c.reply(ctx, hub, msg, err)
+		span.End()
 	}
 }
 
-func (c *Client) WritePump() {
-	defer c.Conn.Close()
-	for message := range c.Send {
-		err := c.Conn.WriteJSON(message)
-		if err != nil {
-			break
-		}
-	}
+// startSpan starts a new trace for an inbound message, linked to the
+// upgrade request rather than parented by it, since a connection can stay
+// open for hours.
+func (c *Client) startSpan(msg BaseMessage) (context.Context, trace.Span) {
+	return tracing.Start(c.ctx, "ws."+inboundType(msg.Type),
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithLinks(trace.LinkFromContext(c.ctx)),
+		trace.WithAttributes(
+			attribute.String("ws.conn_id", c.ID),
+			attribute.String("room.id", c.RoomID),
+			attribute.String("user.id", c.User.UserID),
+			attribute.String("ws.request_id", msg.RequestID),
+		),
+	)
 }
 
-func (c *Client) handleAddOption(hub *Hub, msg AddOptionMessage) {
-	if msg.Content == "" {
-		sendError(c, "Option cannot be empty")
-		return
+// handleMessage validates a message against its schema before decoding it,
+// so handlers only see well-formed messages.
+func (c *Client) handleMessage(ctx context.Context, hub *Hub, msg BaseMessage, messageData []byte) error {
+	if msg.Version != 0 && msg.Version != ProtocolVersion {
+		return apierr.Errorf(apierr.UnsupportedVersion, "Unsupported protocol version %d, expected %d", msg.Version, ProtocolVersion)
 	}
-
-	err := hub.SqlStore.ChangeOption(c.User.UserID, c.RoomID, msg.Content)
-	if err != nil {
-		sendError(c, "Failed to create option")
-		return
+	if msg.Type == "auth" {
+		return apierr.New(apierr.UnknownType, "Connection is already authenticated")
+	}
+	if err := ValidateMessage(msg.Type, messageData); err != nil {
+		return err
 	}
 
-	fullRoomStateMsg, err := hub.SqlStore.GetFullRoomState(c.RoomID)
-	if err != nil {
-		sendError(c, "Failed to get room state")
-		return
+	if c.Pending() {
+		return authz.ErrPendingApproval
 	}
 
-	hub.Broadcast <- BroadcastMessage{
-		RoomID:  c.RoomID,
-		Message: *fullRoomStateMsg,
+	switch msg.Type {
+	case "add_option":
+		var addOptionMsg AddOptionMessage
+		if err := json.Unmarshal(messageData, &addOptionMsg); err != nil {
+			return apierr.New(apierr.InvalidMessage, err.Error())
+		}
+		_, err := hub.services.Voting.AddOption(ctx, c.actor(), c.RoomID, addOptionMsg.Content)
+		return err
+	case "vote":
+		var voteMsg VoteMessage
+		if err := json.Unmarshal(messageData, &voteMsg); err != nil {
+			return apierr.New(apierr.InvalidMessage, err.Error())
+		}
+		return hub.services.Voting.Vote(ctx, c.actor(), c.RoomID, voteMsg.OptionID)
+	case "revealVotes":
+		return hub.services.Voting.Reveal(ctx, c.actor(), c.RoomID)
+	case "approve_join", "deny_join":
+		var decisionMsg JoinDecisionMessage
+		if err := json.Unmarshal(messageData, &decisionMsg); err != nil {
+			return apierr.New(apierr.InvalidMessage, err.Error())
+		}
+		return hub.services.Rooms.DecideJoin(ctx, c.actor(), c.RoomID, decisionMsg.UserID, msg.Type == "approve_join")
+	default:
+		return apierr.Errorf(apierr.UnknownType, "Unknown message type %q", msg.Type)
 	}
 }
 
-func (c *Client) handleVote(hub *Hub, msg VoteMessage) {
-	if msg.OptionID == "" {
-		sendError(c, "Option cannot be empty")
-		return
+// limit charges a message against the sender's and the room's quotas.
+// msgType must come from inboundType, so unknown types share one bucket
+// instead of each opening a new one.
+func (c *Client) limit(ctx context.Context, hub *Hub, msgType string) error {
+	if ok, wait := c.allow(ctx, hub, msgType); !ok {
+		c.log.Debug("Message rate limited", "type", msgType)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("rate_limited", true))
+		return apierr.Errorf(apierr.RateLimited, "Rate limit exceeded, retry in %ds", ratelimit.RetryAfterSeconds(wait))
 	}
+	return nil
+}
 
-	err := hub.SqlStore.ChangeVote(c.User.UserID, msg.OptionID)
-	if err != nil {
-		sendError(c, "Failed to create vote")
-		return
+// allow checks the sender's quota for the message type and the room's quota
+// for all messages. Limiter errors let the message through.
+func (c *Client) allow(ctx context.Context, hub *Hub, msgType string) (bool, time.Duration) {
+	rate, ok := hub.limits.WSMessages[msgType]
+	if !ok {
+		rate = hub.limits.WSMessages["*"]
 	}
 
-	fullRoomStateMsg, err := hub.SqlStore.GetFullRoomState(c.RoomID)
-	if err != nil {
-		sendError(c, "Failed to get room state")
-		return
+	checks := []struct {
+		key  string
+		rate config.Rate
+	}{
+		{"ws:" + msgType + ":" + c.User.UserID, rate},
+		{"ws-room:" + c.RoomID, hub.limits.WSRoom},
 	}
-
-	hub.Broadcast <- BroadcastMessage{
-		RoomID:  c.RoomID,
-		Message: *fullRoomStateMsg,
+	for _, check := range checks {
+		allowed, wait, err := ratelimit.Allow(ctx, hub.limiter, check.key, check.rate)
+		if err != nil {
+			c.log.Error("Rate limiter failed, allowing message", "err", err)
+			continue
+		}
+		if !allowed {
+			return false, wait
+		}
 	}
-
+	return true, 0
 }
 
-func (c *Client) handleRevealVotes(hub *Hub) {
-	fullRoomStateMsg, err := hub.SqlStore.GetFullRoomState(c.RoomID)
-	if err != nil {
-		sendError(c, "Failed to get room state")
+func (c *Client) WritePump(hub *Hub) {
+	defer func() {
+		c.Conn.Close()
+		hub.writers.Done()
+	}()
+	for message := range c.Send {
+		err := c.Conn.WriteJSON(message)
+		if err != nil {
+			return
+		}
+		metrics.WSMessagesSent.WithLabelValues(outboundType(message)).Inc()
 	}
-	fullRoomStateMsg.RevealVotes = true
-	hub.Broadcast <- BroadcastMessage{
-		RoomID:  c.RoomID,
-		Message: fullRoomStateMsg,
+	if c.closeCode != 0 {
+		closeMsg := websocket.FormatCloseMessage(c.closeCode, c.closeReason)
+		c.Conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(writeWait))
 	}
 }
+
+// actor is the participant the connection acts for.
+func (c *Client) actor() service.Actor {
+	return service.Actor{UserID: c.User.UserID, RoomID: c.RoomID, Pending: c.Pending()}
+}
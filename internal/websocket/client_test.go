@@ -0,0 +1,48 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/config"
+	"websocket-chat/internal/models"
+	"websocket-chat/internal/ratelimit"
+)
+
+func TestLimitSharesBucketForUnknownTypes(t *testing.T) {
+	hub := NewHub()
+	hub.SetRateLimiter(ratelimit.NewMemoryLimiter(), config.RateLimitConfig{
+		WSMessages: map[string]config.Rate{
+			"*":    {Count: 1, Per: time.Hour},
+			"vote": {Count: 1, Per: time.Hour},
+		},
+	})
+	c := &Client{RoomID: "room", User: &models.User{UserID: "user"}, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	// Each step sends one message type; made-up types must not open a
+	// bucket of their own.
+	steps := []struct {
+		msgType string
+		limited bool
+	}{
+		{msgType: "made_up_1"},
+		{msgType: "made_up_2", limited: true},
+		{msgType: "", limited: true},
+		{msgType: "vote"},
+		{msgType: "vote", limited: true},
+	}
+	for i, step := range steps {
+		err := c.limit(context.Background(), hub, inboundType(step.msgType))
+		var e *apierr.Error
+		if limited := err != nil; limited != step.limited {
+			t.Fatalf("step %d (%q): limit error = %v, want limited %v", i, step.msgType, err, step.limited)
+		}
+		if err != nil && (!errors.As(err, &e) || e.Code != apierr.RateLimited) {
+			t.Errorf("step %d (%q): error = %v, want code %q", i, step.msgType, err, apierr.RateLimited)
+		}
+	}
+}
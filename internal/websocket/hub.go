@@ -1,10 +1,60 @@
 package websocket
 
-import "websocket-chat/internal/store"
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"websocket-chat/internal/config"
+	"websocket-chat/internal/metrics"
+	"websocket-chat/internal/models"
+	"websocket-chat/internal/ratelimit"
+	"websocket-chat/internal/service"
+	"websocket-chat/internal/tracing"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var ErrHubClosed = errors.New("hub is shutting down")
 
 type BroadcastMessage struct {
 	RoomID  string
 	Message interface{}
+
+	// parent is the publisher's span, so the fan-out joins its trace.
+	parent trace.SpanContext
+}
+
+// Admission is the host's decision on a user waiting in the lobby.
+type Admission struct {
+	RoomID   string
+	UserID   string
+	Approved bool
+}
+
+// RoomStats describes a room's live connections. Queued counts messages
+// waiting in the clients' send buffers.
+type RoomStats struct {
+	RoomID    string `json:"roomId"`
+	Clients   int    `json:"clients"`
+	Pending   int    `json:"pending"`
+	Queued    int    `json:"queued"`
+	MaxQueued int    `json:"maxQueued"`
+}
+
+// Reply is a message for one client, such as an ack or an error.
+type Reply struct {
+	Client  *Client
+	Message interface{}
+}
+
+type HubStats struct {
+	Clients      int         `json:"clients"`
+	SendCapacity int         `json:"sendCapacity"`
+	Rooms        []RoomStats `json:"rooms"`
 }
 
 type Hub struct {
@@ -12,48 +62,309 @@ type Hub struct {
 	Register   chan *Client
 	Unregister chan *Client
 	Broadcast  chan BroadcastMessage
-	SqlStore   *store.SQLStore
+	Revoke     chan string
+	Admissions chan Admission
+	Replies    chan Reply
+	Inspect    chan chan HubStats
+
+	roomClients map[string]int
+
+	limiter  ratelimit.Limiter
+	limits   config.RateLimitConfig
+	services *service.Services
+
+	quit     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	writers  sync.WaitGroup
 }
 
-func NewHub(sqlStore *store.SQLStore) *Hub {
+func NewHub() *Hub {
 	return &Hub{
-		Clients:    make(map[*Client]bool),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
-		Broadcast:  make(chan BroadcastMessage),
-		SqlStore:   sqlStore,
+		Clients:     make(map[*Client]bool),
+		roomClients: make(map[string]int),
+		Register:    make(chan *Client),
+		Unregister:  make(chan *Client),
+		Broadcast:   make(chan BroadcastMessage),
+		Revoke:      make(chan string),
+		Admissions:  make(chan Admission),
+		Replies:     make(chan Reply),
+		Inspect:     make(chan chan HubStats),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
 	}
 }
 
-func (h *Hub) RegisterClient(client *Client) {
-	h.Register <- client
+// SetRateLimiter throttles inbound client messages. It must be called before
+// any client connects.
+func (h *Hub) SetRateLimiter(limiter ratelimit.Limiter, limits config.RateLimitConfig) {
+	h.limiter = limiter
+	h.limits = limits
+}
+
+// SetServices gives clients the room actions they perform. It must be
+// called before any client connects.
+func (h *Hub) SetServices(services *service.Services) {
+	h.services = services
+}
+
+func (h *Hub) RegisterClient(client *Client) error {
+	select {
+	case h.Register <- client:
+		return nil
+	case <-h.quit:
+		return ErrHubClosed
+	}
 }
 
 func (h *Hub) UnregisterClient(client *Client) {
-	h.Unregister <- client
+	select {
+	case h.Unregister <- client:
+	case <-h.done:
+	}
+}
+
+// Publish queues a message for every client in the room. Messages published
+// after the hub has stopped are dropped.
+func (h *Hub) Publish(ctx context.Context, roomID string, message interface{}) {
+	msg := BroadcastMessage{RoomID: roomID, Message: message, parent: trace.SpanContextFromContext(ctx)}
+	select {
+	case h.Broadcast <- msg:
+	case <-h.done:
+	}
+}
+
+// RequestJoin tells the room that user is waiting in the lobby.
+func (h *Hub) RequestJoin(ctx context.Context, roomID string, user models.User) {
+	h.Publish(ctx, roomID, JoinRequestMessage{
+		Type:        "join_request",
+		UserID:      user.UserID,
+		DisplayName: user.DisplayName,
+	})
+}
+
+// AvailabilityChanged tells the room what a user's availability replacement
+// changed.
+func (h *Hub) AvailabilityChanged(ctx context.Context, roomID string, change models.AvailabilityChange) {
+	h.Publish(ctx, roomID, AvailabilityChangedMessage{
+		Type:    "availability_changed",
+		UserID:  change.UserID,
+		Added:   change.Added,
+		Removed: change.Removed,
+	})
+}
+
+// reply queues a message for a single client. Only the run loop writes to
+// a client's Send, since it is also the one that closes it; replies to a
+// client that has been removed are dropped.
+func (h *Hub) reply(client *Client, message interface{}) {
+	select {
+	case h.Replies <- Reply{Client: client, Message: message}:
+	case <-client.ctx.Done():
+	case <-h.done:
+	}
+}
+
+// CloseSession disconnects every client authenticated with the session.
+func (h *Hub) CloseSession(sessionID string) {
+	select {
+	case h.Revoke <- sessionID:
+	case <-h.done:
+	}
+}
+
+// Admit lets a lobby user's clients into the room, or disconnects them when
+// their request was denied.
+func (h *Hub) Admit(roomID, userID string, approved bool) {
+	select {
+	case h.Admissions <- Admission{RoomID: roomID, UserID: userID, Approved: approved}:
+	case <-h.done:
+	}
+}
+
+// Stats asks the run loop for a snapshot of its clients, so it also shows
+// whether the loop is responsive.
+func (h *Hub) Stats(ctx context.Context) (HubStats, error) {
+	reply := make(chan HubStats, 1)
+	select {
+	case h.Inspect <- reply:
+	case <-h.quit:
+		return HubStats{}, ErrHubClosed
+	case <-ctx.Done():
+		return HubStats{}, ctx.Err()
+	}
+	return <-reply, nil
 }
 
 func (h *Hub) Run() {
 	for {
 		select {
 		case client := <-h.Register:
-			h.Clients[client] = true
+			h.writers.Add(1)
+			h.add(client)
 		case client := <-h.Unregister:
 			if _, ok := h.Clients[client]; ok {
-				delete(h.Clients, client)
-				close(client.Send)
+				h.remove(client)
 			}
 		case broadcast := <-h.Broadcast:
+			h.broadcast(broadcast)
+		case sessionID := <-h.Revoke:
 			for client := range h.Clients {
-				if client.RoomID == broadcast.RoomID {
-					select {
-					case client.Send <- broadcast.Message:
-					default:
-						close(client.Send)
-						delete(h.Clients, client)
-					}
+				if client.SessionID == sessionID {
+					client.closeCode = websocket.ClosePolicyViolation
+					client.closeReason = "session revoked"
+					h.remove(client)
 				}
 			}
+		case admission := <-h.Admissions:
+			h.admit(admission)
+		case reply := <-h.Replies:
+			if h.Clients[reply.Client] {
+				h.send(reply.Client, reply.Message)
+			}
+		case reply := <-h.Inspect:
+			reply <- h.stats()
+		case <-h.quit:
+			h.drain()
+			for client := range h.Clients {
+				client.closeCode = websocket.CloseServiceRestart
+				client.closeReason = "server restarting, reconnect"
+				h.remove(client)
+			}
+			close(h.done)
+			return
 		}
 	}
 }
+
+func (h *Hub) add(client *Client) {
+	h.Clients[client] = true
+	h.roomClients[client.RoomID]++
+	metrics.WSConnections.WithLabelValues(client.RoomID).Inc()
+}
+
+// remove forgets a client, cancels any queries it has in flight and closes
+// its send channel, which ends its WritePump after the queued messages are
+// written.
+func (h *Hub) remove(client *Client) {
+	delete(h.Clients, client)
+	client.cancel()
+	close(client.Send)
+
+	h.roomClients[client.RoomID]--
+	if h.roomClients[client.RoomID] > 0 {
+		metrics.WSConnections.WithLabelValues(client.RoomID).Dec()
+		return
+	}
+	delete(h.roomClients, client.RoomID)
+	metrics.WSConnections.DeleteLabelValues(client.RoomID)
+}
+
+func (h *Hub) broadcast(broadcast BroadcastMessage) {
+	ctx := trace.ContextWithSpanContext(context.Background(), broadcast.parent)
+	_, span := tracing.Start(ctx, "hub.broadcast", trace.WithAttributes(
+		attribute.String("room.id", broadcast.RoomID),
+		attribute.String("ws.message_type", outboundType(broadcast.Message)),
+	))
+	defer span.End()
+
+	recipients := 0
+	for client := range h.Clients {
+		if client.RoomID == broadcast.RoomID && !client.Pending() {
+			h.send(client, broadcast.Message)
+			recipients++
+		}
+	}
+	span.SetAttributes(attribute.Int("ws.recipients", recipients))
+}
+
+// send queues a message without blocking the hub, dropping clients that
+// are too slow to keep up.
+func (h *Hub) send(client *Client, message interface{}) {
+	select {
+	case client.Send <- message:
+	default:
+		client.log.Warn("Dropping slow WebSocket client")
+		metrics.WSDroppedClients.Inc()
+		h.remove(client)
+	}
+}
+
+func (h *Hub) admit(admission Admission) {
+	for client := range h.Clients {
+		if client.RoomID != admission.RoomID || client.User.UserID != admission.UserID {
+			continue
+		}
+		if admission.Approved {
+			client.pending.Store(false)
+			h.send(client, JoinStatusMessage{Type: "join_approved"})
+			continue
+		}
+		// 4000 + HTTP status, as for connections refused at authentication.
+		client.closeCode = 4000 + http.StatusForbidden
+		client.closeReason = "join request denied"
+		h.remove(client)
+	}
+}
+
+func (h *Hub) stats() HubStats {
+	rooms := make(map[string]*RoomStats)
+	for client := range h.Clients {
+		room, ok := rooms[client.RoomID]
+		if !ok {
+			room = &RoomStats{RoomID: client.RoomID}
+			rooms[client.RoomID] = room
+		}
+		room.Clients++
+		if client.Pending() {
+			room.Pending++
+		}
+		queued := len(client.Send)
+		room.Queued += queued
+		room.MaxQueued = max(room.MaxQueued, queued)
+	}
+
+	stats := HubStats{Clients: len(h.Clients), SendCapacity: sendBufferSize, Rooms: make([]RoomStats, 0, len(rooms))}
+	for _, room := range rooms {
+		stats.Rooms = append(stats.Rooms, *room)
+	}
+	slices.SortFunc(stats.Rooms, func(a, b RoomStats) int { return b.Clients - a.Clients })
+	return stats
+}
+
+// drain delivers broadcasts that were already waiting when shutdown began.
+func (h *Hub) drain() {
+	for {
+		select {
+		case broadcast := <-h.Broadcast:
+			h.broadcast(broadcast)
+		default:
+			return
+		}
+	}
+}
+
+// Shutdown stops the hub, sends every client a close frame asking it to
+// reconnect and waits for their pending messages to be written.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.stopOnce.Do(func() { close(h.quit) })
+
+	select {
+	case <-h.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		h.writers.Wait()
+		close(flushed)
+	}()
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,31 @@
+package websocket
+
+import "websocket-chat/internal/store"
+
+// inboundType is the metrics label for a client message type. Unknown types
+// share one label so clients cannot create unbounded series.
+func inboundType(msgType string) string {
+	if _, ok := messageSchemas[msgType]; ok {
+		return msgType
+	}
+	return "unknown"
+}
+
+func outboundType(message interface{}) string {
+	switch m := message.(type) {
+	case ErrorMessage:
+		return m.Type
+	case AckMessage:
+		return m.Type
+	case JoinStatusMessage:
+		return m.Type
+	case JoinRequestMessage:
+		return m.Type
+	case AvailabilityChangedMessage:
+		return m.Type
+	case store.FullRoomStateMessage, *store.FullRoomStateMessage:
+		return "room_state"
+	default:
+		return "other"
+	}
+}
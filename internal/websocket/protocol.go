@@ -0,0 +1,163 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"websocket-chat/internal/apierr"
+	"websocket-chat/internal/store"
+)
+
+//go:generate go run ../../cmd/wsprotocol -o asyncapi.json
+
+// ProtocolVersion is bumped whenever a message changes incompatibly. Clients
+// may send it as "v"; messages for any other version are rejected.
+const ProtocolVersion = 1
+
+type messageSpec struct {
+	Type    string
+	Summary string
+	Payload interface{}
+}
+
+// clientMessages are the messages a client may send. Their schemas reject
+// unknown fields.
+var clientMessages = []messageSpec{
+	{"auth", "First frame of a connection opened without a token, carrying the access token.", AuthMessage{}},
+	{"add_option", "Set the sender's option for the room.", AddOptionMessage{}},
+	{"vote", "Vote for an option in the room.", VoteMessage{}},
+	{"revealVotes", "Broadcast the room state with votes revealed.", BaseMessage{}},
+	{"approve_join", "Host only: let a user waiting in the lobby into the room.", JoinDecisionMessage{}},
+	{"deny_join", "Host only: refuse a user waiting in the lobby.", JoinDecisionMessage{}},
+}
+
+// serverMessages are the messages the server sends. Clients should ignore
+// fields they do not know.
+var serverMessages = []messageSpec{
+	{"authenticated", "Answer to a valid auth frame, with the server's protocol version.", AuthenticatedMessage{}},
+	{"room_state", "The full room state, broadcast after every change. It has no type field.", store.FullRoomStateMessage{}},
+	{"join_pending", "The connection is waiting in the lobby for the host.", JoinStatusMessage{}},
+	{"join_approved", "The host let the connection into the room.", JoinStatusMessage{}},
+	{"join_request", "Sent to the room when a user asks to join.", JoinRequestMessage{}},
+	{"availability_changed", "Sent to the room when a user changes their availability, with the dates added and removed.", AvailabilityChangedMessage{}},
+	{"ack", "Confirms a client message that carried an id was handled.", AckMessage{}},
+	{"error", "A client message was rejected.", ErrorMessage{}},
+}
+
+// messageSchemas validates client messages by type. It is built from the Go
+// types, so the decoder and the schema cannot drift apart.
+var messageSchemas = make(map[string]*Schema)
+
+func init() {
+	for _, spec := range clientMessages {
+		schema := spec.schema()
+		closed := false
+		schema.AdditionalProperties = &closed
+		messageSchemas[spec.Type] = schema
+	}
+}
+
+// schema derives the payload schema and pins its type field.
+func (m messageSpec) schema() *Schema {
+	schema := schemaOf(reflect.TypeOf(m.Payload))
+	if prop, ok := schema.Properties["type"]; ok {
+		prop.Const = m.Type
+	}
+	if m.Type == "error" {
+		schema.Properties["code"].Enum = apierr.Codes()
+	}
+	return schema
+}
+
+// ValidateMessage checks a client message against its type's schema.
+func ValidateMessage(msgType string, data []byte) error {
+	schema, ok := messageSchemas[msgType]
+	if !ok {
+		return apierr.Errorf(apierr.UnknownType, "Unknown message type %q", msgType)
+	}
+	err := schema.Validate(data)
+	var invalid *SchemaError
+	if !errors.As(err, &invalid) {
+		return err
+	}
+	e := apierr.New(apierr.InvalidMessage, invalid.Error())
+	if invalid.Field != "message" {
+		e.Details = []apierr.FieldError{{Field: invalid.Field, Message: invalid.Message}}
+	}
+	return e
+}
+
+// ProtocolDocument describes the WebSocket protocol in AsyncAPI form.
+// Publish lists what clients send and subscribe what they receive.
+type ProtocolDocument struct {
+	AsyncAPI   string                     `json:"asyncapi"`
+	Info       ProtocolInfo               `json:"info"`
+	Channels   map[string]ProtocolChannel `json:"channels"`
+	Components ProtocolComponents         `json:"components"`
+}
+
+type ProtocolInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+type ProtocolChannel struct {
+	Description string             `json:"description"`
+	Publish     *ProtocolOperation `json:"publish"`
+	Subscribe   *ProtocolOperation `json:"subscribe"`
+}
+
+type ProtocolOperation struct {
+	Message struct {
+		OneOf []ProtocolRef `json:"oneOf"`
+	} `json:"message"`
+}
+
+type ProtocolRef struct {
+	Ref string `json:"$ref"`
+}
+
+type ProtocolComponents struct {
+	Messages map[string]ProtocolMessage `json:"messages"`
+}
+
+type ProtocolMessage struct {
+	Name    string  `json:"name"`
+	Summary string  `json:"summary"`
+	Payload *Schema `json:"payload"`
+}
+
+// Protocol builds the protocol document from the message registry.
+func Protocol() ProtocolDocument {
+	doc := ProtocolDocument{
+		AsyncAPI: "2.6.0",
+		Info: ProtocolInfo{
+			Title:   "whenru3 WebSocket protocol",
+			Version: fmt.Sprint(ProtocolVersion),
+			Description: "Client messages may carry an id, echoed in the ack or error they produce, " +
+				"and v, the protocol version. Messages that fail validation are answered with an error " +
+				"and otherwise ignored.",
+		},
+		Channels:   make(map[string]ProtocolChannel),
+		Components: ProtocolComponents{Messages: make(map[string]ProtocolMessage)},
+	}
+
+	channel := ProtocolChannel{
+		Description: "A room's live connection, opened with GET /ws?roomID=...",
+		Publish:     &ProtocolOperation{},
+		Subscribe:   &ProtocolOperation{},
+	}
+	add := func(op *ProtocolOperation, key string, spec messageSpec, schema *Schema) {
+		op.Message.OneOf = append(op.Message.OneOf, ProtocolRef{Ref: "#/components/messages/" + key})
+		doc.Components.Messages[key] = ProtocolMessage{Name: spec.Type, Summary: spec.Summary, Payload: schema}
+	}
+	for _, spec := range clientMessages {
+		add(channel.Publish, "client."+spec.Type, spec, messageSchemas[spec.Type])
+	}
+	for _, spec := range serverMessages {
+		add(channel.Subscribe, "server."+spec.Type, spec, spec.schema())
+	}
+	doc.Channels["/ws"] = channel
+	return doc
+}
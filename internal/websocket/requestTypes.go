@@ -1,14 +1,78 @@
 package websocket
 
+import "websocket-chat/internal/apierr"
+
 // websocket requests
+
+// BaseMessage is the envelope every client message shares. ID is an
+// optional client-chosen request ID echoed in the ack or error the message
+// produces, and V the protocol version the client speaks.
 type BaseMessage struct {
-	Type string `json:"type"`
+	Type      string `json:"type"`
+	RequestID string `json:"id,omitempty" schema:"minLength=1,maxLength=64"`
+	Version   int    `json:"v,omitempty" schema:"minimum=1"`
 }
 
 type AddOptionMessage struct {
-	Content string `json:"content"`
+	BaseMessage
+	Content string `json:"content" schema:"minLength=1"`
 }
 
 type VoteMessage struct {
-	OptionID string `json:"optionID"`
+	BaseMessage
+	OptionID string `json:"optionID" schema:"minLength=1,maxLength=64"`
+}
+
+type JoinDecisionMessage struct {
+	BaseMessage
+	UserID string `json:"userID" schema:"minLength=1,maxLength=64"`
+}
+
+type AuthMessage struct {
+	Type  string `json:"type"`
+	Token string `json:"token" schema:"minLength=1"`
+}
+
+// websocket responses
+type AuthenticatedMessage struct {
+	Type     string `json:"type"`
+	Protocol int    `json:"protocol"`
+}
+
+type JoinRequestMessage struct {
+	Type        string `json:"type"`
+	UserID      string `json:"userID"`
+	DisplayName string `json:"displayName"`
+}
+
+// AvailabilityChangedMessage tells the room which dates a user added to and
+// removed from their availability.
+type AvailabilityChangedMessage struct {
+	Type    string   `json:"type"`
+	UserID  string   `json:"userID"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// JoinStatusMessage tells a lobby client it is waiting, or has been let in.
+type JoinStatusMessage struct {
+	Type string `json:"type"`
+}
+
+// AckMessage confirms a client message that carried a request ID was
+// handled. For is the acknowledged message's type.
+type AckMessage struct {
+	Type      string `json:"type"`
+	RequestID string `json:"id"`
+	For       string `json:"for"`
+}
+
+// ErrorMessage reports why a client message was rejected. RequestID is set
+// when the message carried one, and Details lists the invalid fields.
+type ErrorMessage struct {
+	Type      string              `json:"type"`
+	Code      string              `json:"code"`
+	Message   string              `json:"message"`
+	Details   []apierr.FieldError `json:"details,omitempty"`
+	RequestID string              `json:"id,omitempty"`
 }
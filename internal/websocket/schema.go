@@ -0,0 +1,244 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Schema is the subset of JSON Schema the protocol document uses and
+// Validate enforces.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Const                string             `json:"const,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf derives a schema from a Go type the way encoding/json would
+// marshal it. Fields without omitempty are required, embedded structs are
+// flattened, and a field's schema tag adds constraints such as
+// `schema:"minLength=1,maxLength=500"`.
+func schemaOf(t reflect.Type) *Schema {
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object"}
+	case reflect.Struct:
+		s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		addFields(s, t)
+		return s
+	}
+	return &Schema{}
+}
+
+func addFields(s *Schema, t reflect.Type) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			addFields(s, f.Type)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := schemaOf(f.Type)
+		constrain(prop, f.Tag.Get("schema"))
+		s.Properties[name] = prop
+		if !slices.Contains(strings.Split(opts, ","), "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// constrain applies a schema struct tag. A malformed tag is a programming
+// error, so it panics when the protocol is built at init.
+func constrain(s *Schema, tag string) {
+	if tag == "" {
+		return
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(rule, "=")
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			panic(fmt.Sprintf("websocket: bad schema tag %q", tag))
+		}
+		switch key {
+		case "minLength":
+			s.MinLength = &n
+		case "maxLength":
+			s.MaxLength = &n
+		case "minimum":
+			s.Minimum = &n
+		case "maximum":
+			s.Maximum = &n
+		default:
+			panic(fmt.Sprintf("websocket: unknown schema rule %q", key))
+		}
+	}
+}
+
+// Validate checks a JSON document against the schema and returns the first
+// violation it finds as a *SchemaError.
+func (s *Schema) Validate(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return invalid("message", "is not valid JSON")
+	}
+	return s.validate("message", v)
+}
+
+func (s *Schema) validate(path string, v interface{}) error {
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return invalid(path, "must be an object")
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return invalid(field(path, name), "is required")
+			}
+		}
+		for _, name := range sortedKeys(obj) {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return invalid(field(path, name), "is not allowed")
+				}
+				continue
+			}
+			if err := prop.validate(field(path, name), obj[name]); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return invalid(path, "must be an array")
+		}
+		for i, item := range items {
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return invalid(path, "must be a string")
+		}
+		if s.Const != "" && str != s.Const {
+			return invalid(path, "must be %q", s.Const)
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, str) {
+			return invalid(path, "must be one of %s", strings.Join(s.Enum, ", "))
+		}
+		n := utf8.RuneCountInString(str)
+		if s.MinLength != nil && *s.MinLength == 1 && n == 0 {
+			return invalid(path, "cannot be empty")
+		}
+		if s.MinLength != nil && n < *s.MinLength {
+			return invalid(path, "must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return invalid(path, "must be at most %d characters", *s.MaxLength)
+		}
+	case "integer":
+		num, ok := v.(json.Number)
+		if !ok {
+			return invalid(path, "must be an integer")
+		}
+		n, err := num.Int64()
+		if err != nil {
+			return invalid(path, "must be an integer")
+		}
+		if s.Minimum != nil && n < int64(*s.Minimum) {
+			return invalid(path, "must be at least %d", *s.Minimum)
+		}
+		if s.Maximum != nil && n > int64(*s.Maximum) {
+			return invalid(path, "must be at most %d", *s.Maximum)
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			return invalid(path, "must be a number")
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return invalid(path, "must be a boolean")
+		}
+	}
+	return nil
+}
+
+// SchemaError is a validation failure at Field, the JSON path of the
+// offending value. The document root is named "message".
+type SchemaError struct {
+	Field   string
+	Message string
+}
+
+func (e *SchemaError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+func invalid(path, format string, args ...interface{}) error {
+	return &SchemaError{Field: path, Message: fmt.Sprintf(format, args...)}
+}
+
+// field names a property in errors. Top-level fields are named on their
+// own, since the message itself is the root.
+func field(path, name string) string {
+	if path == "message" {
+		return name
+	}
+	return path + "." + name
+}
+
+// sortedKeys keeps validation errors deterministic.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
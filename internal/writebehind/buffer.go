@@ -0,0 +1,207 @@
+// Package writebehind queues vote changes in memory and stores them in
+// batches, so a vote can be shown to the room before the database has it.
+// Every change is synced to a write-ahead log on local disk before it is
+// acknowledged, and changes left in the log by a crash are stored on the
+// next start.
+package writebehind
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+	"websocket-chat/internal/metrics"
+	"websocket-chat/internal/models"
+)
+
+// Store is where queued changes end up. *store.SQLStore implements it.
+type Store interface {
+	ApplyVoteChanges(ctx context.Context, changes []models.VoteChange) error
+}
+
+// Buffer holds vote changes until they are stored. Changes being stored
+// still count as pending, so readers that overlay them on what the store
+// returns never miss one. The last batch stored stays pending too, until
+// the next flush replaces it: a reader that loaded from the store just
+// before that batch landed still sees it, as long as its load does not
+// span two flushes; readers that cache loads have to load again after
+// OnStored. Replaying a stored change over what the store returns is
+// harmless: while the buffer is in use every vote change goes through it,
+// so none newer is overwritten, and votes the store dropped with their
+// option or user are left out of the overlay.
+type Buffer struct {
+	store    Store
+	interval time.Duration
+	maxBatch int
+	kick     chan struct{}
+	onStored func(roomIDs []string)
+
+	// flushMu serializes flushes; mu guards the fields below.
+	flushMu  sync.Mutex
+	mu       sync.Mutex
+	wal      *wal
+	pending  []models.VoteChange
+	inflight []models.VoteChange
+	stored   []models.VoteChange
+}
+
+// Open replays the write-ahead log in dir and returns a buffer holding the
+// changes it recovered. They are stored by the first flush.
+func Open(dir string, s Store, interval time.Duration, maxBatch int) (*Buffer, error) {
+	w, recovered, err := openWAL(dir)
+	if err != nil {
+		return nil, err
+	}
+	metrics.WriteBehindPending.Set(float64(len(recovered)))
+	return &Buffer{
+		store:    s,
+		interval: interval,
+		maxBatch: maxBatch,
+		kick:     make(chan struct{}, 1),
+		wal:      w,
+		pending:  recovered,
+	}, nil
+}
+
+// OnStored sets fn to be called with the rooms of each batch once the store
+// has it, so cached reads of those rooms can be dropped. It must be called
+// before Run.
+func (b *Buffer) OnStored(fn func(roomIDs []string)) {
+	b.onStored = fn
+}
+
+// Record logs the change and queues it. Once Record returns the change
+// survives a crash.
+func (b *Buffer) Record(change models.VoteChange) error {
+	b.mu.Lock()
+	if err := b.wal.append(change); err != nil {
+		b.mu.Unlock()
+		return err
+	}
+	b.pending = append(b.pending, change)
+	n := len(b.pending)
+	metrics.WriteBehindPending.Set(float64(n + len(b.inflight)))
+	b.mu.Unlock()
+
+	if n >= b.maxBatch {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Pending returns the room's changes not yet stored, and those of the last
+// batch stored, oldest first.
+func (b *Buffer) Pending(roomID string) []models.VoteChange {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var changes []models.VoteChange
+	for _, list := range [][]models.VoteChange{b.stored, b.inflight, b.pending} {
+		for _, change := range list {
+			if change.RoomID == roomID {
+				changes = append(changes, change)
+			}
+		}
+	}
+	return changes
+}
+
+// Len reports how many changes are waiting to be stored.
+func (b *Buffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.inflight) + len(b.pending)
+}
+
+// Flush stores every queued change in one batch. On failure the changes
+// stay queued, and in the log, for the next flush.
+func (b *Buffer) Flush(ctx context.Context) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	if len(b.pending) == 0 && len(b.wal.sealed) == 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	sealed, err := b.wal.seal()
+	if err != nil {
+		b.mu.Unlock()
+		return err
+	}
+	b.inflight, b.pending = b.pending, nil
+	batch := b.inflight
+	b.mu.Unlock()
+
+	if len(batch) > 0 {
+		err = b.store.ApplyVoteChanges(ctx, batch)
+	}
+
+	b.mu.Lock()
+	if err != nil {
+		b.pending = append(b.inflight, b.pending...)
+		b.inflight = nil
+		b.mu.Unlock()
+		return err
+	}
+	if len(batch) > 0 {
+		b.stored = batch
+	}
+	b.inflight = nil
+	metrics.WriteBehindPending.Set(float64(len(b.pending)))
+	err = b.wal.remove(sealed)
+	b.mu.Unlock()
+
+	if b.onStored != nil && len(batch) > 0 {
+		b.onStored(roomIDs(batch))
+	}
+	return err
+}
+
+// roomIDs lists the rooms changes were made in, each once.
+func roomIDs(changes []models.VoteChange) []string {
+	var ids []string
+	for _, change := range changes {
+		if !slices.Contains(ids, change.RoomID) {
+			ids = append(ids, change.RoomID)
+		}
+	}
+	return ids
+}
+
+// Run flushes every interval, and sooner when a batch fills up, until ctx
+// is done.
+func (b *Buffer) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-b.kick:
+		}
+		if err := b.Flush(ctx); err != nil {
+			metrics.WriteBehindFlushErrors.Inc()
+			slog.Error("Failed to store queued votes", "pending", b.Len(), "err", err)
+		}
+	}
+}
+
+// Close stores what is still queued and closes the log. Changes it cannot
+// store stay in the log for the next start.
+func (b *Buffer) Close(ctx context.Context) error {
+	err := b.Flush(ctx)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if closeErr := b.wal.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,167 @@
+package writebehind
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+	"websocket-chat/internal/models"
+)
+
+// fakeStore records the batches it is given. While fail is set it rejects
+// them; when block is set ApplyVoteChanges signals started and waits on it.
+type fakeStore struct {
+	mu      sync.Mutex
+	fail    error
+	block   chan struct{}
+	started chan struct{}
+	batches [][]models.VoteChange
+}
+
+func (s *fakeStore) ApplyVoteChanges(_ context.Context, changes []models.VoteChange) error {
+	s.mu.Lock()
+	block, fail := s.block, s.fail
+	s.mu.Unlock()
+	if block != nil {
+		s.started <- struct{}{}
+		<-block
+	}
+	if fail != nil {
+		return fail
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, slices.Clone(changes))
+	return nil
+}
+
+func openBuffer(t *testing.T, dir string, s Store) *Buffer {
+	t.Helper()
+	b, err := Open(dir, s, time.Hour, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func record(t *testing.T, b *Buffer, changes ...models.VoteChange) {
+	t.Helper()
+	for _, change := range changes {
+		if err := b.Record(change); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFailedFlushRequeuesBatchFirst(t *testing.T) {
+	ctx := context.Background()
+	s := &fakeStore{fail: errors.New("database is down")}
+	b := openBuffer(t, t.TempDir(), s)
+	defer b.Close(ctx)
+
+	record(t, b, change(1), change(2))
+	if err := b.Flush(ctx); err == nil {
+		t.Fatal("flush succeeded with the store down")
+	}
+	record(t, b, change(3))
+
+	want := []models.VoteChange{change(1), change(2), change(3)}
+	if got := b.Pending("room"); !slices.Equal(got, want) {
+		t.Errorf("pending after failed flush = %v, want %v", got, want)
+	}
+	if b.Len() != 3 {
+		t.Errorf("len after failed flush = %d, want 3", b.Len())
+	}
+
+	s.fail = nil
+	if err := b.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.batches) != 1 || !slices.Equal(s.batches[0], want) {
+		t.Errorf("stored batches = %v, want one batch of %v", s.batches, want)
+	}
+	if b.Len() != 0 {
+		t.Errorf("len after flush = %d, want 0", b.Len())
+	}
+}
+
+func TestPendingOrder(t *testing.T) {
+	ctx := context.Background()
+	s := &fakeStore{}
+	b := openBuffer(t, t.TempDir(), s)
+	defer b.Close(ctx)
+
+	other := models.VoteChange{VoteID: "other", RoomID: "other-room", UserID: "user", OptionID: "option"}
+	record(t, b, change(1), other)
+	if err := b.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	record(t, b, change(2))
+
+	s.mu.Lock()
+	s.block, s.started = make(chan struct{}), make(chan struct{})
+	s.mu.Unlock()
+	flushed := make(chan error)
+	go func() { flushed <- b.Flush(ctx) }()
+	<-s.started
+	record(t, b, change(3), other)
+
+	// Stored, then inflight, then pending.
+	want := []models.VoteChange{change(1), change(2), change(3)}
+	if got := b.Pending("room"); !slices.Equal(got, want) {
+		t.Errorf("pending during flush = %v, want %v", got, want)
+	}
+
+	s.mu.Lock()
+	close(s.block)
+	s.block = nil
+	s.mu.Unlock()
+	if err := <-flushed; err != nil {
+		t.Fatal(err)
+	}
+	if want := []models.VoteChange{change(2), change(3)}; !slices.Equal(b.Pending("room"), want) {
+		t.Errorf("pending after flush = %v, want %v", b.Pending("room"), want)
+	}
+}
+
+func TestOpenReplaysUnstoredChanges(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := &fakeStore{}
+
+	// The first buffer is dropped without Close, as in a crash, after one
+	// flush sealed and stored its first segment.
+	crashed := openBuffer(t, dir, s)
+	record(t, crashed, change(1))
+	if err := crashed.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	record(t, crashed, change(2))
+	s.fail = errors.New("database is down")
+	if err := crashed.Flush(ctx); err == nil {
+		t.Fatal("flush succeeded with the store down")
+	}
+	record(t, crashed, change(3))
+	crashed.wal.file.Close()
+
+	s.fail = nil
+	b := openBuffer(t, dir, s)
+	want := []models.VoteChange{change(2), change(3)}
+	if got := b.Pending("room"); !slices.Equal(got, want) {
+		t.Errorf("replayed = %v, want %v", got, want)
+	}
+	if err := b.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	b = openBuffer(t, dir, s)
+	defer b.Close(ctx)
+	if b.Len() != 0 {
+		t.Errorf("len after stored replay = %d, want 0", b.Len())
+	}
+	if len(s.batches) != 2 || !slices.Equal(s.batches[1], want) {
+		t.Errorf("stored batches = %v, want the replay stored second", s.batches)
+	}
+}
@@ -0,0 +1,233 @@
+package writebehind
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"websocket-chat/internal/models"
+)
+
+const segmentSuffix = ".wal"
+
+// wal is the write-ahead log of vote changes not yet stored. It is a
+// directory of numbered segment files of JSON lines. Appends go to the
+// newest segment and are synced before they return; a flush seals the
+// segment and starts another, and sealed segments are removed once their
+// changes are stored.
+type wal struct {
+	dir  string
+	file *os.File
+	// size is how much of file holds complete, acknowledged lines. torn
+	// marks a failed append that could not be cut back to size, so the
+	// next append starts a new segment rather than continue the torn line.
+	size   int64
+	torn   bool
+	next   uint64
+	sealed []string
+}
+
+// openWAL reads back every segment left in dir, oldest first, and starts a
+// new one. The recovered segments count as sealed.
+func openWAL(dir string) (*wal, []models.VoteChange, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create write-ahead log directory: %w", err)
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w := &wal{dir: dir}
+	var recovered []models.VoteChange
+	for _, segment := range segments {
+		changes, err := readSegment(segment.path)
+		if err != nil {
+			return nil, nil, err
+		}
+		recovered = append(recovered, changes...)
+		w.sealed = append(w.sealed, segment.path)
+		w.next = segment.number + 1
+	}
+
+	if err := w.startSegment(); err != nil {
+		return nil, nil, err
+	}
+	return w, recovered, nil
+}
+
+type segment struct {
+	number uint64
+	path   string
+}
+
+func listSegments(dir string) ([]segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read write-ahead log directory: %w", err)
+	}
+	var segments []segment
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentSuffix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		number, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment{number: number, path: filepath.Join(dir, entry.Name())})
+	}
+	slices.SortFunc(segments, func(a, b segment) int {
+		return cmp.Compare(a.number, b.number)
+	})
+	return segments, nil
+}
+
+// readSegment decodes a segment's changes. A line that does not decode was
+// cut short by a crash or a failed append and never acknowledged, so it is
+// skipped; the lines after it are read as usual.
+func readSegment(path string) ([]models.VoteChange, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open write-ahead log segment: %w", err)
+	}
+	defer file.Close()
+
+	var changes []models.VoteChange
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var change models.VoteChange
+		if err := json.Unmarshal(scanner.Bytes(), &change); err != nil {
+			slog.Warn("Skipped unreadable write-ahead log line", "segment", path, "err", err)
+			continue
+		}
+		changes = append(changes, change)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read write-ahead log segment: %w", err)
+	}
+	return changes, nil
+}
+
+func (w *wal) startSegment() error {
+	path := filepath.Join(w.dir, fmt.Sprintf("%020d%s", w.next, segmentSuffix))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create write-ahead log segment: %w", err)
+	}
+	w.next++
+	if err := syncDir(w.dir); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	w.file, w.size, w.torn = file, 0, false
+	return nil
+}
+
+// syncDir makes a newly created segment's directory entry durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to sync write-ahead log directory: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync write-ahead log directory: %w", err)
+	}
+	return nil
+}
+
+// append writes the changes to the current segment and syncs it. When
+// either fails, whatever part of the changes reached the segment is cut off
+// again, so the next append does not land behind a torn line.
+func (w *wal) append(changes ...models.VoteChange) error {
+	if w.torn {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	var buf []byte
+	for _, change := range changes {
+		line, err := json.Marshal(change)
+		if err != nil {
+			return fmt.Errorf("failed to encode vote change: %w", err)
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	if _, err := w.file.Write(buf); err != nil {
+		w.discardTail()
+		return fmt.Errorf("failed to write to write-ahead log: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		w.discardTail()
+		return fmt.Errorf("failed to sync write-ahead log: %w", err)
+	}
+	w.size += int64(len(buf))
+	return nil
+}
+
+// discardTail truncates the segment to its acknowledged lines after a
+// failed append, or marks it torn when that fails too.
+func (w *wal) discardTail() {
+	if w.file.Truncate(w.size) != nil || w.file.Sync() != nil {
+		w.torn = true
+	}
+}
+
+// rotate seals the current segment and starts another.
+func (w *wal) rotate() error {
+	current := w.file
+	if err := w.startSegment(); err != nil {
+		return err
+	}
+	current.Close()
+	w.sealed = append(w.sealed, current.Name())
+	return nil
+}
+
+// seal starts a new segment and returns every sealed segment, whose
+// changes the caller is about to store. On error the current segment stays
+// open.
+func (w *wal) seal() ([]string, error) {
+	if err := w.rotate(); err != nil {
+		return nil, err
+	}
+	return slices.Clone(w.sealed), nil
+}
+
+// remove deletes sealed segments, oldest first, once their changes have
+// been stored. It stops at the first segment it cannot delete, which stays
+// sealed for the next flush to retry, so the segments left on disk always
+// replay the latest changes in order.
+func (w *wal) remove(paths []string) error {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove write-ahead log segment: %w", err)
+		}
+		w.sealed = slices.DeleteFunc(w.sealed, func(sealed string) bool { return sealed == path })
+	}
+	return nil
+}
+
+// close closes the current segment, removing it if nothing was appended so
+// restarts do not leave empty segments behind.
+func (w *wal) close() error {
+	info, err := w.file.Stat()
+	if closeErr := w.file.Close(); closeErr != nil {
+		return fmt.Errorf("failed to close write-ahead log: %w", closeErr)
+	}
+	if err == nil && info.Size() == 0 {
+		os.Remove(w.file.Name())
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package writebehind
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"websocket-chat/internal/models"
+)
+
+func change(n int) models.VoteChange {
+	return models.VoteChange{VoteID: fmt.Sprintf("vote-%d", n), RoomID: "room", UserID: fmt.Sprintf("user-%d", n), OptionID: "option"}
+}
+
+func line(n int) string {
+	return fmt.Sprintf(`{"voteId":"vote-%d","roomId":"room","userId":"user-%d","optionId":"option"}`, n, n) + "\n"
+}
+
+func writeSegment(t *testing.T, dir string, number int, content string) {
+	t.Helper()
+	path := filepath.Join(dir, fmt.Sprintf("%020d%s", number, segmentSuffix))
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadSegment(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []models.VoteChange
+	}{
+		{name: "empty", content: ""},
+		{name: "complete lines", content: line(1) + line(2), want: []models.VoteChange{change(1), change(2)}},
+		{name: "torn tail line", content: line(1) + line(2)[:20], want: []models.VoteChange{change(1)}},
+		{name: "torn line before acknowledged ones", content: line(1) + line(2)[:20] + "\n" + line(3), want: []models.VoteChange{change(1), change(3)}},
+		{name: "garbage line", content: "not json\n" + line(1), want: []models.VoteChange{change(1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeSegment(t, dir, 1, tt.content)
+			got, err := readSegment(filepath.Join(dir, fmt.Sprintf("%020d%s", 1, segmentSuffix)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("changes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenWALRecoversSealedSegmentsInOrder(t *testing.T) {
+	dir := t.TempDir()
+	// Numbered so that name order and number order differ.
+	writeSegment(t, dir, 10, line(4))
+	writeSegment(t, dir, 2, line(2)+line(3)[:15])
+	writeSegment(t, dir, 1, line(1))
+	writeSegment(t, dir, 9, "")
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte(line(9)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	w, recovered, err := openWAL(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+
+	if want := []models.VoteChange{change(1), change(2), change(4)}; !slices.Equal(recovered, want) {
+		t.Errorf("recovered = %v, want %v", recovered, want)
+	}
+	if len(w.sealed) != 4 {
+		t.Errorf("sealed = %v, want the 4 recovered segments", w.sealed)
+	}
+	if want := filepath.Join(dir, fmt.Sprintf("%020d%s", 11, segmentSuffix)); w.file.Name() != want {
+		t.Errorf("new segment = %s, want %s", w.file.Name(), want)
+	}
+}
+
+func TestAppendAfterFailedAppend(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(t *testing.T, w *wal)
+	}{
+		{
+			// A write cut short leaves part of a line behind, which is
+			// truncated away.
+			name: "partial write",
+			fail: func(t *testing.T, w *wal) {
+				if _, err := w.file.Write([]byte(line(2)[:20])); err != nil {
+					t.Fatal(err)
+				}
+				w.discardTail()
+				if w.torn {
+					t.Fatal("segment torn after a successful truncate")
+				}
+			},
+		},
+		{
+			// A segment that cannot be truncated is left behind for a new
+			// one.
+			name: "segment unusable",
+			fail: func(t *testing.T, w *wal) {
+				w.file.Close()
+				if err := w.append(change(2)); err == nil {
+					t.Fatal("append to a closed segment succeeded")
+				}
+				if !w.torn {
+					t.Fatal("segment not marked torn")
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			w, _, err := openWAL(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.append(change(1)); err != nil {
+				t.Fatal(err)
+			}
+			tt.fail(t, w)
+			if err := w.append(change(3)); err != nil {
+				t.Fatal(err)
+			}
+			w.close()
+
+			_, recovered, err := openWAL(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []models.VoteChange{change(1), change(3)}; !slices.Equal(recovered, want) {
+				t.Errorf("recovered = %v, want %v", recovered, want)
+			}
+		})
+	}
+}